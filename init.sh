@@ -28,7 +28,7 @@ sh ./development/setup-go.sh
 ## Setup pgsql db
 echo
 echo "Setting up pgsql..."
-go run ./development/setup-db.go
+go run ./server migrate up
 
 RET=$?
 if [ $RET -eq 0 ]; then
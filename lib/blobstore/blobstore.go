@@ -0,0 +1,15 @@
+// Package blobstore provides storage for binary objects, e.g. file attachments, by id
+package blobstore
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type IBlobStore interface {
+	Put(id string, data io.Reader) (int64, error)
+	Get(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
@@ -0,0 +1,96 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local file system blob store. Each blob is a file named by its id.
+type LocalStore struct {
+	IBlobStore
+	Root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Root: root}, nil
+}
+
+func (m *LocalStore) path(id string) (string, error) {
+
+	// Ids must not escape the root directory
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", errors.New("invalid blob id: " + id)
+	}
+	return filepath.Join(m.Root, id), nil
+}
+
+// Write the blob. Returns the number of bytes written.
+func (m *LocalStore) Put(id string, data io.Reader) (int64, error) {
+
+	path, err := m.path(id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write to a temp. file first. Readers never see a partial blob.
+	tmp, err := os.CreateTemp(m.Root, ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		os.Remove(tmp.Name())
+	}()
+
+	size, err := io.Copy(tmp, data)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return size, os.Rename(tmp.Name(), path)
+}
+
+func (m *LocalStore) Get(id string) (io.ReadCloser, error) {
+
+	path, err := m.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (m *LocalStore) Delete(id string) error {
+
+	path, err := m.path(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
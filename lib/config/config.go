@@ -18,6 +18,10 @@ func init() {
 		err = godotenv.Load(envFile)
 	} else {
 		err = godotenv.Load() // Get default .env file in root
+		if os.IsNotExist(err) {
+			// No .env file. Config is taken from the environment, e.g. in tests.
+			err = nil
+		}
 	}
 
 	if err != nil {
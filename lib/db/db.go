@@ -0,0 +1,37 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"yt/chat/lib/config"
+)
+
+const (
+	// Persistence backends. See DB_DRIVER config.
+	DB_DRIVER_PGSQL  = "pgsql"
+	DB_DRIVER_SQLITE = "sqlite" // Single file database. See SERVER_DB config.
+	DB_DRIVER_MEMORY = "memory" // No persistence. For demos, and tests.
+)
+
+// Get the configured persistence backend. Defaults to Postgres.
+func GetDriver() string {
+
+	driver := config.GetValue("DB_DRIVER")
+	if driver == "" {
+		return DB_DRIVER_PGSQL
+	}
+	return driver
+}
+
+// Connect to the configured database backend
+func GetConnection() (*sql.DB, error) {
+
+	switch GetDriver() {
+	case DB_DRIVER_PGSQL:
+		return getPgsqlConnection()
+	case DB_DRIVER_SQLITE:
+		return getSqliteConnection()
+	default:
+		return nil, fmt.Errorf("no database connection for DB_DRIVER: %s", GetDriver())
+	}
+}
@@ -0,0 +1,256 @@
+// Package migrate applies the versioned schema migrations of a database
+// backend. Migrations are embedded sql files in sql/<driver>/, named
+// <version>_<name>.up.sql, and <version>_<name>.down.sql.
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"yt/chat/lib/db"
+	"yt/chat/lib/utils/log"
+)
+
+//go:embed sql
+var migrationFiles embed.FS
+
+var ErrNoMigrations = errors.New("no migrations for database driver")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	DbConn     *sql.DB
+	Driver     string
+	migrations []Migration
+}
+
+func NewMigrator(conn *sql.DB, driver string) (*Migrator, error) {
+
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DbConn: conn, Driver: driver, migrations: migrations}, nil
+}
+
+// Read the migrations of the driver, ordered by version
+func loadMigrations(driver string) ([]Migration, error) {
+
+	dir := path.Join("sql", driver)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoMigrations, driver)
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+
+		fileName := entry.Name()
+
+		var up bool
+		var base string
+
+		if strings.HasSuffix(fileName, ".up.sql") {
+			up = true
+			base = strings.TrimSuffix(fileName, ".up.sql")
+		} else if strings.HasSuffix(fileName, ".down.sql") {
+			base = strings.TrimSuffix(fileName, ".down.sql")
+		} else {
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, errors.New("invalid migration file name: " + fileName)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("duplicate migration version: %d", version)
+		}
+
+		if up {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("missing up migration: %04d_%s", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Placeholder of the n-th query parameter
+func (m *Migrator) param(n int) string {
+
+	if m.Driver == db.DB_DRIVER_PGSQL {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+func (m *Migrator) createVersionTable() error {
+
+	sqlStmt := `CREATE TABLE IF NOT EXISTS schema_version (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`
+
+	_, err := m.DbConn.Exec(sqlStmt)
+	if err != nil {
+		return fmt.Errorf("%q: %s", err.Error(), sqlStmt)
+	}
+
+	return nil
+}
+
+// All migrations of the driver, ordered by version
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Latest applied migration version. Zero if none.
+func (m *Migrator) Version() (int, error) {
+
+	err := m.createVersionTable()
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+
+	err = m.DbConn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Apply pending migrations. Returns the number of migrations applied.
+func (m *Migrator) Up() (int, error) {
+
+	current, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+
+	for _, migration := range m.migrations {
+
+		if migration.Version <= current {
+			continue
+		}
+
+		insertStmt := fmt.Sprintf("INSERT INTO schema_version(version, name) VALUES(%s, %s)",
+			m.param(1), m.param(2))
+
+		err = m.apply(migration.Up, insertStmt, migration.Version, migration.Name)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s up failed: %w",
+				migration.Version, migration.Name, err)
+		}
+
+		log.GetLogger().Info(fmt.Sprintf("Applied migration %04d_%s", migration.Version, migration.Name))
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Revert the latest applied migrations, up to steps. Returns the number of
+// migrations reverted.
+func (m *Migrator) Down(steps int) (int, error) {
+
+	current, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+
+	for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+
+		if migration.Down == "" {
+			return reverted, fmt.Errorf("migration %04d_%s has no down migration",
+				migration.Version, migration.Name)
+		}
+
+		deleteStmt := "DELETE FROM schema_version WHERE version = " + m.param(1)
+
+		err = m.apply(migration.Down, deleteStmt, migration.Version)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %04d_%s down failed: %w",
+				migration.Version, migration.Name, err)
+		}
+
+		log.GetLogger().Info(fmt.Sprintf("Reverted migration %04d_%s", migration.Version, migration.Name))
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+// Run a migration script, and record the schema version in one transaction
+func (m *Migrator) apply(script string, versionStmt string, args ...any) error {
+
+	tx, err := m.DbConn.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(versionStmt, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,33 @@
+-- Tables exist in installs created by development/setup_db.go. IF NOT EXISTS
+-- lets those installs adopt migrations.
+
+CREATE TABLE IF NOT EXISTS channel (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) UNIQUE NOT NULL,
+	private INT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS subscriber (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_seen TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS transient (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_seen TIMESTAMP NULL
+);
+
+-- setup_db.go created subscriber, and transient without last seen.
+-- See Server.refreshPresence()
+ALTER TABLE subscriber ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP NULL;
+ALTER TABLE transient ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP NULL;
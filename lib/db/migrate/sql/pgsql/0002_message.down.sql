@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS message_reaction;
+DROP TABLE IF EXISTS message_edit;
+DROP TABLE IF EXISTS message;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS message (
+	id UUID PRIMARY KEY,
+	channel VARCHAR(255) NOT NULL,
+	subscriber_id VARCHAR(50) NOT NULL DEFAULT '',
+	subscriber_name VARCHAR(50) NOT NULL,
+	message TEXT NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	edited TIMESTAMP NULL,
+	deleted TIMESTAMP NULL,
+	parent_id UUID NULL REFERENCES message(id)
+);
+
+CREATE INDEX IF NOT EXISTS message_channel_created_idx ON message (channel, created);
+CREATE INDEX IF NOT EXISTS message_parent_idx ON message (parent_id);
+
+CREATE TABLE IF NOT EXISTS message_edit (
+	id SERIAL PRIMARY KEY,
+	message_id UUID NOT NULL REFERENCES message(id),
+	action VARCHAR(10) NOT NULL,
+	previous TEXT NOT NULL,
+	editor VARCHAR(50) NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS message_reaction (
+	message_id UUID NOT NULL REFERENCES message(id),
+	subscriber VARCHAR(50) NOT NULL,
+	reaction VARCHAR(32) NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (message_id, subscriber, reaction)
+);
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS channel_member (
+	channel VARCHAR(255) NOT NULL,
+	subscriber VARCHAR(50) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	invited_by VARCHAR(50) NOT NULL DEFAULT '',
+	role VARCHAR(20) NOT NULL DEFAULT 'member',
+	banned BOOLEAN NOT NULL DEFAULT FALSE,
+	muted BOOLEAN NOT NULL DEFAULT FALSE,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (channel, subscriber)
+);
+
+CREATE TABLE IF NOT EXISTS read_marker (
+	channel VARCHAR(255) NOT NULL,
+	subscriber VARCHAR(50) NOT NULL,
+	message_id UUID NULL REFERENCES message(id),
+	read_created TIMESTAMP NOT NULL,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (channel, subscriber)
+);
+
+CREATE TABLE IF NOT EXISTS mention (
+	id SERIAL PRIMARY KEY,
+	subscriber VARCHAR(50) NOT NULL,
+	channel VARCHAR(255) NOT NULL,
+	message_id UUID NOT NULL,
+	sender VARCHAR(50) NOT NULL,
+	seen BOOLEAN NOT NULL DEFAULT FALSE,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS mention_subscriber_seen_idx ON mention (subscriber, seen);
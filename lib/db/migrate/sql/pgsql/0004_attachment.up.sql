@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS attachment (
+	id UUID PRIMARY KEY,
+	subscriber VARCHAR(50) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	content_type VARCHAR(100) NOT NULL,
+	size BIGINT NOT NULL,
+	channel VARCHAR(255) NULL,
+	message_id UUID NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS attachment_message_idx ON attachment (message_id);
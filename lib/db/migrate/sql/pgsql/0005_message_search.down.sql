@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS message_search_idx;
+ALTER TABLE message DROP COLUMN IF EXISTS search;
@@ -0,0 +1,5 @@
+-- Full text search. See MessagePgsql.Search()
+ALTER TABLE message ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', message)) STORED;
+
+CREATE INDEX IF NOT EXISTS message_search_idx ON message USING GIN (search);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS message_channel_seq_idx;
+ALTER TABLE message DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,4 @@
+-- Channel order. See Channel.stamp()
+ALTER TABLE message ADD COLUMN IF NOT EXISTS seq BIGINT NULL;
+
+CREATE INDEX IF NOT EXISTS message_channel_seq_idx ON message (channel, seq);
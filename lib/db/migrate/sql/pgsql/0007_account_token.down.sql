@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_token;
+ALTER TABLE subscriber DROP COLUMN IF EXISTS email_verified;
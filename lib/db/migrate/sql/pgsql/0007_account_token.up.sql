@@ -0,0 +1,14 @@
+-- Email verification, and password reset. See AccountTokenPgsql
+ALTER TABLE subscriber ADD COLUMN IF NOT EXISTS email_verified TIMESTAMP NULL;
+
+CREATE TABLE IF NOT EXISTS account_token (
+	id SERIAL PRIMARY KEY,
+	subscriber VARCHAR(50) NOT NULL,
+	purpose VARCHAR(20) NOT NULL,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	expires TIMESTAMP NOT NULL,
+	used TIMESTAMP NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS account_token_subscriber_idx ON account_token (subscriber);
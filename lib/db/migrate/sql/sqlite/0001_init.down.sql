@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS transient;
+DROP TABLE IF EXISTS subscriber;
+DROP TABLE IF EXISTS channel;
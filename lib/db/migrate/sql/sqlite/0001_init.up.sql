@@ -0,0 +1,27 @@
+-- Channels, and subscribers only. See DB_DRIVER=sqlite.
+
+CREATE TABLE IF NOT EXISTS channel (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(255) UNIQUE NOT NULL,
+	private INT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS subscriber (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_seen TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS transient (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_seen TIMESTAMP NULL
+);
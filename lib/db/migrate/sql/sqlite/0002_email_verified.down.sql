@@ -0,0 +1 @@
+ALTER TABLE subscriber DROP COLUMN email_verified;
@@ -0,0 +1,2 @@
+-- Email verification. See SubscriberSqlite.SetEmailVerified()
+ALTER TABLE subscriber ADD COLUMN email_verified TIMESTAMP NULL;
@@ -0,0 +1,34 @@
+-- Timestamps compared in queries are stored by the server, in UTC. See MessageSqlite
+CREATE TABLE IF NOT EXISTS message (
+	id VARCHAR(36) PRIMARY KEY,
+	channel VARCHAR(255) NOT NULL,
+	subscriber_id VARCHAR(50) NOT NULL DEFAULT '',
+	subscriber_name VARCHAR(50) NOT NULL,
+	message TEXT NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	edited TIMESTAMP NULL,
+	deleted TIMESTAMP NULL,
+	parent_id VARCHAR(36) NULL REFERENCES message(id),
+	seq INTEGER NULL
+);
+
+CREATE INDEX IF NOT EXISTS message_channel_created_idx ON message (channel, created);
+CREATE INDEX IF NOT EXISTS message_channel_seq_idx ON message (channel, seq);
+CREATE INDEX IF NOT EXISTS message_parent_idx ON message (parent_id);
+
+CREATE TABLE IF NOT EXISTS message_edit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id VARCHAR(36) NOT NULL REFERENCES message(id),
+	action VARCHAR(10) NOT NULL,
+	previous TEXT NOT NULL,
+	editor VARCHAR(50) NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS message_reaction (
+	message_id VARCHAR(36) NOT NULL REFERENCES message(id),
+	subscriber VARCHAR(50) NOT NULL,
+	reaction VARCHAR(32) NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (message_id, subscriber, reaction)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS mention;
+DROP TABLE IF EXISTS read_marker;
+DROP TABLE IF EXISTS channel_member;
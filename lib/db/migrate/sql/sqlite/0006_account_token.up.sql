@@ -0,0 +1,12 @@
+-- Email verification, password reset, and refresh tokens. See AccountTokenSqlite
+CREATE TABLE IF NOT EXISTS account_token (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	subscriber VARCHAR(50) NOT NULL,
+	purpose VARCHAR(20) NOT NULL,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	expires TIMESTAMP NOT NULL,
+	used TIMESTAMP NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS account_token_subscriber_idx ON account_token (subscriber);
@@ -0,0 +1,6 @@
+-- Last sequence number handed out per channel, incl. edits, and reactions
+-- that are not stored as messages. See Channel.keepSeq()
+CREATE TABLE IF NOT EXISTS channel_seq (
+	channel VARCHAR(255) PRIMARY KEY,
+	seq BIGINT NOT NULL
+);
@@ -8,7 +8,7 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
-func GetConnection() (*sql.DB, error) {
+func getPgsqlConnection() (*sql.DB, error) {
 
 	psqlinfo := fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
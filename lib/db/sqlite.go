@@ -0,0 +1,27 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"yt/chat/lib/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func getSqliteConnection() (*sql.DB, error) {
+
+	path := config.GetValue("SERVER_DB")
+	if path == "" {
+		return nil, errors.New("SERVER_DB is required for sqlite")
+	}
+
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer. Serialize, rather than fail on locks.
+	conn.SetMaxOpenConns(1)
+
+	return conn, nil
+}
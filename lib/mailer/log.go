@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Append emails to a file instead of sending. For development, and tests.
+type LogMailer struct {
+	IMailer
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func NewLogMailer(path, from string) (*LogMailer, error) {
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogMailer{Path: path, From: from}, nil
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	msg := formatMessage(m.From, to, subject, body)
+	_, err = file.Write(append(msg, "\r\n\r\n"...))
+
+	return err
+}
@@ -0,0 +1,13 @@
+// Package mailer sends plain text emails, e.g. account verification, and
+// password reset links.
+package mailer
+
+const (
+	// Mailers. See MAILER config.
+	MAILER_SMTP = "smtp"
+	MAILER_LOG  = "log" // Write emails to a file. For development, and tests.
+)
+
+type IMailer interface {
+	Send(to string, subject string, body string) error
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Send emails through an SMTP server. Authenticates if user is set.
+type SmtpMailer struct {
+	IMailer
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+func NewSmtpMailer(host, port, user, password, from string) *SmtpMailer {
+	return &SmtpMailer{Host: host, Port: port, User: user, Password: password, From: from}
+}
+
+func (m *SmtpMailer) Send(to string, subject string, body string) error {
+
+	var auth smtp.Auth
+	if m.User != "" {
+		auth = smtp.PlainAuth("", m.User, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(
+		net.JoinHostPort(m.Host, m.Port),
+		auth,
+		m.From,
+		[]string{to},
+		formatMessage(m.From, to, subject, body),
+	)
+}
+
+// RFC 5322 message. Header values are stripped of line breaks.
+func formatMessage(from, to, subject, body string) []byte {
+
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var msg strings.Builder
+
+	msg.WriteString("From: " + clean.Replace(from) + "\r\n")
+	msg.WriteString("To: " + clean.Replace(to) + "\r\n")
+	msg.WriteString("Subject: " + clean.Replace(subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(msg.String())
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"sync"
+)
+
+// Num. of messages queued per subscription. Publishers block on full queues.
+const MEMORY_QUEUE_SIZE = 1000
+
+// In process transport for single server deployments, and tests
+type MemoryTransport struct {
+	ITransport
+	mu     sync.RWMutex
+	topics map[string]map[*memorySubscription]bool
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		topics: make(map[string]map[*memorySubscription]bool),
+	}
+}
+
+func (m *MemoryTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+
+	m.mu.RLock()
+	subs := make([]*memorySubscription, 0, len(m.topics[topic]))
+	for sub := range m.topics[topic] {
+		subs = append(subs, sub)
+	}
+	m.mu.RUnlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.messages <- payload:
+		case <-sub.done:
+			// Unsubscribed meanwhile
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Messages are not kept, all messages are ephemeral
+func (m *MemoryTransport) PublishEphemeral(ctx context.Context, topic string, payload []byte) error {
+	return m.Publish(ctx, topic, payload)
+}
+
+func (m *MemoryTransport) Subscribe(ctx context.Context, topic string) (ISubscription, error) {
+
+	sub := &memorySubscription{
+		transport: m,
+		topic:     topic,
+		messages:  make(chan []byte, MEMORY_QUEUE_SIZE),
+		done:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.topics[topic] == nil {
+		m.topics[topic] = make(map[*memorySubscription]bool)
+	}
+	m.topics[topic][sub] = true
+
+	return sub, nil
+}
+
+func (m *MemoryTransport) unsubscribe(sub *memorySubscription) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.topics[sub.topic], sub)
+	if len(m.topics[sub.topic]) == 0 {
+		delete(m.topics, sub.topic)
+	}
+}
+
+type memorySubscription struct {
+	ISubscription
+	transport *MemoryTransport
+	topic     string
+	messages  chan []byte
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (m *memorySubscription) Messages() <-chan []byte {
+	return m.messages
+}
+
+// Publishers may still hold the subscription. The messages channel is left
+// open, and publishers stop sending on done.
+func (m *memorySubscription) Unsubscribe() error {
+	m.once.Do(func() {
+		m.transport.unsubscribe(m)
+		close(m.done)
+	})
+	return nil
+}
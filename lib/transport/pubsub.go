@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis Pub/Sub transport. Messages published while a server is disconnected
+// from Redis are lost to the server.
+type PubSubTransport struct {
+	ITransport
+	rds *redis.Client
+}
+
+func NewPubSubTransport(rds *redis.Client) *PubSubTransport {
+	return &PubSubTransport{rds: rds}
+}
+
+func (m *PubSubTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+	return m.rds.Publish(ctx, topic, payload).Err()
+}
+
+// Pub/Sub messages are not kept, all messages are ephemeral
+func (m *PubSubTransport) PublishEphemeral(ctx context.Context, topic string, payload []byte) error {
+	return m.Publish(ctx, topic, payload)
+}
+
+func (m *PubSubTransport) Subscribe(ctx context.Context, topic string) (ISubscription, error) {
+
+	pubsub := m.rds.Subscribe(ctx, topic)
+
+	// Wait until active
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	sub := &pubSubSubscription{
+		pubsub:   pubsub,
+		messages: make(chan []byte),
+	}
+
+	go func() {
+		defer close(sub.messages)
+		for msg := range pubsub.Channel() {
+			sub.messages <- []byte(msg.Payload)
+		}
+	}()
+
+	return sub, nil
+}
+
+type pubSubSubscription struct {
+	ISubscription
+	pubsub   *redis.PubSub
+	messages chan []byte
+}
+
+func (m *pubSubSubscription) Messages() <-chan []byte {
+	return m.messages
+}
+
+func (m *pubSubSubscription) Unsubscribe() error {
+	// Closes the pubsub channel, and so the messages channel
+	return m.pubsub.Close()
+}
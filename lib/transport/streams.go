@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+	"yt/chat/lib/utils/log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	STREAM_MAX_LEN       = 10000 // Approx. num. of messages kept per topic
+	STREAM_READ_COUNT    = 100
+	STREAM_BLOCK         = 5 * time.Second
+	STREAM_RETRY_DELAY   = time.Second
+	STREAM_PAYLOAD_FIELD = "payload"
+
+	// Redis keys:
+	//  stream:<topic>            - topic messages
+	//  stream:offset:<node>      - last read message id by topic, of a server
+	//  stream:ephemeral:<topic>  - Pub/Sub channel of ephemeral topic messages
+	STREAM_KEY           = "stream:"
+	STREAM_OFFSET_KEY    = "stream:offset:"
+	STREAM_EPHEMERAL_KEY = "stream:ephemeral:"
+)
+
+// Redis Streams transport. Messages are kept in the stream until read.
+// Servers resume reading from their last offset, after a Redis disconnect
+// or a restart. Offsets are kept in Redis by server, and topic. Ephemeral
+// messages use Redis Pub/Sub, and are not kept.
+type StreamTransport struct {
+	ITransport
+	rds    *redis.Client
+	nodeId string // Server id, stable across restarts. Keys the offsets.
+}
+
+func NewStreamTransport(rds *redis.Client, nodeId string) *StreamTransport {
+	return &StreamTransport{rds: rds, nodeId: nodeId}
+}
+
+func (m *StreamTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+
+	return m.rds.XAdd(ctx, &redis.XAddArgs{
+		Stream: STREAM_KEY + topic,
+		MaxLen: STREAM_MAX_LEN,
+		Approx: true,
+		Values: map[string]interface{}{STREAM_PAYLOAD_FIELD: payload},
+	}).Err()
+}
+
+func (m *StreamTransport) PublishEphemeral(ctx context.Context, topic string, payload []byte) error {
+	return m.rds.Publish(ctx, STREAM_EPHEMERAL_KEY+topic, payload).Err()
+}
+
+func (m *StreamTransport) Subscribe(ctx context.Context, topic string) (ISubscription, error) {
+
+	pubsub := m.rds.Subscribe(ctx, STREAM_EPHEMERAL_KEY+topic)
+
+	// Wait until active
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	offset, err := m.getOffset(ctx, topic)
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+
+	sub := &streamSubscription{
+		pubsub:   pubsub,
+		messages: make(chan []byte),
+		cancel:   cancel,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		m.read(subCtx, topic, offset, sub.messages)
+	}()
+
+	go func() {
+		defer wg.Done()
+		for msg := range pubsub.Channel() {
+			select {
+			case sub.messages <- []byte(msg.Payload):
+			case <-subCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(sub.messages)
+	}()
+
+	return sub, nil
+}
+
+// Get the offset to read the topic from. The last offset of the server if
+// any. Otherwise the latest message, as "$" does; resolved to its id, so no
+// message published between two reads is missed.
+func (m *StreamTransport) getOffset(ctx context.Context, topic string) (string, error) {
+
+	offset, err := m.rds.HGet(ctx, STREAM_OFFSET_KEY+m.nodeId, topic).Result()
+	if err == nil {
+		return offset, nil
+	} else if err != redis.Nil {
+		return "", err
+	}
+
+	last, err := m.rds.XRevRangeN(ctx, STREAM_KEY+topic, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(last) == 0 {
+		return "0-0", nil
+	}
+	return last[0].ID, nil
+}
+
+// Read topic messages until cancelled. Read errors are retried from the
+// last offset, so no message is lost.
+func (m *StreamTransport) read(ctx context.Context, topic string, offset string, messages chan []byte) {
+
+	key := STREAM_KEY + topic
+	offsetKey := STREAM_OFFSET_KEY + m.nodeId
+
+	for ctx.Err() == nil {
+
+		streams, err := m.rds.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{key, offset},
+			Count:   STREAM_READ_COUNT,
+			Block:   STREAM_BLOCK,
+		}).Result()
+
+		if err == redis.Nil {
+			// Nothing new
+			continue
+		} else if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.GetLogger().Error("Read stream " + key + " failed: " + err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(STREAM_RETRY_DELAY):
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				payload, _ := msg.Values[STREAM_PAYLOAD_FIELD].(string)
+				select {
+				case messages <- []byte(payload):
+				case <-ctx.Done():
+					return
+				}
+				offset = msg.ID
+			}
+		}
+
+		// Resume from here after a restart
+		err = m.rds.HSet(context.Background(), offsetKey, topic, offset).Err()
+		if err != nil {
+			log.GetLogger().Error("Save stream offset failed: " + err.Error())
+		}
+	}
+}
+
+type streamSubscription struct {
+	ISubscription
+	pubsub   *redis.PubSub
+	messages chan []byte
+	cancel   context.CancelFunc
+}
+
+func (m *streamSubscription) Messages() <-chan []byte {
+	return m.messages
+}
+
+func (m *streamSubscription) Unsubscribe() error {
+	m.cancel()
+	return m.pubsub.Close()
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Connect to a Redis server, if set, e.g. TEST_REDIS_ADDR=localhost:6379
+// Keys of the test are removed after the test.
+func openTestRedis(t *testing.T) *redis.Client {
+
+	t.Helper()
+
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+
+	rds := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { rds.Close() })
+
+	if err := rds.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	return rds
+}
+
+// A topic, and node id of its own for each test
+func testTopic(t *testing.T, rds *redis.Client) (string, string) {
+
+	t.Helper()
+
+	id := fmt.Sprintf("%d", time.Now().UnixNano())
+	topic := "test-topic-" + id
+	nodeId := "test-node-" + id
+
+	t.Cleanup(func() {
+		rds.Del(context.Background(), STREAM_KEY+topic, STREAM_OFFSET_KEY+nodeId)
+	})
+
+	return topic, nodeId
+}
+
+func receive(t *testing.T, sub ISubscription) string {
+
+	t.Helper()
+
+	select {
+	case msg, ok := <-sub.Messages():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return string(msg)
+	case <-time.After(2 * STREAM_BLOCK):
+		t.Fatal("no message received")
+	}
+	return ""
+}
+
+func TestStreamTransportResume(t *testing.T) {
+
+	rds := openTestRedis(t)
+	topic, nodeId := testTopic(t, rds)
+	ctx := context.Background()
+
+	before := NewStreamTransport(rds, nodeId)
+	sub, err := before.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	if err = before.Publish(ctx, topic, []byte("first")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+	if got := receive(t, sub); got != "first" {
+		t.Fatalf("received %q, want first", got)
+	}
+
+	// The offset is saved after the message is delivered
+	for i := 0; !rds.HExists(ctx, STREAM_OFFSET_KEY+nodeId, topic).Val(); i++ {
+		if i == 100 {
+			t.Fatal("offset not saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sub.Unsubscribe()
+
+	// Published while the server is down
+	for _, payload := range []string{"second", "third"} {
+		if err = before.Publish(ctx, topic, []byte(payload)); err != nil {
+			t.Fatalf("Publish() failed: %v", err)
+		}
+	}
+
+	restarted, err := NewStreamTransport(rds, nodeId).Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer restarted.Unsubscribe()
+
+	// A server without an offset reads new messages only
+	other, err := NewStreamTransport(rds, nodeId+"-other").Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer other.Unsubscribe()
+	defer rds.Del(ctx, STREAM_OFFSET_KEY+nodeId+"-other")
+
+	if err = before.Publish(ctx, topic, []byte("fourth")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+
+	for _, want := range []string{"second", "third", "fourth"} {
+		if got := receive(t, restarted); got != want {
+			t.Errorf("restarted server received %q, want %q", got, want)
+		}
+	}
+	if got := receive(t, other); got != "fourth" {
+		t.Errorf("other server received %q, want fourth", got)
+	}
+}
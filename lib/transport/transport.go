@@ -0,0 +1,30 @@
+// Package transport delivers messages published to a topic to all subscribers
+// of the topic, in all servers.
+package transport
+
+import (
+	"context"
+)
+
+const (
+	// Transports. See PUBSUB_TRANSPORT config.
+	TRANSPORT_PUBSUB  = "pubsub"
+	TRANSPORT_STREAMS = "streams"
+	TRANSPORT_MEMORY  = "memory"
+)
+
+type ITransport interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Publish a message to the current subscribers of a topic only, e.g.
+	// typing events. The message is not kept, or replayed.
+	PublishEphemeral(ctx context.Context, topic string, payload []byte) error
+	// Subscribe to a topic. Messages published after Subscribe returns are
+	// delivered to the subscription.
+	Subscribe(ctx context.Context, topic string) (ISubscription, error)
+}
+
+type ISubscription interface {
+	// Messages of the topic. No messages are delivered after unsubscribe.
+	Messages() <-chan []byte
+	Unsubscribe() error
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Behaviour shared by the transports
+func testPublishSubscribe(t *testing.T, transport ITransport, topic string) {
+
+	ctx := context.Background()
+
+	first, err := transport.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer first.Unsubscribe()
+
+	second, err := transport.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	other, err := transport.Subscribe(ctx, topic+"-other")
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer other.Unsubscribe()
+
+	if err = transport.Publish(ctx, topic, []byte("kept")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+	if err = transport.PublishEphemeral(ctx, topic, []byte("ephemeral")); err != nil {
+		t.Fatalf("PublishEphemeral() failed: %v", err)
+	}
+
+	// Every subscriber of the topic
+	for _, sub := range []ISubscription{first, second} {
+		got := map[string]bool{receive(t, sub): true, receive(t, sub): true}
+		if !got["kept"] || !got["ephemeral"] {
+			t.Errorf("received %v, want kept, and ephemeral", got)
+		}
+	}
+
+	// Nothing after unsubscribe
+	if err = second.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe() failed: %v", err)
+	}
+	if err = transport.Publish(ctx, topic, []byte("later")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+	if got := receive(t, first); got != "later" {
+		t.Errorf("received %q, want later", got)
+	}
+	select {
+	case msg, ok := <-second.Messages():
+		if ok {
+			t.Errorf("received %q after unsubscribe", msg)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Nor of other topics
+	select {
+	case msg := <-other.Messages():
+		t.Errorf("received %q of another topic", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	testPublishSubscribe(t, NewMemoryTransport(), "topic")
+}
+
+func TestMemoryTransportUnsubscribed(t *testing.T) {
+
+	transport := NewMemoryTransport()
+	ctx := context.Background()
+
+	// A full queue of an unsubscribed subscription does not block publishers
+	sub, err := transport.Subscribe(ctx, "topic")
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	for i := 0; i < MEMORY_QUEUE_SIZE; i++ {
+		transport.Publish(ctx, "topic", []byte("queued"))
+	}
+	sub.Unsubscribe()
+
+	done := make(chan error)
+	go func() { done <- transport.Publish(ctx, "topic", []byte("dropped")) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Publish() failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish() blocked")
+	}
+
+	if len(transport.topics) != 0 {
+		t.Errorf("%d topics left after unsubscribe, want 0", len(transport.topics))
+	}
+}
+
+func TestPubSubTransport(t *testing.T) {
+
+	rds := openTestRedis(t)
+	topic, _ := testTopic(t, rds)
+	testPublishSubscribe(t, NewPubSubTransport(rds), topic)
+}
+
+func TestStreamTransport(t *testing.T) {
+
+	rds := openTestRedis(t)
+	topic, nodeId := testTopic(t, rds)
+	testPublishSubscribe(t, NewStreamTransport(rds, nodeId), topic)
+}
@@ -157,6 +157,8 @@ func (m *Logger) initialize() {
 	// Get output methods
 	log_outputs := strings.Split(m.output, ",")
 	if len(log_outputs) == 0 || log_outputs[0] == "" {
+		// No output. Messages are dropped, callers must not block.
+		go m.start()
 		return
 	}
 
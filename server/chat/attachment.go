@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"yt/chat/server/chat/model"
+)
+
+const MAX_ATTACHMENTS = 10 // Max. num. of attachments of a message
+
+// Check the uploaded attachments of the message sent. Attachments must be
+// uploaded by the sender and not yet be sent with another message.
+func (m *Session) resolveAttachments(message *Message) bool {
+
+	if len(message.Attachments) == 0 {
+		return true
+	}
+	if len(message.Attachments) > MAX_ATTACHMENTS {
+		return false
+	}
+
+	for _, id := range message.Attachments {
+		attachment, err := m.wsSrvr.attachmentDs.Get(id)
+		if err != nil {
+			logger.Error("Get attachment failed: " + err.Error())
+			return false
+		}
+		if attachment == nil ||
+			attachment.GetSubscriberName() != m.Subscriber.Name ||
+			attachment.GetMessageId() != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Link the attachments to the stored message. See Channel.storeMessage()
+func (m *Channel) attach(message *Message) {
+
+	attachmentDs := message.Session.wsSrvr.attachmentDs
+
+	for _, id := range message.Attachments {
+		err := attachmentDs.Attach(id, m.Name, message.Id.String())
+		if err != nil {
+			logger.Error("Attach failed: " + err.Error())
+		}
+	}
+}
+
+// Check if the subscriber may download the attachment. Uploaders always can,
+// others must have access to the channel it was sent to.
+func (m *Server) CanReadAttachment(attachment model.IAttachment, subscriberName string) (bool, error) {
+
+	if attachment.GetSubscriberName() == subscriberName {
+		return true, nil
+	}
+
+	chName := attachment.GetChannelName()
+	if chName == "" {
+		// Not sent yet
+		return false, nil
+	}
+
+	return m.canReadChannel(chName, subscriberName)
+}
@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"testing"
+	"yt/chat/server/chat/datasource"
+)
+
+// Add an uploaded attachment. See POST /attachments
+func addTestAttachment(t *testing.T, store *datasource.MemoryStore, id string, uploader string) {
+
+	t.Helper()
+
+	err := (&datasource.AttachmentMemory{Store: store}).Add(&datasource.Attachment{
+		Id:             id,
+		SubscriberName: uploader,
+		FileName:       id + ".png",
+		ContentType:    "image/png",
+		Size:           1,
+	})
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+}
+
+func TestSendAttachment(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	addTestAttachment(t, server.store, "picture", "alice")
+	addTestAttachment(t, server.store, "other", "bob")
+
+	send := func(client *testClient, text string, attachments ...string) *Message {
+		return client.request(&Message{
+			RequestType: REQ_SEND_MESSAGE,
+			ChannelName: "general",
+			Message:     text,
+			Attachments: attachments,
+		})
+	}
+
+	tests := []struct {
+		name        string
+		client      *testClient
+		attachments []string
+		status      string
+	}{
+		{"another's upload", alice, []string{"other"}, STATUS_FAILED},
+		{"unknown", alice, []string{"unknown"}, STATUS_FAILED},
+		{"own upload", alice, []string{"picture"}, STATUS_SUCCESS},
+		{"sent already", alice, []string{"picture"}, STATUS_FAILED},
+	}
+
+	messageId := ""
+	for _, tt := range tests {
+		ack := send(tt.client, tt.name, tt.attachments...)
+		if ack.Status != tt.status {
+			t.Fatalf("%s: %s (%s), want %s", tt.name, ack.Status, ack.Message, tt.status)
+		}
+		if ack.Status == STATUS_SUCCESS {
+			messageId = ack.MessageId
+		}
+	}
+
+	// Linked to the stored message, not the request
+	attachment, err := server.attachmentDs.Get("picture")
+	if err != nil || attachment == nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if attachment.GetMessageId() != messageId || attachment.GetChannelName() != "general" {
+		t.Errorf("attached to %s of %s, want %s of general",
+			attachment.GetMessageId(), attachment.GetChannelName(), messageId)
+	}
+
+	received := bob.expect(isChannelMessage("own upload"))
+	if len(received.Attachments) != 1 || received.Attachments[0] != "picture" {
+		t.Errorf("received attachments %v, want picture", received.Attachments)
+	}
+
+	ack := bob.request(&Message{RequestType: REQ_FETCH_HISTORY, ChannelName: "general"})
+	if len(ack.History) != 1 || len(ack.History[0].Attachments) != 1 {
+		t.Fatalf("history of %d messages, want one with an attachment", len(ack.History))
+	}
+
+	allowed, err := server.CanReadAttachment(attachment, "bob")
+	if err != nil || !allowed {
+		t.Errorf("channel member can not read the attachment: %v", err)
+	}
+}
+
+func TestSendAttachmentStoreFailed(t *testing.T) {
+
+	store := datasource.NewMemoryStore()
+	server := newTestServerWith(t, store, &failingMessageDS{&datasource.MessageMemory{Store: store}})
+	alice := server.connect(t, "alice")
+	alice.join("general")
+
+	addTestAttachment(t, store, "picture", "alice")
+
+	ack := alice.request(&Message{
+		RequestType: REQ_SEND_MESSAGE,
+		ChannelName: "general",
+		Attachments: []string{"picture"},
+	})
+	if ack.Status != STATUS_FAILED {
+		t.Fatalf("ack %s, want failed", ack.Status)
+	}
+
+	// May be sent again
+	attachment, err := server.attachmentDs.Get("picture")
+	if err != nil || attachment == nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if attachment.GetMessageId() != "" {
+		t.Errorf("attached to %s of a message not stored", attachment.GetMessageId())
+	}
+}
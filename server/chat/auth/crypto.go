@@ -1,11 +1,17 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"yt/chat/lib/utils/log"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+const SECURE_TOKEN_BYTES = 32
+
 func HashString(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
 	return string(bytes), err
@@ -19,3 +25,22 @@ func Validate(password, hash string) bool {
 	}
 	return true
 }
+
+// Random url safe token, e.g. for email links. Only the hash is stored.
+func NewSecureToken() (token string, hash string, err error) {
+
+	bytes := make([]byte, SECURE_TOKEN_BYTES)
+	if _, err = rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(bytes)
+	return token, HashToken(token), nil
+}
+
+// Lookup hash of a secure token. Tokens are random, so a fast hash will do.
+func HashToken(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,13 +7,36 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"yt/chat/lib/utils/log"
 	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
 )
 
 type ContextKey string
 
-const CONTEXT_KEY = ContextKey("subscriber")
+const (
+	CONTEXT_KEY       = ContextKey("subscriber")
+	CLAIM_CONTEXT_KEY = ContextKey("claim") // Token claim of registered subscribers
+)
+
+// Endpoints that do not require credentials
+var publicEndpoints = map[string]bool{
+	"/login":           true,
+	"/register":        true,
+	"/verify-email":    true,
+	"/forgot-password": true,
+	"/reset-password":  true,
+	"/token/refresh":   true,
+}
+
+// Registered subscribers. Anonymous requests may not use their names.
+var subscriberDs model.ISubscriberDS
+
+// Set the subscribers looked up by anonymous requests. No check if unset.
+func SetSubscriberDS(ds model.ISubscriberDS) {
+	subscriberDs = ds
+}
 
 // Auth middleware - verify token (if provided). Otherwise, username is
 // required for non-registered messaging?
@@ -22,15 +45,23 @@ func Authenticate(fn http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		ep := r.URL.Path
-		if ep == "/login" {
-			// Login precedes authentication. Ignore
+		if publicEndpoints[ep] {
+			// Login, and account requests precede authentication. Ignore
 			fn(w, r)
 			return
 		}
 
 		var token, name, email string
 
-		if r.Method == http.MethodPost {
+		bearer := getBearerToken(r)
+
+		if r.Method == http.MethodPost && (isMultipart(r) || len(bearer) > 0) {
+
+			// File uploads, or token in header. Credentials go in the query
+			// string, or header. The body is left for the handler.
+			token, name, email = getQueryCredentials(r)
+
+		} else if r.Method == http.MethodPost {
 
 			// User provided token acquired from prior login
 
@@ -55,23 +86,16 @@ func Authenticate(fn http.HandlerFunc) http.HandlerFunc {
 			// Non-registered subscriber messaging
 			log.GetLogger().Debug("Process request: " + r.URL.RawQuery)
 
-			s_token, tok := r.URL.Query()["jwt"]
-			s_name, nok := r.URL.Query()["name"]
-			s_email, eok := r.URL.Query()["email"]
-
-			if tok && len(s_token) == 1 {
-				token = s_token[0]
-			} else if nok && len(s_name) == 1 {
-				name = s_name[0]
-			}
-			if eok && len(s_email) == 1 {
-				email = s_email[0]
-			}
+			token, name, email = getQueryCredentials(r)
 
 		} else {
 			log.GetLogger().Warn("This is a different type of request")
 		}
 
+		if len(bearer) > 0 {
+			token = bearer
+		}
+
 		srcIp := r.RemoteAddr
 		userAgent := r.Header.Get("User-Agent")
 		var msg string = ""
@@ -79,12 +103,26 @@ func Authenticate(fn http.HandlerFunc) http.HandlerFunc {
 		if len(token) > 0 {
 
 			userClaim, err := ValidateToken(token)
+			if err == ErrTokenRevoked {
+				msg = fmt.Sprintf("Revoked token: (%s)[ip=%s;user-agent=%s,user=%s]",
+					ep, srcIp, userAgent, userClaim.GetName())
+				log.GetLogger().Warn("Forbidden request. Denied. " + msg)
+
+				// A leaked token. End the sessions it may have opened.
+				if ep == "/ws" {
+					notifyRevokedToken(userClaim)
+				}
+
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
 			if err != nil {
 				msg = fmt.Sprintf("Authenticated request: (%s)[ip=%s;user-agent=%s]",
 					ep, srcIp, userAgent)
 				log.GetLogger().Warn("Forbidden request. Denied. " + msg)
 
 				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
 			}
 
 			// Audit. No exceptions
@@ -99,11 +137,28 @@ func Authenticate(fn http.HandlerFunc) http.HandlerFunc {
 				Type: datasource.SUBSCRIBER_TYPE_LOGIN,
 			}
 			ctx := context.WithValue(r.Context(), CONTEXT_KEY, user)
+			ctx = context.WithValue(ctx, CLAIM_CONTEXT_KEY, userClaim)
 			// Call the endpoint handler
 			fn(w, r.WithContext(ctx))
 
 		} else if len(name) > 0 && len(email) > 0 {
 
+			// Names of registered subscribers require a token
+			registered, err := isRegisteredName(name)
+			if err != nil {
+				log.GetLogger().Error("Get subscriber failed: " + err.Error())
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+			if registered {
+				msg = fmt.Sprintf("Anonymous request with a registered name: (%s)[ip=%s;user-agent=%s,user=%s]",
+					ep, srcIp, userAgent, name)
+				log.GetLogger().Warn("Conflict. Denied. " + msg)
+
+				http.Error(w, "Name is registered. Please login", http.StatusConflict)
+				return
+			}
+
 			// Continue with request using anonymous user
 			anon := datasource.Subscriber{
 				Name:  name,
@@ -132,3 +187,52 @@ func Authenticate(fn http.HandlerFunc) http.HandlerFunc {
 		}
 	})
 }
+
+func isRegisteredName(name string) (bool, error) {
+
+	if subscriberDs == nil {
+		return false, nil
+	}
+
+	subs, err := subscriberDs.Get(&datasource.Subscriber{
+		Name: name,
+		Type: datasource.SUBSCRIBER_TYPE_LOGIN,
+	})
+	if err != nil {
+		return false, err
+	}
+	return subs != nil, nil
+}
+
+// Get token, or name and email of non-registered subscribers from the query string
+func getQueryCredentials(r *http.Request) (token string, name string, email string) {
+
+	s_token, tok := r.URL.Query()["jwt"]
+	s_name, nok := r.URL.Query()["name"]
+	s_email, eok := r.URL.Query()["email"]
+
+	if tok && len(s_token) == 1 {
+		token = s_token[0]
+	} else if nok && len(s_name) == 1 {
+		name = s_name[0]
+	}
+	if eok && len(s_email) == 1 {
+		email = s_email[0]
+	}
+
+	return token, name, email
+}
+
+// Get token from the 'Authorization: Bearer <token>' header
+func getBearerToken(r *http.Request) string {
+
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func isMultipart(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
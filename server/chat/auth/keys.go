@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"yt/chat/lib/config"
+	"yt/chat/lib/utils/log"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	DEFAULT_SECRET_KID = "default"
+
+	// Key files in JWT_KEY_DIR. File name is the key id (kid).
+	//  <kid>.pem - RSA (RS256), or EC P-256 (ES256) private key. A public
+	//              key verifies only, e.g. a key being rotated out.
+	//  <kid>.key - HMAC (HS256) secret
+	KEY_FILE_PEM    = ".pem"
+	KEY_FILE_SECRET = ".key"
+)
+
+var ErrNoSigningKey = errors.New("no signing key")
+
+type SigningKey struct {
+	Id        string // kid
+	Method    jwt.SigningMethod
+	signKey   interface{} // Nil if the key verifies only
+	verifyKey interface{}
+}
+
+func (m *SigningKey) CanSign() bool {
+	return m.signKey != nil
+}
+
+// Active keys by kid. New tokens are signed with the signing key.
+type KeySet struct {
+	keys       map[string]*SigningKey
+	signingKid string
+}
+
+var keySet = &KeySet{keys: map[string]*SigningKey{}}
+
+// Load signing keys from dotenv config, and key files. Call once at startup.
+//
+// Config: JWT_KEY_DIR (key files), JWT_SECRET (HS256 secret), JWT_SECRET_KID,
+// JWT_SIGNING_KID (kid of new tokens)
+func LoadKeys() error {
+
+	keys := &KeySet{keys: map[string]*SigningKey{}}
+
+	if secret := config.GetValue("JWT_SECRET"); secret != "" {
+		kid := config.GetValue("JWT_SECRET_KID")
+		if kid == "" {
+			kid = DEFAULT_SECRET_KID
+		}
+		keys.add(newSecretKey(kid, []byte(secret)))
+	}
+
+	if dir := config.GetValue("JWT_KEY_DIR"); dir != "" {
+		if err := keys.loadDir(dir); err != nil {
+			return err
+		}
+	}
+
+	if len(keys.keys) == 0 {
+		if config.GetValue("ENV") != "development" {
+			return errors.New("no JWT signing keys. Set JWT_SECRET, or JWT_KEY_DIR")
+		}
+		// Development only. Tokens are invalid after restart.
+		log.GetLogger().Warn("No JWT signing keys. Using a temporary key.")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		keys.add(newSecretKey(DEFAULT_SECRET_KID, secret))
+	}
+
+	if err := keys.setSigningKid(config.GetValue("JWT_SIGNING_KID")); err != nil {
+		return err
+	}
+
+	keySet = keys
+	log.GetLogger().Info(fmt.Sprintf("Loaded %d JWT key(s). Signing key: %s",
+		len(keys.keys), keys.signingKid))
+
+	return nil
+}
+
+func newSecretKey(kid string, secret []byte) *SigningKey {
+	return &SigningKey{
+		Id:        kid,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func (m *KeySet) add(key *SigningKey) {
+	m.keys[key.Id] = key
+}
+
+func (m *KeySet) loadDir(dir string) error {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+
+		if entry.IsDir() {
+			continue
+		}
+
+		fileName := entry.Name()
+		ext := filepath.Ext(fileName)
+		kid := strings.TrimSuffix(fileName, ext)
+
+		if ext != KEY_FILE_PEM && ext != KEY_FILE_SECRET {
+			continue
+		}
+		if _, ok := m.keys[kid]; ok {
+			return fmt.Errorf("duplicate JWT key id: %s", kid)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			return err
+		}
+
+		if ext == KEY_FILE_SECRET {
+			secret := []byte(strings.TrimSpace(string(data)))
+			if len(secret) == 0 {
+				return fmt.Errorf("empty JWT secret: %s", fileName)
+			}
+			m.add(newSecretKey(kid, secret))
+			continue
+		}
+
+		key, err := parsePemKey(kid, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		m.add(key)
+	}
+
+	return nil
+}
+
+// Parse a private, or public RSA, or EC P-256 key
+func parsePemKey(kid string, data []byte) (*SigningKey, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM key")
+	}
+
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported PEM type: " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{Id: kid}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodES256, k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodES256, k
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+
+	// ES256 is P-256 only
+	if ecKey, ok := key.verifyKey.(*ecdsa.PublicKey); ok && ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("unsupported EC curve: " + ecKey.Curve.Params().Name)
+	}
+
+	return key, nil
+}
+
+// Select the key of new tokens. Defaults to the only key that can sign.
+func (m *KeySet) setSigningKid(kid string) error {
+
+	if kid == "" {
+		for _, key := range m.keys {
+			if !key.CanSign() {
+				continue
+			}
+			if kid != "" {
+				return errors.New("multiple JWT signing keys. Set JWT_SIGNING_KID")
+			}
+			kid = key.Id
+		}
+	}
+
+	key, ok := m.keys[kid]
+	if !ok || !key.CanSign() {
+		return fmt.Errorf("%w: %s", ErrNoSigningKey, kid)
+	}
+
+	m.signingKid = kid
+	return nil
+}
+
+func (m *KeySet) signingKey() (*SigningKey, error) {
+
+	key, ok := m.keys[m.signingKid]
+	if !ok {
+		return nil, ErrNoSigningKey
+	}
+	return key, nil
+}
+
+// Key of a token, by the kid header. The algorithm must match the key.
+func (m *KeySet) verifyKey(token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("error signing: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"` // RSA
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"` // EC
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Public keys of the asymmetric keys. HMAC secrets are never published.
+func GetJWKS() *JWKS {
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	jwks := &JWKS{Keys: []JWK{}}
+
+	for _, key := range keySet.keys {
+
+		jwk := JWK{Kid: key.Id, Use: "sig", Alg: key.Method.Alg()}
+
+		switch k := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encode(k.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(k.E)).Bytes())
+		case *ecdsa.PublicKey:
+			// Coordinates are fixed size. 32 bytes for P-256.
+			size := (k.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = k.Curve.Params().Name
+			jwk.X = encode(k.X.FillBytes(make([]byte, size)))
+			jwk.Y = encode(k.Y.FillBytes(make([]byte, size)))
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
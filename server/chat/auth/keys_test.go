@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func encodePem(t *testing.T, blockType string, der []byte, err error) []byte {
+
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Encode %s failed: %v", blockType, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParsePemKey(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecDer, ecErr := x509.MarshalECPrivateKey(ecKey)
+	p384Der, p384Err := x509.MarshalECPrivateKey(p384Key)
+	pkcs8Der, pkcs8Err := x509.MarshalPKCS8PrivateKey(ecKey)
+	rsaPubDer, rsaPubErr := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	ecPubDer, ecPubErr := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantMethod jwt.SigningMethod
+		wantSign   bool
+		wantErr    bool
+	}{
+		{"RSA private", encodePem(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), nil),
+			jwt.SigningMethodRS256, true, false},
+		{"EC private", encodePem(t, "EC PRIVATE KEY", ecDer, ecErr),
+			jwt.SigningMethodES256, true, false},
+		{"PKCS8 private", encodePem(t, "PRIVATE KEY", pkcs8Der, pkcs8Err),
+			jwt.SigningMethodES256, true, false},
+		{"RSA public", encodePem(t, "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), nil),
+			jwt.SigningMethodRS256, false, false},
+		{"PKIX RSA public", encodePem(t, "PUBLIC KEY", rsaPubDer, rsaPubErr),
+			jwt.SigningMethodRS256, false, false},
+		{"PKIX EC public", encodePem(t, "PUBLIC KEY", ecPubDer, ecPubErr),
+			jwt.SigningMethodES256, false, false},
+		{"EC P-384", encodePem(t, "EC PRIVATE KEY", p384Der, p384Err), nil, false, true},
+		{"unsupported type", encodePem(t, "CERTIFICATE", []byte{1}, nil), nil, false, true},
+		{"corrupt key", encodePem(t, "RSA PRIVATE KEY", []byte{1, 2, 3}, nil), nil, false, true},
+		{"not PEM", []byte("secret"), nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parsePemKey("kid", tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePemKey() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePemKey() failed: %v", err)
+			}
+			if key.Id != "kid" || key.Method != tt.wantMethod || key.CanSign() != tt.wantSign {
+				t.Errorf("key %s, %s, can sign %v, want kid, %s, %v",
+					key.Id, key.Method.Alg(), key.CanSign(), tt.wantMethod.Alg(), tt.wantSign)
+			}
+		})
+	}
+}
+
+func TestSetSigningKid(t *testing.T) {
+
+	public := &SigningKey{Id: "public", Method: jwt.SigningMethodRS256, verifyKey: &rsa.PublicKey{}}
+
+	newKeySet := func(keys ...*SigningKey) *KeySet {
+		set := &KeySet{keys: map[string]*SigningKey{}}
+		for _, key := range keys {
+			set.add(key)
+		}
+		return set
+	}
+
+	tests := []struct {
+		name    string
+		keys    *KeySet
+		kid     string
+		want    string
+		wantErr bool
+		noKey   bool // Error is ErrNoSigningKey
+	}{
+		{"only signing key", newKeySet(newSecretKey("a", []byte("s")), public), "", "a", false, false},
+		{"configured kid", newKeySet(newSecretKey("a", []byte("s")), newSecretKey("b", []byte("s"))), "b", "b", false, false},
+		{"ambiguous", newKeySet(newSecretKey("a", []byte("s")), newSecretKey("b", []byte("s"))), "", "", true, false},
+		{"public key can not sign", newKeySet(newSecretKey("a", []byte("s")), public), "public", "", true, true},
+		{"unknown kid", newKeySet(newSecretKey("a", []byte("s"))), "c", "", true, true},
+		{"no keys", newKeySet(), "", "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.keys.setSigningKid(tt.kid)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("setSigningKid(%q) succeeded, want error", tt.kid)
+				}
+				if tt.noKey && !errors.Is(err, ErrNoSigningKey) {
+					t.Errorf("setSigningKid(%q) = %v, want %v", tt.kid, err, ErrNoSigningKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setSigningKid(%q) failed: %v", tt.kid, err)
+			}
+			if tt.keys.signingKid != tt.want {
+				t.Errorf("signing kid = %q, want %q", tt.keys.signingKid, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyKey(t *testing.T) {
+
+	secret := []byte("secret")
+	keys := &KeySet{keys: map[string]*SigningKey{}}
+	keys.add(newSecretKey("hs", secret))
+	keys.add(&SigningKey{Id: "rs", Method: jwt.SigningMethodRS256, verifyKey: &rsa.PublicKey{}})
+
+	tests := []struct {
+		name    string
+		method  jwt.SigningMethod
+		kid     interface{}
+		wantErr bool
+	}{
+		{"matching key", jwt.SigningMethodHS256, "hs", false},
+		{"algorithm of another key", jwt.SigningMethodHS256, "rs", true},
+		{"unknown kid", jwt.SigningMethodHS256, "none", true},
+		{"no kid", jwt.SigningMethodHS256, nil, true},
+		{"kid not a string", jwt.SigningMethodHS256, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.New(tt.method)
+			if tt.kid != nil {
+				token.Header["kid"] = tt.kid
+			}
+
+			key, err := keys.verifyKey(token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("verifyKey() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyKey() failed: %v", err)
+			}
+			if string(key.([]byte)) != string(secret) {
+				t.Errorf("verifyKey() = %v, want the secret", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys:
+//
+//	token:revoked:<jti> - revoked access token. Expires with the token.
+const REVOKED_TOKEN_KEY = "token:revoked:"
+
+type IRevocationList interface {
+	Revoke(tokenId string, expiresAt time.Time) error
+	IsRevoked(tokenId string) (bool, error)
+}
+
+// Revoked access tokens, shared by all servers
+type RedisRevocationList struct {
+	IRevocationList
+	Rds *redis.Client
+}
+
+func NewRedisRevocationList(rds *redis.Client) *RedisRevocationList {
+	return &RedisRevocationList{Rds: rds}
+}
+
+func (m *RedisRevocationList) Revoke(tokenId string, expiresAt time.Time) error {
+
+	// Kept until the token expires
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return m.Rds.Set(context.Background(), REVOKED_TOKEN_KEY+tokenId, 1, ttl).Err()
+}
+
+func (m *RedisRevocationList) IsRevoked(tokenId string) (bool, error) {
+
+	count, err := m.Rds.Exists(context.Background(), REVOKED_TOKEN_KEY+tokenId).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Revoked access tokens of a single server, kept in process
+type MemoryRevocationList struct {
+	IRevocationList
+	mu      sync.Mutex
+	revoked map[string]time.Time // Expiry by token id
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{revoked: make(map[string]time.Time)}
+}
+
+func (m *MemoryRevocationList) Revoke(tokenId string, expiresAt time.Time) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Forget expired tokens
+	now := time.Now()
+	for id, expires := range m.revoked {
+		if now.After(expires) {
+			delete(m.revoked, id)
+		}
+	}
+
+	if expiresAt.After(now) {
+		m.revoked[tokenId] = expiresAt
+	}
+	return nil
+}
+
+func (m *MemoryRevocationList) IsRevoked(tokenId string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires, ok := m.revoked[tokenId]
+	return ok && time.Now().Before(expires), nil
+}
+
+var revocationList IRevocationList
+
+var revokedTokenListeners []func(claim *TokenClaim)
+
+// Set the revocation list consulted by ValidateToken. No revocation if unset.
+func SetRevocationList(list IRevocationList) {
+	revocationList = list
+}
+
+func RevokeToken(claim *TokenClaim) error {
+
+	if revocationList == nil || claim.GetTokenId() == "" {
+		return ErrTokenNotRevocable
+	}
+	return revocationList.Revoke(claim.GetTokenId(), time.Unix(claim.GetExpiresAt(), 0))
+}
+
+// Listen for revoked tokens used on a websocket connect request
+func OnRevokedToken(listener func(claim *TokenClaim)) {
+	revokedTokenListeners = append(revokedTokenListeners, listener)
+}
+
+func notifyRevokedToken(claim *TokenClaim) {
+	for _, listener := range revokedTokenListeners {
+		listener(claim)
+	}
+}
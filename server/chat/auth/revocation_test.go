@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocationList(t *testing.T) {
+
+	list := NewMemoryRevocationList()
+
+	tests := []struct {
+		name    string
+		expires time.Duration
+		want    bool
+	}{
+		{"revoked", time.Hour, true},
+		{"expired already", -time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := list.Revoke(tt.name, time.Now().Add(tt.expires)); err != nil {
+				t.Fatalf("Revoke() failed: %v", err)
+			}
+			if revoked, _ := list.IsRevoked(tt.name); revoked != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", revoked, tt.want)
+			}
+		})
+	}
+
+	if revoked, _ := list.IsRevoked("unknown"); revoked {
+		t.Error("unknown token revoked")
+	}
+
+	// Forgotten once expired
+	list.revoked["revoked"] = time.Now().Add(-time.Second)
+	if revoked, _ := list.IsRevoked("revoked"); revoked {
+		t.Error("expired token still revoked")
+	}
+	list.Revoke("other", time.Now().Add(time.Hour))
+	if _, ok := list.revoked["revoked"]; ok {
+		t.Error("expired token kept")
+	}
+}
@@ -1,20 +1,26 @@
 package auth
 
 import (
-	"fmt"
+	"errors"
 	"time"
 	"yt/chat/server/chat/datasource"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
-const HMAC_SECRET = ")sd*fIske2^se(f_@E&qw=_-"
 const EXPIRE_TIME_SECS = 3600 // seconds. 1 hour
 
+var (
+	ErrTokenRevoked      = errors.New("token revoked")
+	ErrTokenNotRevocable = errors.New("token can not be revoked")
+)
+
 type TokenMeta struct {
-	AccessToken string // The signed access-token
-	TTL         int    // Time in seconds from creation
-	ExpiresAt   int64  // Timestamp in seconds of expiration
+	AccessToken  string // The signed access-token
+	TTL          int    // Time in seconds from creation
+	ExpiresAt    int64  // Timestamp in seconds of expiration
+	RefreshToken string `json:",omitempty"` // Single use. See /token/refresh
 }
 
 type TokenClaim struct {
@@ -31,20 +37,42 @@ func (m *TokenClaim) GetName() string {
 	return m.Name
 }
 
+// Unique id of the token. See RevokeToken()
+func (m *TokenClaim) GetTokenId() string {
+	return m.StandardClaims.Id
+}
+
+func (m *TokenClaim) GetExpiresAt() int64 {
+	return m.StandardClaims.ExpiresAt
+}
+
 // Create fresh token for a specified subscriber
 func NewToken(user *datasource.Subscriber) (*TokenMeta, error) {
 
-	expiresAt := time.Now().Unix() + EXPIRE_TIME_SECS
+	key, err := keySet.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	expiresAt := now + EXPIRE_TIME_SECS
+
 	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"Id":        user.GetId(),
-			"Name":      user.GetName(),
-			"ExpiresAt": expiresAt,
+		key.Method,
+		&TokenClaim{
+			StandardClaims: jwt.StandardClaims{
+				Id:        uuid.New().String(),
+				IssuedAt:  now,
+				ExpiresAt: expiresAt,
+			},
+			ID:   user.GetId(),
+			Name: user.GetName(),
 		},
 	)
+	// Verifiers select the key by id
+	token.Header["kid"] = key.Id
 
-	signed, err := token.SignedString([]byte(HMAC_SECRET))
+	signed, err := token.SignedString(key.signKey)
 	if err != nil {
 		return nil, err
 	}
@@ -59,23 +87,33 @@ func NewToken(user *datasource.Subscriber) (*TokenMeta, error) {
 
 }
 
-func validateKey(token *jwt.Token) (interface{}, error) {
+func ValidateToken(signed string) (*TokenClaim, error) {
 
-	_, ok := token.Method.(*jwt.SigningMethodHMAC)
-	if !ok {
-		return nil, fmt.Errorf("error signing: %v", token.Header["alg"])
+	parsed, err := jwt.ParseWithClaims(signed, &TokenClaim{}, keySet.verifyKey)
+	if err != nil {
+		return nil, err
 	}
 
-	return []byte(HMAC_SECRET), nil
-}
+	subs, ok := parsed.Claims.(*TokenClaim)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("invalid token")
+	}
 
-func ValidateToken(signed string) (*TokenClaim, error) {
+	// Expiry is checked only if set. Tokens must expire.
+	if subs.GetExpiresAt() == 0 {
+		return nil, errors.New("token has no expiry")
+	}
 
-	parsed, err := jwt.ParseWithClaims(signed, &TokenClaim{}, validateKey)
-	subs, ok := parsed.Claims.(*TokenClaim)
-	if ok && parsed.Valid {
-		return subs, nil
+	if revocationList != nil && subs.GetTokenId() != "" {
+		revoked, err := revocationList.IsRevoked(subs.GetTokenId())
+		if err != nil {
+			// Fail closed
+			return nil, err
+		}
+		if revoked {
+			return subs, ErrTokenRevoked
+		}
 	}
 
-	return nil, err
+	return subs, nil
 }
@@ -2,17 +2,33 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"yt/chat/lib/transport"
 	"yt/chat/lib/workermanager"
+	"yt/chat/server/chat/datasource"
 	"yt/chat/server/chat/model"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 )
 
 const WELCOME_MESSAGE_FORMAT = "%s joined."
 
+// Private channels between two subscribers are named "dm:<name1>:<name2>"
+const PRIVATE_CHANNEL_PREFIX = "dm:"
+
+var (
+	ErrNotChannelMember    = errors.New("not a member of the channel")
+	ErrBannedFromChannel   = errors.New("banned from the channel")
+	ErrAnonymousSubscriber = errors.New("not allowed for anonymous subscribers")
+	ErrChannelNotPrivate   = errors.New("channel is not private")
+)
+
 type Channel struct {
 	model.IChannel
 	Id      uuid.UUID `json:"id"`
@@ -24,19 +40,31 @@ type Channel struct {
 	registerSession   chan *Session
 	unregisterSession chan *Session
 	broadcast         chan *Message
-	rds               *redis.Client
+	moderate          chan *Message
+	typing            chan *Message
+	state             IState
+	transport         transport.ITransport
+	messageDs         model.IMessageDS
+	memberDs          model.IChannelMemberDS
 	ctx               context.Context
 	ctxCancel         context.CancelFunc
 	stopping          bool
 	stopped           bool
+
+	typingSessions map[*Session]time.Time // Typing state expiry by session
 }
 
 // Get existing channel - if previously  created. Otherwise, create one.
+// The creator, if any, becomes owner of a new channel.
 func NewChannel(
-	rds *redis.Client,
+	state IState,
+	transport transport.ITransport,
 	channelDs model.IChannelDS,
+	messageDs model.IMessageDS,
+	memberDs model.IChannelMemberDS,
 	name string,
 	private bool,
+	creator string,
 ) (*Channel, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -49,7 +77,13 @@ func NewChannel(
 		registerSession:   make(chan *Session),
 		unregisterSession: make(chan *Session),
 		broadcast:         make(chan *Message),
-		rds:               rds,
+		moderate:          make(chan *Message),
+		typing:            make(chan *Message),
+		typingSessions:    make(map[*Session]time.Time),
+		state:             state,
+		transport:         transport,
+		messageDs:         messageDs,
+		memberDs:          memberDs,
 		ctx:               ctx,
 		ctxCancel:         cancel,
 		stopping:          false,
@@ -72,6 +106,24 @@ func NewChannel(
 			logger.Error("Add channel to repo failed: " + err.Error())
 			return nil, err
 		}
+		if creator != "" {
+			err = memberDs.Add(&datasource.ChannelMember{
+				ChannelName:    name,
+				SubscriberName: creator,
+				Status:         datasource.MEMBER_STATUS_JOINED,
+				Role:           datasource.MEMBER_ROLE_OWNER,
+			})
+			if err != nil {
+				logger.Error("Add channel owner failed: " + err.Error())
+				return nil, err
+			}
+		}
+	}
+
+	err = channel.initSeq()
+	if err != nil {
+		logger.Error("Init channel sequence failed: " + err.Error())
+		return nil, err
 	}
 
 	channel.Start()
@@ -96,6 +148,8 @@ func (m *Channel) stop() {
 	close(m.registerSession)
 	close(m.unregisterSession)
 	close(m.broadcast)
+	close(m.moderate)
+	close(m.typing)
 
 	logger.Trace(fmt.Sprintf("Num. sessions left on shutdown: %d", len(m.sessions)))
 	m.stopped = true
@@ -119,44 +173,33 @@ func (m *Channel) Start() {
 		// Subscribe to channel
 		//
 
-		pubsub := m.rds.Subscribe(ctx, m.Name)
-		defer pubsub.Close()
-
-		logger.Debug("Setup pubsub service")
-
-		_, err := pubsub.Receive(ctx) // Wait until active
+		sub, err := m.transport.Subscribe(ctx, m.Name)
 		if err != nil {
-			logger.Error("Start channel error. Pubsub service error: " + err.Error())
+			logger.Error("Start channel error. Transport service error: " + err.Error())
 			return
 		}
 
-		logger.Trace("Setup pubsub channels")
-
-		ch := pubsub.Channel()
 		done <- struct{}{} // Ready. Unblock parent.
 
 		// Broadcast new subscriber to members of channel
 		//
 		logger.Trace("Monitor channel messages to other members in the channel")
 
+		ch := sub.Messages()
 		terminate := false
 		for !terminate {
 			select {
 			case <-m.ctx.Done():
 				logger.Debug("Received a shutdown request. Winding down.")
-				err := pubsub.Unsubscribe(ctx)
+				err := sub.Unsubscribe()
 				if err != nil {
-					logger.Error("Unsubscribe pubsub failed: " + err.Error())
+					logger.Error("Unsubscribe failed: " + err.Error())
 				}
 				terminate = true
-			case msg, ok := <-ch:
+			case payload, ok := <-ch:
 				if ok {
-					logger.Debug("Got a pubsub message: " + msg.Payload)
-					for sess := range m.sessions {
-						// Do not broadcast back to sender
-						logger.Debug("Send message to session: " + sess.Subscriber.Name)
-						sess.Msg <- []byte(msg.Payload)
-					}
+					logger.Debug("Got a channel message: " + string(payload))
+					m.dispatch(string(payload))
 				}
 			}
 		}
@@ -172,6 +215,10 @@ func (m *Channel) Start() {
 
 		logger.Trace("Listening to channel requests...")
 
+		// Expire typing subscribers that stopped refreshing
+		ticker := time.NewTicker(TYPING_CHECK_INTERVAL)
+		defer ticker.Stop()
+
 		// Polling for requests. Process by request type
 		terminate := false
 
@@ -198,7 +245,7 @@ func (m *Channel) Start() {
 
 						logger.Debug("Send message: " + string(*encoded))
 
-						err := m.rds.Publish(ctx, m.GetName(), *encoded).Err()
+						err := m.publish(ctx, *encoded)
 						if err != nil {
 							logger.Error(err.Error())
 							terminate = true
@@ -212,6 +259,7 @@ func (m *Channel) Start() {
 			case session := <-m.unregisterSession:
 				// Session leaves channel
 				delete(m.sessions, session)
+				m.stopTyping(session)
 				logger.Trace(
 					fmt.Sprintf(
 						"Unregister session. sessions: %d, stopping: %s",
@@ -219,14 +267,43 @@ func (m *Channel) Start() {
 						strconv.FormatBool(m.stopping),
 					),
 				)
+			// Typing indicator
+			case message, ok := <-m.typing:
+				if ok {
+					m.typingRequest(message)
+				}
+			case <-ticker.C:
+				m.expireTyping()
+			// Moderation request
+			case message, ok := <-m.moderate:
+				if ok {
+					m.moderateRequest(message)
+				}
 			// Send request
 			case message, ok := <-m.broadcast:
 				if ok {
+					if err := m.stamp(message); err != nil {
+						logger.Error("Stamp message failed: " + err.Error())
+					}
+					// Keep channel messages for subscribers joining later.
+					// Sub typed messages are updates of stored messages.
+					if message.RequestType == REQ_SEND_MESSAGE && message.RequestSubType == "" {
+						if !m.storeMessage(message) {
+							// Not broadcast. The sender was told it failed.
+							continue
+						}
+					} else if err := m.keepSeq(message); err != nil {
+						logger.Error("Keep sequence failed: " + err.Error())
+					}
 					encoded, err := message.Encode()
 					if err != nil {
 						logger.Warn(err.Error())
 					} else {
-						err := m.rds.Publish(ctx, m.GetName(), *encoded).Err()
+						// Replayed to resuming sessions
+						if err := m.saveToWindow(message, *encoded); err != nil {
+							logger.Error("Save to channel window failed: " + err.Error())
+						}
+						err := m.publish(ctx, *encoded)
 						if err != nil {
 							logger.Error(err.Error())
 							terminate = true
@@ -246,6 +323,83 @@ func (m *Channel) Start() {
 
 }
 
+// Store a sent message, and acknowledge it to the sender. Stored messages
+// get a server id; ids sent by clients are neither unique, nor trusted. The
+// ack keeps the request id, with the stored id in MessageId. Returns false
+// if the message was not stored.
+func (m *Channel) storeMessage(message *Message) bool {
+
+	requestId := message.Id
+	message.Id = uuid.New()
+
+	err := m.messageDs.Add(message.toRecord())
+	if err == nil {
+		m.attach(message)
+	}
+
+	ack := *message
+	ack.Id = requestId
+	ack.MessageType = MSGTYPE_ACK
+	ack.MessageId = message.Id.String()
+	ack.Status = STATUS_SUCCESS
+	if err != nil {
+		logger.Error("Store message failed: " + err.Error())
+		ack.MessageId = ""
+		ack.Message = "Can not send the message"
+		ack.Status = STATUS_FAILED
+	}
+	message.Session.send(&ack)
+
+	if message.stored != nil {
+		message.stored <- err == nil
+	}
+
+	return err == nil
+}
+
+// Send a channel message to the local sessions
+func (m *Channel) dispatch(payload string) {
+
+	var message Message
+	err := message.Decode(&payload)
+	if err != nil {
+		logger.Error("Decoding failed: " + err.Error())
+		return
+	}
+
+	for sess := range m.sessions {
+		// Senders get their messages back, as the channel order, but not
+		// their own typing events
+		if isEphemeral(&message) && isSender(sess, &message) {
+			continue
+		}
+		logger.Debug("Send message to session: " + sess.Subscriber.Name)
+		if isEphemeral(&message) {
+			// Rather drop than wait for slow sessions, with a full queue
+			select {
+			case sess.Msg <- []byte(payload):
+			default:
+				logger.Trace("Dropped message for session: " + sess.Subscriber.Name)
+			}
+		} else {
+			sess.Msg <- []byte(payload)
+		}
+	}
+	// Kicked, or banned sessions leave the channel
+	m.kickSessions(&message)
+}
+
+// Send a message to all servers of the channel
+func (m *Channel) publish(ctx context.Context, payload []byte) error {
+	return m.transport.Publish(ctx, m.Name, payload)
+}
+
+// Send a message to the servers listening in the channel now, e.g. typing,
+// and moderation events. Not replayed by the streams transport.
+func (m *Channel) publishEphemeral(ctx context.Context, payload []byte) error {
+	return m.transport.PublishEphemeral(ctx, m.Name, payload)
+}
+
 func (m *Channel) GetId() string {
 	return m.Id.String()
 }
@@ -257,3 +411,17 @@ func (m *Channel) GetName() string {
 func (m *Channel) IsPrivate() bool {
 	return m.Private
 }
+
+// Deterministic private channel name for a pair of subscribers.
+// Names are escaped so the separator can not appear in either name.
+func privateChannelName(subscriber1 string, subscriber2 string) string {
+
+	names := []string{url.QueryEscape(subscriber1), url.QueryEscape(subscriber2)}
+	sort.Strings(names)
+
+	return PRIVATE_CHANNEL_PREFIX + strings.Join(names, ":")
+}
+
+func isPrivateChannelName(channelName string) bool {
+	return strings.HasPrefix(channelName, PRIVATE_CHANNEL_PREFIX)
+}
@@ -0,0 +1,29 @@
+package chat
+
+import "testing"
+
+func TestPrivateChannelName(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		subscriber1 string
+		subscriber2 string
+		want        string
+	}{
+		{"sorted", "alice", "bob", "dm:alice:bob"},
+		{"order independent", "bob", "alice", "dm:alice:bob"},
+		{"same subscriber", "alice", "alice", "dm:alice:alice"},
+		{"separator escaped", "a:b", "c", "dm:a%3Ab:c"},
+		{"no collision", "a", "b:c", "dm:a:b%3Ac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := privateChannelName(tt.subscriber1, tt.subscriber2)
+			if got != tt.want {
+				t.Errorf("privateChannelName(%q, %q) = %q, want %q",
+					tt.subscriber1, tt.subscriber2, got, tt.want)
+			}
+		})
+	}
+}
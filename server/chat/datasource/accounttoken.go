@@ -0,0 +1,160 @@
+package datasource
+
+import (
+	"database/sql"
+	"time"
+	"yt/chat/server/chat/model"
+)
+
+const (
+	// Account token purposes
+	TOKEN_PURPOSE_VERIFY_EMAIL   = "verify_email"
+	TOKEN_PURPOSE_RESET_PASSWORD = "reset_password"
+	TOKEN_PURPOSE_REFRESH        = "refresh"
+)
+
+type AccountToken struct {
+	model.IAccountToken
+	SubscriberName string
+	Purpose        string
+	TokenHash      string // See auth.HashToken(). The token is never stored.
+	Expires        time.Time
+}
+
+func (m *AccountToken) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *AccountToken) GetPurpose() string {
+	return m.Purpose
+}
+
+func (m *AccountToken) GetTokenHash() string {
+	return m.TokenHash
+}
+
+func (m *AccountToken) GetExpires() time.Time {
+	return m.Expires
+}
+
+type AccountTokenPgsql struct {
+	model.IAccountTokenDS
+	DbConn *sql.DB
+}
+
+func (m *AccountTokenPgsql) Add(token model.IAccountToken) error {
+
+	sqlStmt := `INSERT INTO account_token(subscriber, purpose, token_hash, expires)
+		VALUES($1, $2, $3, $4)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		token.GetSubscriberName(),
+		token.GetPurpose(),
+		token.GetTokenHash(),
+		token.GetExpires().UTC(),
+	)
+
+	return err
+}
+
+// Take an unused, unexpired token of the purpose, and mark it used. Nil if none.
+func (m *AccountTokenPgsql) Take(tokenHash string, purpose string) (model.IAccountToken, error) {
+
+	// Single statement. Concurrent requests with the same token can not both succeed.
+	sqlStmt := `UPDATE account_token SET used = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used IS NULL AND expires > $3
+		RETURNING subscriber, purpose, token_hash, expires`
+
+	token := &AccountToken{}
+	row := m.DbConn.QueryRow(sqlStmt, tokenHash, purpose, time.Now().UTC())
+
+	err := row.Scan(&token.SubscriberName, &token.Purpose, &token.TokenHash, &token.Expires)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Delete all tokens of the subscriber of the purpose
+func (m *AccountTokenPgsql) DeleteAll(subscriberName string, purpose string) error {
+
+	sqlStmt := `DELETE FROM account_token WHERE subscriber = $1 AND purpose = $2`
+
+	_, err := m.DbConn.Exec(sqlStmt, subscriberName, purpose)
+
+	return err
+}
+
+type AccountTokenSqlite struct {
+	model.IAccountTokenDS
+	DbConn *sql.DB
+}
+
+func (m *AccountTokenSqlite) Add(token model.IAccountToken) error {
+
+	sqlStmt := `INSERT INTO account_token(subscriber, purpose, token_hash, expires)
+		VALUES(?, ?, ?, ?)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		token.GetSubscriberName(),
+		token.GetPurpose(),
+		token.GetTokenHash(),
+		token.GetExpires().UTC(),
+	)
+
+	return err
+}
+
+// Take an unused, unexpired token of the purpose, and mark it used. Nil if none.
+func (m *AccountTokenSqlite) Take(tokenHash string, purpose string) (model.IAccountToken, error) {
+
+	// Single statement. Concurrent requests with the same token can not both succeed.
+	sqlStmt := `UPDATE account_token SET used = ?
+		WHERE token_hash = ? AND purpose = ? AND used IS NULL AND expires > ?
+		RETURNING subscriber, purpose, token_hash, expires`
+
+	now := time.Now().UTC()
+
+	token := &AccountToken{}
+	row := m.DbConn.QueryRow(sqlStmt, now, tokenHash, purpose, now)
+
+	err := row.Scan(&token.SubscriberName, &token.Purpose, &token.TokenHash, &token.Expires)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Delete all tokens of the subscriber of the purpose
+func (m *AccountTokenSqlite) DeleteAll(subscriberName string, purpose string) error {
+
+	sqlStmt := `DELETE FROM account_token WHERE subscriber = ? AND purpose = ?`
+
+	_, err := m.DbConn.Exec(sqlStmt, subscriberName, purpose)
+
+	return err
+}
@@ -0,0 +1,179 @@
+package datasource
+
+import (
+	"database/sql"
+	"time"
+	"yt/chat/server/chat/model"
+)
+
+type Attachment struct {
+	model.IAttachment
+	Id             string
+	SubscriberName string // Uploader
+	FileName       string
+	ContentType    string
+	Size           int64
+	ChannelName    string // Channel, and message it is attached to. Empty until sent.
+	MessageId      string
+}
+
+func (m *Attachment) GetId() string {
+	return m.Id
+}
+
+func (m *Attachment) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *Attachment) GetFileName() string {
+	return m.FileName
+}
+
+func (m *Attachment) GetContentType() string {
+	return m.ContentType
+}
+
+func (m *Attachment) GetSize() int64 {
+	return m.Size
+}
+
+func (m *Attachment) GetChannelName() string {
+	return m.ChannelName
+}
+
+func (m *Attachment) GetMessageId() string {
+	return m.MessageId
+}
+
+type AttachmentPgsql struct {
+	model.IAttachmentDS
+	DbConn *sql.DB
+}
+
+func (m *AttachmentPgsql) Add(attachment model.IAttachment) error {
+
+	sqlStmt := `INSERT INTO attachment(id, subscriber, filename, content_type, size)
+		VALUES($1, $2, $3, $4, $5)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		attachment.GetId(),
+		attachment.GetSubscriberName(),
+		attachment.GetFileName(),
+		attachment.GetContentType(),
+		attachment.GetSize(),
+	)
+
+	return err
+}
+
+func (m *AttachmentPgsql) Get(id string) (model.IAttachment, error) {
+
+	sqlStmt := `SELECT id, subscriber, filename, content_type, size,
+		COALESCE(channel, ''), COALESCE(message_id::text, '')
+		FROM attachment WHERE id = $1 LIMIT 1`
+
+	attachment := &Attachment{}
+	err := m.DbConn.QueryRow(sqlStmt, id).Scan(
+		&attachment.Id,
+		&attachment.SubscriberName,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.ChannelName,
+		&attachment.MessageId,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// Link an uploaded attachment to the channel message it was sent with
+func (m *AttachmentPgsql) Attach(id string, chName string, messageId string) error {
+
+	sqlStmt := `UPDATE attachment SET channel = $2, message_id = $3
+		WHERE id = $1 AND message_id IS NULL`
+
+	_, err := m.DbConn.Exec(sqlStmt, id, chName, messageId)
+
+	return err
+}
+
+type AttachmentSqlite struct {
+	model.IAttachmentDS
+	DbConn *sql.DB
+}
+
+func (m *AttachmentSqlite) Add(attachment model.IAttachment) error {
+
+	sqlStmt := `INSERT INTO attachment(id, subscriber, filename, content_type, size, created)
+		VALUES(?, ?, ?, ?, ?, ?)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		attachment.GetId(),
+		attachment.GetSubscriberName(),
+		attachment.GetFileName(),
+		attachment.GetContentType(),
+		attachment.GetSize(),
+		time.Now().UTC(),
+	)
+
+	return err
+}
+
+func (m *AttachmentSqlite) Get(id string) (model.IAttachment, error) {
+
+	sqlStmt := `SELECT id, subscriber, filename, content_type, size,
+		COALESCE(channel, ''), COALESCE(message_id, '')
+		FROM attachment WHERE id = ? LIMIT 1`
+
+	attachment := &Attachment{}
+	err := m.DbConn.QueryRow(sqlStmt, id).Scan(
+		&attachment.Id,
+		&attachment.SubscriberName,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.ChannelName,
+		&attachment.MessageId,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// Link an uploaded attachment to the channel message it was sent with
+func (m *AttachmentSqlite) Attach(id string, chName string, messageId string) error {
+
+	sqlStmt := `UPDATE attachment SET channel = ?, message_id = ?
+		WHERE id = ? AND message_id IS NULL`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, messageId, id)
+
+	return err
+}
@@ -70,3 +70,56 @@ func (m *ChannelPgsql) Get(chName string) (model.IChannel, error) {
 
 	return channel, nil
 }
+
+type ChannelSqlite struct {
+	model.IChannelDS
+	DbConn *sql.DB
+}
+
+func (m *ChannelSqlite) Add(channel model.IChannel) error {
+
+	sqlStmt := "INSERT INTO channel(name, private) VALUES(?, ?)"
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	private := 0
+	if channel.IsPrivate() {
+		private = 1
+	}
+
+	_, err = stmt.Exec(channel.GetName(), private)
+
+	return err
+}
+
+func (m *ChannelSqlite) Get(chName string) (model.IChannel, error) {
+
+	sqlStmt := "SELECT id, name, COALESCE(private, 0) FROM channel WHERE name = ? LIMIT 1"
+
+	channel := &Channel{}
+	row := m.DbConn.QueryRow(sqlStmt, chName)
+
+	err := row.Scan(&channel.Id, &channel.Name, &channel.Private)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+func (m *ChannelSqlite) Remove(chName string) error {
+
+	_, err := m.DbConn.Exec("DELETE FROM channel WHERE name = ?", chName)
+
+	return err
+}
@@ -0,0 +1,513 @@
+package datasource
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"yt/chat/server/chat/model"
+
+	"github.com/google/uuid"
+)
+
+// Behaviour shared by the data source backends. See memory_test.go, and
+// sqlite_test.go.
+
+var testBase = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// Add channel "general" messages 0-3, one second apart, a reply to
+// message 1, and a message of another channel. Returns the ids of 0-3.
+func addTestMessages(t *testing.T, ds model.IMessageDS) []string {
+
+	t.Helper()
+
+	ids := []string{}
+	for i, text := range []string{"Hello world", "<b>bold</b> world", "good morning", "World peace"} {
+		id := uuid.NewString()
+		ids = append(ids, id)
+		addTestMessage(t, ds, &Message{
+			Id:             id,
+			ChannelName:    "general",
+			SubscriberName: "alice",
+			Message:        text,
+			Created:        testBase.Add(time.Duration(i) * time.Second),
+			Seq:            int64(i + 1),
+		})
+	}
+
+	addTestMessage(t, ds, &Message{
+		Id:             uuid.NewString(),
+		ChannelName:    "general",
+		SubscriberName: "bob",
+		Message:        "thanks",
+		Created:        testBase.Add(10 * time.Second),
+		Seq:            5,
+		ParentId:       ids[1],
+	})
+	addTestMessage(t, ds, &Message{
+		Id:             uuid.NewString(),
+		ChannelName:    "random",
+		SubscriberName: "alice",
+		Message:        "world elsewhere",
+		Created:        testBase,
+		Seq:            1,
+	})
+
+	return ids
+}
+
+func addTestMessage(t *testing.T, ds model.IMessageDS, message *Message) {
+
+	t.Helper()
+
+	if err := ds.Add(message); err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+}
+
+func messageIds(messages []model.IMessage) []string {
+
+	ids := []string{}
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+	}
+	return ids
+}
+
+func testGetPage(t *testing.T, ds model.IMessageDS) {
+
+	ids := addTestMessages(t, ds)
+
+	tests := []struct {
+		name    string
+		cursor  string
+		limit   int
+		want    []string
+		wantErr bool
+	}{
+		{"latest", "", 2, []string{ids[2], ids[3]}, false},
+		{"all, no replies", "", 10, ids, false},
+		{"before message", ids[2], 10, []string{ids[0], ids[1]}, false},
+		{"before message, limited", ids[3], 2, []string{ids[1], ids[2]}, false},
+		{"before first message", ids[0], 10, []string{}, false},
+		{"before time", testBase.Add(1500 * time.Millisecond).Format(time.RFC3339Nano), 10,
+			[]string{ids[0], ids[1]}, false},
+		{"invalid cursor", "yesterday", 10, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ds.GetPage("general", tt.cursor, tt.limit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetPage(%q) succeeded, want error", tt.cursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPage(%q) failed: %v", tt.cursor, err)
+			}
+			if got := messageIds(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPage(%q, %d) = %v, want %v", tt.cursor, tt.limit, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("thread stats", func(t *testing.T) {
+		page, err := ds.GetPage("general", "", 10)
+		if err != nil {
+			t.Fatalf("GetPage() failed: %v", err)
+		}
+		parent := page[1]
+		if parent.GetReplyCount() != 1 || !parent.GetLastReply().Equal(testBase.Add(10*time.Second)) {
+			t.Errorf("reply count %d, last reply %v, want 1, %v",
+				parent.GetReplyCount(), parent.GetLastReply(), testBase.Add(10*time.Second))
+		}
+	})
+}
+
+func testSearch(t *testing.T, ds model.IMessageDS) {
+
+	ids := addTestMessages(t, ds)
+
+	if err := ds.Delete(ids[3], "alice"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		search      *MessageSearch
+		want        []string
+		wantSnippet string // Of the first result
+	}{
+		{"latest first, deleted excluded",
+			&MessageSearch{Text: "world", Channels: []string{"general"}, Limit: 10},
+			[]string{ids[1], ids[0]}, "&lt;b&gt;bold&lt;/b&gt; <mark>world</mark>"},
+		{"all words",
+			&MessageSearch{Text: "HELLO world", Channels: []string{"general"}, Limit: 10},
+			[]string{ids[0]}, "<mark>Hello</mark> <mark>world</mark>"},
+		{"markup is text",
+			&MessageSearch{Text: "<b>", Channels: []string{"general"}, Limit: 10},
+			[]string{ids[1]}, "<mark>&lt;b&gt;</mark>bold&lt;/b&gt; world"},
+		{"offset",
+			&MessageSearch{Text: "world", Channels: []string{"general"}, Limit: 10, Offset: 1},
+			[]string{ids[0]}, "Hello <mark>world</mark>"},
+		{"sender",
+			&MessageSearch{Text: "world", Channels: []string{"general"}, Sender: "carol", Limit: 10},
+			[]string{}, ""},
+		{"time range",
+			&MessageSearch{Text: "world", Channels: []string{"general"}, Limit: 10,
+				From: testBase, To: testBase.Add(time.Second)},
+			[]string{ids[0]}, "Hello <mark>world</mark>"},
+		{"no channels",
+			&MessageSearch{Text: "world", Limit: 10},
+			[]string{}, ""},
+		{"wildcard is text",
+			&MessageSearch{Text: "%", Channels: []string{"general"}, Limit: 10},
+			[]string{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := ds.Search(tt.search)
+			if err != nil {
+				t.Fatalf("Search() failed: %v", err)
+			}
+			if got := messageIds(found); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Search(%q) = %v, want %v", tt.search.Text, got, tt.want)
+			}
+			if len(found) > 0 && found[0].GetSnippet() != tt.wantSnippet {
+				t.Errorf("snippet = %q, want %q", found[0].GetSnippet(), tt.wantSnippet)
+			}
+		})
+	}
+}
+
+func testReadMarker(t *testing.T, messageDs model.IMessageDS, markerDs model.IReadMarkerDS) {
+
+	ids := addTestMessages(t, messageDs)
+
+	unread := func(subscriberName string) int {
+		t.Helper()
+		marker, err := markerDs.Get("general", subscriberName)
+		if err != nil || marker == nil {
+			t.Fatalf("Get() = %v, %v", marker, err)
+		}
+		return marker.GetUnreadCount()
+	}
+
+	if err := markerDs.Init("general", "bob"); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+	// The reply is the latest message
+	if got := unread("bob"); got != 0 {
+		t.Errorf("unread after init = %d, want 0", got)
+	}
+
+	steps := []struct {
+		name        string
+		messageId   string
+		wantMessage string
+		wantUnread  int
+	}{
+		{"set", ids[0], ids[0], 4},
+		{"forward", ids[2], ids[2], 2},
+		{"never back", ids[0], ids[2], 2},
+		{"unknown message ignored", uuid.NewString(), ids[2], 2},
+	}
+
+	for _, step := range steps {
+		if err := markerDs.Set("general", "carol", step.messageId); err != nil {
+			t.Fatalf("%s: Set() failed: %v", step.name, err)
+		}
+		marker, err := markerDs.Get("general", "carol")
+		if err != nil || marker == nil {
+			t.Fatalf("%s: Get() = %v, %v", step.name, marker, err)
+		}
+		if marker.GetMessageId() != step.wantMessage || marker.GetUnreadCount() != step.wantUnread {
+			t.Errorf("%s: message %s, unread %d, want %s, %d", step.name,
+				marker.GetMessageId(), marker.GetUnreadCount(), step.wantMessage, step.wantUnread)
+		}
+	}
+
+	// Deleted messages, and own messages are not unread
+	if err := messageDs.Delete(ids[3], "alice"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if got := unread("carol"); got != 1 {
+		t.Errorf("unread after delete = %d, want 1", got)
+	}
+	if err := markerDs.Set("general", "alice", ids[0]); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if got := unread("alice"); got != 1 {
+		t.Errorf("unread of sender = %d, want 1", got)
+	}
+
+	markers, err := markerDs.GetAll("carol")
+	if err != nil || len(markers) != 1 {
+		t.Errorf("GetAll() = %d markers, %v, want 1", len(markers), err)
+	}
+
+	if err := markerDs.Remove("general", "carol"); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if marker, err := markerDs.Get("general", "carol"); marker != nil || err != nil {
+		t.Errorf("Get() after remove = %v, %v, want nil", marker, err)
+	}
+}
+
+func testAccountTokenTake(t *testing.T, ds model.IAccountTokenDS) {
+
+	tokens := []*AccountToken{
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_REFRESH, TokenHash: "valid",
+			Expires: time.Now().Add(time.Hour)},
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_REFRESH, TokenHash: "expired",
+			Expires: time.Now().Add(-time.Hour)},
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_RESET_PASSWORD, TokenHash: "reset",
+			Expires: time.Now().Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := ds.Add(token); err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		tokenHash string
+		purpose   string
+		want      bool
+	}{
+		{"valid", "valid", TOKEN_PURPOSE_REFRESH, true},
+		{"single use", "valid", TOKEN_PURPOSE_REFRESH, false},
+		{"expired", "expired", TOKEN_PURPOSE_REFRESH, false},
+		{"other purpose", "reset", TOKEN_PURPOSE_REFRESH, false},
+		{"unknown", "unknown", TOKEN_PURPOSE_REFRESH, false},
+		{"purpose", "reset", TOKEN_PURPOSE_RESET_PASSWORD, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ds.Take(tt.tokenHash, tt.purpose)
+			if err != nil {
+				t.Fatalf("Take() failed: %v", err)
+			}
+			if (token != nil) != tt.want {
+				t.Fatalf("Take(%q, %q) = %v, want token %v", tt.tokenHash, tt.purpose, token, tt.want)
+			}
+			if token != nil && token.GetSubscriberName() != "bob" {
+				t.Errorf("subscriber = %q, want bob", token.GetSubscriberName())
+			}
+		})
+	}
+}
+
+func testAccountTokenDeleteAll(t *testing.T, ds model.IAccountTokenDS) {
+
+	tokens := []*AccountToken{
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_REFRESH, TokenHash: "bob-1"},
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_REFRESH, TokenHash: "bob-2"},
+		{SubscriberName: "bob", Purpose: TOKEN_PURPOSE_VERIFY_EMAIL, TokenHash: "bob-verify"},
+		{SubscriberName: "alice", Purpose: TOKEN_PURPOSE_REFRESH, TokenHash: "alice-1"},
+	}
+	for _, token := range tokens {
+		token.Expires = time.Now().Add(time.Hour)
+		if err := ds.Add(token); err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+	}
+
+	if err := ds.DeleteAll("bob", TOKEN_PURPOSE_REFRESH); err != nil {
+		t.Fatalf("DeleteAll() failed: %v", err)
+	}
+
+	tests := []struct {
+		tokenHash string
+		purpose   string
+		want      bool
+	}{
+		{"bob-1", TOKEN_PURPOSE_REFRESH, false},
+		{"bob-2", TOKEN_PURPOSE_REFRESH, false},
+		{"bob-verify", TOKEN_PURPOSE_VERIFY_EMAIL, true},
+		{"alice-1", TOKEN_PURPOSE_REFRESH, true},
+	}
+
+	for _, tt := range tests {
+		token, err := ds.Take(tt.tokenHash, tt.purpose)
+		if err != nil {
+			t.Fatalf("Take() failed: %v", err)
+		}
+		if (token != nil) != tt.want {
+			t.Errorf("Take(%q) = %v, want token %v", tt.tokenHash, token, tt.want)
+		}
+	}
+}
+
+func testLastSeq(t *testing.T, ds model.IMessageDS) {
+
+	addTestMessages(t, ds)
+
+	// In order. Each step starts from the sequence of the previous step.
+	steps := []struct {
+		name    string
+		keep    int64
+		channel string
+		want    int64
+	}{
+		{"stored messages", 0, "general", 5},
+		{"kept, below stored", 3, "general", 5},
+		{"kept, above stored", 8, "general", 8},
+		{"never back", 6, "general", 8},
+		{"no messages", 2, "empty", 2},
+	}
+
+	for _, step := range steps {
+		if step.keep > 0 {
+			if err := ds.SetLastSeq(step.channel, step.keep); err != nil {
+				t.Fatalf("%s: SetLastSeq() failed: %v", step.name, err)
+			}
+		}
+		seq, err := ds.GetLastSeq(step.channel)
+		if err != nil {
+			t.Fatalf("%s: GetLastSeq() failed: %v", step.name, err)
+		}
+		if seq != step.want {
+			t.Errorf("%s: GetLastSeq(%q) = %d, want %d", step.name, step.channel, seq, step.want)
+		}
+	}
+}
+
+func testChannelDS(t *testing.T, ds model.IChannelDS) {
+
+	for _, channel := range []*Channel{{Name: "general"}, {Name: "secret", Private: true}} {
+		if err := ds.Add(channel); err != nil {
+			t.Fatalf("Add(%s) failed: %v", channel.Name, err)
+		}
+	}
+	if err := ds.Add(&Channel{Name: "general"}); err == nil {
+		t.Error("Add() of a duplicate name succeeded")
+	}
+
+	tests := []struct {
+		name    string
+		found   bool
+		private bool
+	}{
+		{"general", true, false},
+		{"secret", true, true},
+		{"unknown", false, false},
+	}
+
+	for _, tt := range tests {
+		channel, err := ds.Get(tt.name)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", tt.name, err)
+		}
+		if (channel != nil) != tt.found {
+			t.Fatalf("Get(%s) = %v, want found %v", tt.name, channel, tt.found)
+		}
+		if channel != nil && (channel.GetName() != tt.name || channel.IsPrivate() != tt.private || channel.GetId() == "") {
+			t.Errorf("Get(%s) = %s, private %v, id %q", tt.name, channel.GetName(), channel.IsPrivate(), channel.GetId())
+		}
+	}
+
+	if err := ds.Remove("general"); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if channel, err := ds.Get("general"); channel != nil || err != nil {
+		t.Errorf("Get() after remove = %v, %v, want nil", channel, err)
+	}
+}
+
+func testSubscriberDS(t *testing.T, ds model.ISubscriberDS) {
+
+	subscribers := []*Subscriber{
+		{Name: "bob", Email: "bob@example.com", Password: "hash", Type: SUBSCRIBER_TYPE_LOGIN},
+		{Name: "alice", Email: "alice@example.com", Password: "hash", Type: SUBSCRIBER_TYPE_LOGIN},
+		{Name: "guest", Email: "guest@example.com", Type: SUBSCRIBER_TYPE_ANONYMOUS},
+	}
+	for _, subscriber := range subscribers {
+		if err := ds.Add(subscriber); err != nil {
+			t.Fatalf("Add(%s) failed: %v", subscriber.Name, err)
+		}
+	}
+
+	duplicates := []struct {
+		subscriber *Subscriber
+		want       error
+	}{
+		{&Subscriber{Name: "bob", Email: "other@example.com", Type: SUBSCRIBER_TYPE_LOGIN}, ErrDuplicateName},
+		{&Subscriber{Name: "robert", Email: "bob@example.com", Type: SUBSCRIBER_TYPE_LOGIN}, ErrDuplicateEmail},
+	}
+	for _, tt := range duplicates {
+		if err := ds.Add(tt.subscriber); err != tt.want {
+			t.Errorf("Add(%s, %s) = %v, want %v", tt.subscriber.Name, tt.subscriber.Email, err, tt.want)
+		}
+	}
+
+	// Registered, and anonymous subscribers are apart
+	tests := []struct {
+		name           string
+		subscriberType string
+		found          bool
+	}{
+		{"bob", SUBSCRIBER_TYPE_LOGIN, true},
+		{"bob", SUBSCRIBER_TYPE_ANONYMOUS, false},
+		{"guest", SUBSCRIBER_TYPE_ANONYMOUS, true},
+		{"guest", SUBSCRIBER_TYPE_LOGIN, false},
+	}
+	for _, tt := range tests {
+		subscriber, err := ds.Get(&Subscriber{Name: tt.name, Type: tt.subscriberType})
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", tt.name, err)
+		}
+		if (subscriber != nil) != tt.found {
+			t.Errorf("Get(%s, %s) = %v, want found %v", tt.name, tt.subscriberType, subscriber, tt.found)
+		}
+	}
+
+	all, err := ds.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll() failed: %v", err)
+	}
+	if len(all) != 2 || all[0].GetName() != "alice" || all[1].GetName() != "bob" {
+		t.Errorf("GetAll() = %d subscribers, want alice, and bob", len(all))
+	}
+
+	// Password hashes are for login only
+	login, err := ds.GetLoginInfo(&Subscriber{Name: "bob"})
+	if err != nil || login == nil || login.GetPassword() != "hash" {
+		t.Errorf("GetLoginInfo() = %v, %v, want the password hash", login, err)
+	}
+	if err = ds.SetPassword("bob", "changed"); err != nil {
+		t.Fatalf("SetPassword() failed: %v", err)
+	}
+	if login, _ = ds.GetLoginInfo(&Subscriber{Name: "bob"}); login == nil || login.GetPassword() != "changed" {
+		t.Errorf("GetLoginInfo() after SetPassword() = %v", login)
+	}
+
+	byEmail, err := ds.GetByEmail("bob@example.com")
+	if err != nil || byEmail == nil || byEmail.GetName() != "bob" {
+		t.Errorf("GetByEmail() = %v, %v, want bob", byEmail, err)
+	}
+	if byEmail, _ = ds.GetByEmail("guest@example.com"); byEmail != nil {
+		t.Errorf("GetByEmail() of an anonymous subscriber = %v, want nil", byEmail)
+	}
+
+	if err = ds.UpdateLastSeen(&Subscriber{Name: "bob", Type: SUBSCRIBER_TYPE_LOGIN}, testBase); err != nil {
+		t.Fatalf("UpdateLastSeen() failed: %v", err)
+	}
+	if lastSeen, err := ds.GetLastSeen("bob"); err != nil || !lastSeen.Equal(testBase) {
+		t.Errorf("GetLastSeen() = %v, %v, want %v", lastSeen, err, testBase)
+	}
+	if lastSeen, err := ds.GetLastSeen("alice"); err != nil || !lastSeen.IsZero() {
+		t.Errorf("GetLastSeen() of never seen = %v, %v, want zero", lastSeen, err)
+	}
+
+	if err = ds.Remove(&Subscriber{Name: "bob", Type: SUBSCRIBER_TYPE_LOGIN}); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if subscriber, err := ds.Get(&Subscriber{Name: "bob", Type: SUBSCRIBER_TYPE_LOGIN}); subscriber != nil || err != nil {
+		t.Errorf("Get() after remove = %v, %v, want nil", subscriber, err)
+	}
+}
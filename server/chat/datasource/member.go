@@ -0,0 +1,319 @@
+package datasource
+
+import (
+	"database/sql"
+	"time"
+	"yt/chat/server/chat/model"
+)
+
+const (
+	MEMBER_STATUS_INVITED = "invited"
+	MEMBER_STATUS_JOINED  = "joined"
+)
+
+const (
+	MEMBER_ROLE_OWNER     = "owner"
+	MEMBER_ROLE_MODERATOR = "moderator"
+	MEMBER_ROLE_MEMBER    = "member"
+)
+
+type ChannelMember struct {
+	model.IChannelMember
+	ChannelName    string
+	SubscriberName string
+	Status         string
+	InvitedBy      string
+	Role           string
+	Banned         bool
+	Muted          bool
+}
+
+func (m *ChannelMember) GetChannelName() string {
+	return m.ChannelName
+}
+
+func (m *ChannelMember) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *ChannelMember) GetStatus() string {
+	return m.Status
+}
+
+func (m *ChannelMember) GetInvitedBy() string {
+	return m.InvitedBy
+}
+
+func (m *ChannelMember) GetRole() string {
+	return m.Role
+}
+
+func (m *ChannelMember) IsBanned() bool {
+	return m.Banned
+}
+
+func (m *ChannelMember) IsMuted() bool {
+	return m.Muted
+}
+
+type ChannelMemberPgsql struct {
+	model.IChannelMemberDS
+	DbConn *sql.DB
+}
+
+func (m *ChannelMemberPgsql) Add(member model.IChannelMember) error {
+
+	sqlStmt := `INSERT INTO channel_member(channel, subscriber, status, invited_by, role, banned, muted)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		member.GetChannelName(),
+		member.GetSubscriberName(),
+		member.GetStatus(),
+		member.GetInvitedBy(),
+		member.GetRole(),
+		member.IsBanned(),
+		member.IsMuted(),
+	)
+
+	return err
+}
+
+func (m *ChannelMemberPgsql) Update(member model.IChannelMember) error {
+
+	sqlStmt := `UPDATE channel_member SET status = $3, invited_by = $4, role = $5,
+		banned = $6, muted = $7, updated = CURRENT_TIMESTAMP
+		WHERE channel = $1 AND subscriber = $2`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		member.GetChannelName(),
+		member.GetSubscriberName(),
+		member.GetStatus(),
+		member.GetInvitedBy(),
+		member.GetRole(),
+		member.IsBanned(),
+		member.IsMuted(),
+	)
+
+	return err
+}
+
+func (m *ChannelMemberPgsql) Get(chName string, subscriberName string) (model.IChannelMember, error) {
+
+	sqlStmt := `SELECT channel, subscriber, status, invited_by, role, banned, muted FROM channel_member
+		WHERE channel = $1 AND subscriber = $2 LIMIT 1`
+
+	row := m.DbConn.QueryRow(sqlStmt, chName, subscriberName)
+
+	member := &ChannelMember{}
+	err := row.Scan(
+		&member.ChannelName,
+		&member.SubscriberName,
+		&member.Status,
+		&member.InvitedBy,
+		&member.Role,
+		&member.Banned,
+		&member.Muted,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// Get pending invitations of a subscriber
+func (m *ChannelMemberPgsql) GetInvites(subscriberName string) ([]model.IChannelMember, error) {
+
+	sqlStmt := `SELECT channel, subscriber, status, invited_by, role, banned, muted FROM channel_member
+		WHERE subscriber = $1 AND status = $2 ORDER BY created`
+
+	rows, err := m.DbConn.Query(sqlStmt, subscriberName, MEMBER_STATUS_INVITED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.IChannelMember{}
+	for rows.Next() {
+		member := &ChannelMember{}
+		err = rows.Scan(
+			&member.ChannelName,
+			&member.SubscriberName,
+			&member.Status,
+			&member.InvitedBy,
+			&member.Role,
+			&member.Banned,
+			&member.Muted,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func (m *ChannelMemberPgsql) Remove(chName string, subscriberName string) error {
+
+	sqlStmt := "DELETE FROM channel_member WHERE channel = $1 AND subscriber = $2"
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(chName, subscriberName)
+
+	return err
+}
+
+type ChannelMemberSqlite struct {
+	model.IChannelMemberDS
+	DbConn *sql.DB
+}
+
+func (m *ChannelMemberSqlite) Add(member model.IChannelMember) error {
+
+	sqlStmt := `INSERT INTO channel_member(channel, subscriber, status, invited_by, role, banned, muted)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		member.GetChannelName(),
+		member.GetSubscriberName(),
+		member.GetStatus(),
+		member.GetInvitedBy(),
+		member.GetRole(),
+		member.IsBanned(),
+		member.IsMuted(),
+	)
+
+	return err
+}
+
+func (m *ChannelMemberSqlite) Update(member model.IChannelMember) error {
+
+	sqlStmt := `UPDATE channel_member SET status = ?, invited_by = ?, role = ?,
+		banned = ?, muted = ?, updated = ?
+		WHERE channel = ? AND subscriber = ?`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		member.GetStatus(),
+		member.GetInvitedBy(),
+		member.GetRole(),
+		member.IsBanned(),
+		member.IsMuted(),
+		time.Now().UTC(),
+		member.GetChannelName(),
+		member.GetSubscriberName(),
+	)
+
+	return err
+}
+
+func (m *ChannelMemberSqlite) Get(chName string, subscriberName string) (model.IChannelMember, error) {
+
+	sqlStmt := `SELECT channel, subscriber, status, invited_by, role, banned, muted FROM channel_member
+		WHERE channel = ? AND subscriber = ? LIMIT 1`
+
+	row := m.DbConn.QueryRow(sqlStmt, chName, subscriberName)
+
+	member := &ChannelMember{}
+	err := row.Scan(
+		&member.ChannelName,
+		&member.SubscriberName,
+		&member.Status,
+		&member.InvitedBy,
+		&member.Role,
+		&member.Banned,
+		&member.Muted,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// Get pending invitations of a subscriber
+func (m *ChannelMemberSqlite) GetInvites(subscriberName string) ([]model.IChannelMember, error) {
+
+	sqlStmt := `SELECT channel, subscriber, status, invited_by, role, banned, muted FROM channel_member
+		WHERE subscriber = ? AND status = ? ORDER BY created`
+
+	rows, err := m.DbConn.Query(sqlStmt, subscriberName, MEMBER_STATUS_INVITED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.IChannelMember{}
+	for rows.Next() {
+		member := &ChannelMember{}
+		err = rows.Scan(
+			&member.ChannelName,
+			&member.SubscriberName,
+			&member.Status,
+			&member.InvitedBy,
+			&member.Role,
+			&member.Banned,
+			&member.Muted,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func (m *ChannelMemberSqlite) Remove(chName string, subscriberName string) error {
+
+	_, err := m.DbConn.Exec("DELETE FROM channel_member WHERE channel = ? AND subscriber = ?",
+		chName, subscriberName)
+
+	return err
+}
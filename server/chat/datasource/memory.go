@@ -0,0 +1,1107 @@
+package datasource
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yt/chat/server/chat/model"
+
+	"github.com/google/uuid"
+)
+
+// In memory data sources. Data is lost on restart. For demos, and tests.
+//
+// All data sources of a store share its data, e.g. unread counts of read
+// markers are counted from the messages of the store.
+
+var ErrDuplicate = errors.New("duplicate key")
+
+type memberKey struct {
+	channel    string
+	subscriber string
+}
+
+type memoryMessage struct {
+	Message
+	reactions map[string]map[string]bool // Subscribers by reaction
+}
+
+type memoryMember struct {
+	ChannelMember
+	created time.Time
+}
+
+type memoryMarker struct {
+	messageId   string
+	readCreated time.Time
+}
+
+type memoryMention struct {
+	Mention
+	seen bool
+}
+
+type memorySubscriber struct {
+	Subscriber
+	lastSeen      time.Time
+	emailVerified time.Time
+}
+
+type memoryAccountToken struct {
+	AccountToken
+	used bool
+}
+
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	lastId      int // Serial ids of channels, and subscribers
+	channels    map[string]*Channel
+	subscribers map[string]*memorySubscriber // Registered subscribers by name
+	transients  map[string]*memorySubscriber // Anonymous subscribers by name
+	messages    map[string]*memoryMessage
+	members     map[memberKey]*memoryMember
+	markers     map[memberKey]*memoryMarker
+	mentions    []*memoryMention
+	attachments map[string]*Attachment
+	tokens      map[string]*memoryAccountToken // Account tokens by hash
+	seqs        map[string]int64               // Last sequence numbers kept by channel
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		channels:    make(map[string]*Channel),
+		subscribers: make(map[string]*memorySubscriber),
+		transients:  make(map[string]*memorySubscriber),
+		messages:    make(map[string]*memoryMessage),
+		members:     make(map[memberKey]*memoryMember),
+		markers:     make(map[memberKey]*memoryMarker),
+		mentions:    []*memoryMention{},
+		attachments: make(map[string]*Attachment),
+		tokens:      make(map[string]*memoryAccountToken),
+		seqs:        make(map[string]int64),
+	}
+}
+
+func (m *MemoryStore) nextId() string {
+	m.lastId++
+	return strconv.Itoa(m.lastId)
+}
+
+//
+// Channels
+//
+
+type ChannelMemory struct {
+	model.IChannelDS
+	Store *MemoryStore
+}
+
+func (m *ChannelMemory) Add(channel model.IChannel) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if _, ok := m.Store.channels[channel.GetName()]; ok {
+		return ErrDuplicate
+	}
+
+	m.Store.channels[channel.GetName()] = &Channel{
+		Id:      m.Store.nextId(),
+		Name:    channel.GetName(),
+		Private: channel.IsPrivate(),
+	}
+
+	return nil
+}
+
+func (m *ChannelMemory) Get(chName string) (model.IChannel, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	channel, ok := m.Store.channels[chName]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *channel
+	return &copied, nil
+}
+
+func (m *ChannelMemory) Remove(chName string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	delete(m.Store.channels, chName)
+	return nil
+}
+
+//
+// Subscribers
+//
+
+type SubscriberMemory struct {
+	model.ISubscriberDS
+	Store *MemoryStore
+}
+
+// Registered, or anonymous subscribers by the subscriber type
+func (m *SubscriberMemory) table(subscriber model.ISubscriber) map[string]*memorySubscriber {
+
+	if subscriber.(*Subscriber).Type == SUBSCRIBER_TYPE_ANONYMOUS {
+		return m.Store.transients
+	}
+	return m.Store.subscribers
+}
+
+func (m *SubscriberMemory) Add(subscriber model.ISubscriber) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	table := m.table(subscriber)
+	if _, ok := table[subscriber.GetName()]; ok {
+		return ErrDuplicateName
+	}
+	for _, subs := range table {
+		if subs.Email == subscriber.GetEmail() {
+			return ErrDuplicateEmail
+		}
+	}
+
+	subs := &memorySubscriber{
+		Subscriber: Subscriber{
+			Id:    m.Store.nextId(),
+			Name:  subscriber.GetName(),
+			Email: subscriber.GetEmail(),
+			Type:  subscriber.(*Subscriber).Type,
+		},
+	}
+	if subs.Type != SUBSCRIBER_TYPE_ANONYMOUS {
+		subs.Password = subscriber.GetPassword()
+	}
+	table[subs.Name] = subs
+
+	return nil
+}
+
+func (m *SubscriberMemory) Remove(subscriber model.ISubscriber) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	delete(m.table(subscriber), subscriber.GetName())
+	return nil
+}
+
+// Works only for subscribers - registered users
+func (m *SubscriberMemory) GetLoginInfo(subscriber model.ISubscriber) (model.ISubscriber, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	subs, ok := m.Store.subscribers[subscriber.GetName()]
+	if !ok {
+		return nil, nil
+	}
+
+	return &Subscriber{
+		Name:     subs.Name,
+		Password: subs.Password,
+	}, nil
+}
+
+func (m *SubscriberMemory) Get(subscriber model.ISubscriber) (model.ISubscriber, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	subs, ok := m.table(subscriber)[subscriber.GetName()]
+	if !ok {
+		return nil, nil
+	}
+
+	return &Subscriber{
+		Id:    subs.Id,
+		Name:  subs.Name,
+		Email: subs.Email,
+		Type:  subscriber.(*Subscriber).Type,
+	}, nil
+}
+
+func (m *SubscriberMemory) GetAll() ([]model.ISubscriber, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	subscribers := make([]model.ISubscriber, 0, len(m.Store.subscribers))
+	for _, subs := range m.Store.subscribers {
+		subscribers = append(subscribers, &Subscriber{
+			Id:    subs.Id,
+			Name:  subs.Name,
+			Email: subs.Email,
+			Type:  SUBSCRIBER_TYPE_LOGIN,
+		})
+	}
+
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].GetName() < subscribers[j].GetName()
+	})
+
+	return subscribers, nil
+}
+
+func (m *SubscriberMemory) UpdateLastSeen(subscriber model.ISubscriber, lastSeen time.Time) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if subs, ok := m.table(subscriber)[subscriber.GetName()]; ok {
+		subs.lastSeen = lastSeen
+	}
+	return nil
+}
+
+// Get the last time a subscriber was online. Zero if never seen.
+func (m *SubscriberMemory) GetLastSeen(name string) (time.Time, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	var lastSeen time.Time
+	for _, table := range []map[string]*memorySubscriber{m.Store.subscribers, m.Store.transients} {
+		if subs, ok := table[name]; ok && subs.lastSeen.After(lastSeen) {
+			lastSeen = subs.lastSeen
+		}
+	}
+
+	return lastSeen, nil
+}
+
+func (m *SubscriberMemory) GetByEmail(email string) (model.ISubscriber, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	for _, subs := range m.Store.subscribers {
+		if subs.Email == email {
+			return &Subscriber{
+				Id:    subs.Id,
+				Name:  subs.Name,
+				Email: subs.Email,
+				Type:  SUBSCRIBER_TYPE_LOGIN,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *SubscriberMemory) SetEmailVerified(name string, verified time.Time) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if subs, ok := m.Store.subscribers[name]; ok {
+		subs.emailVerified = verified
+	}
+	return nil
+}
+
+func (m *SubscriberMemory) SetPassword(name string, password string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if subs, ok := m.Store.subscribers[name]; ok {
+		subs.Password = password
+	}
+	return nil
+}
+
+//
+// Messages
+//
+
+type MessageMemory struct {
+	model.IMessageDS
+	Store *MemoryStore
+}
+
+// Channel order of messages. Same as the Pgsql history order.
+func messageBefore(a *Message, b *Message) bool {
+
+	if a.Seq != b.Seq {
+		return a.Seq < b.Seq
+	}
+	if !a.Created.Equal(b.Created) {
+		return a.Created.Before(b.Created)
+	}
+	return a.Id < b.Id
+}
+
+func (m *MessageMemory) Add(message model.IMessage) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if _, ok := m.Store.messages[message.GetId()]; ok {
+		return ErrDuplicate
+	}
+
+	m.Store.messages[message.GetId()] = &memoryMessage{
+		Message: Message{
+			Id:             message.GetId(),
+			ChannelName:    message.GetChannelName(),
+			SubscriberId:   message.GetSubscriberId(),
+			SubscriberName: message.GetSubscriberName(),
+			Message:        message.GetMessage(),
+			Created:        message.GetCreated(),
+			Seq:            message.GetSeq(),
+			ParentId:       message.GetParentId(),
+		},
+		reactions: make(map[string]map[string]bool),
+	}
+
+	return nil
+}
+
+func (m *MessageMemory) Get(id string) (model.IMessage, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	msg, ok := m.Store.messages[id]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := msg.Message
+	return &copied, nil
+}
+
+// Replace the text of a message
+func (m *MessageMemory) Edit(id string, text string, editor string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if msg, ok := m.Store.messages[id]; ok {
+		msg.Message.Message = text
+		msg.Edited = true
+	}
+	return nil
+}
+
+// Tombstone a message
+func (m *MessageMemory) Delete(id string, editor string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if msg, ok := m.Store.messages[id]; ok {
+		msg.Message.Message = ""
+		msg.Deleted = true
+	}
+	return nil
+}
+
+// Get the latest messages of a channel, oldest first
+func (m *MessageMemory) GetRecent(chName string, limit int) ([]model.IMessage, error) {
+	return m.GetPage(chName, "", limit)
+}
+
+// Get messages of a channel sent before the cursor, oldest first. Thread
+// replies are left out. The cursor is either a message id or an RFC3339
+// timestamp. An empty cursor starts from the latest message.
+func (m *MessageMemory) GetPage(chName string, cursor string, limit int) ([]model.IMessage, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	before := func(msg *Message) bool { return true }
+
+	if cursor == "" {
+		// From the latest
+	} else if _, perr := uuid.Parse(cursor); perr == nil {
+		cursorMsg, ok := m.Store.messages[cursor]
+		if !ok {
+			return []model.IMessage{}, nil
+		}
+		before = func(msg *Message) bool { return messageBefore(msg, &cursorMsg.Message) }
+	} else if ts, perr := time.Parse(time.RFC3339Nano, cursor); perr == nil {
+		before = func(msg *Message) bool { return msg.Created.Before(ts) }
+	} else {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	page := []*memoryMessage{}
+	for _, msg := range m.Store.messages {
+		if msg.ChannelName == chName && msg.ParentId == "" && before(&msg.Message) {
+			page = append(page, msg)
+		}
+	}
+
+	sort.Slice(page, func(i, j int) bool {
+		return messageBefore(&page[i].Message, &page[j].Message)
+	})
+	if len(page) > limit {
+		page = page[len(page)-limit:]
+	}
+
+	return m.load(page, true), nil
+}
+
+// Get all replies to a message, oldest first
+func (m *MessageMemory) GetThread(parentId string) ([]model.IMessage, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	replies := []*memoryMessage{}
+	for _, msg := range m.Store.messages {
+		if msg.ParentId == parentId {
+			replies = append(replies, msg)
+		}
+	}
+
+	sort.Slice(replies, func(i, j int) bool {
+		return messageBefore(&replies[i].Message, &replies[j].Message)
+	})
+
+	return m.load(replies, false), nil
+}
+
+// Copy the messages, with reaction counts, attachments and thread stats.
+// Store must be read locked.
+func (m *MessageMemory) load(messages []*memoryMessage, threads bool) []model.IMessage {
+
+	loaded := make([]model.IMessage, 0, len(messages))
+
+	for _, msg := range messages {
+		copied := msg.Message
+
+		for reaction, subscribers := range msg.reactions {
+			if len(subscribers) == 0 {
+				continue
+			}
+			if copied.Reactions == nil {
+				copied.Reactions = make(map[string]int)
+			}
+			copied.Reactions[reaction] = len(subscribers)
+		}
+
+		copied.Attachments = m.attachments(msg.Id)
+
+		if threads {
+			for _, reply := range m.Store.messages {
+				if reply.ParentId != msg.Id {
+					continue
+				}
+				copied.ReplyCount++
+				if reply.Created.After(copied.LastReply) {
+					copied.LastReply = reply.Created
+				}
+			}
+		}
+
+		loaded = append(loaded, &copied)
+	}
+
+	return loaded
+}
+
+// Attachment ids of a message. Store must be read locked.
+func (m *MessageMemory) attachments(messageId string) []string {
+
+	attachments := []*Attachment{}
+	for _, attachment := range m.Store.attachments {
+		if attachment.MessageId == messageId {
+			attachments = append(attachments, attachment)
+		}
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].Id < attachments[j].Id
+	})
+
+	ids := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.Id)
+	}
+	return ids
+}
+
+// Get the last sequence number of the channel, stored messages, or kept by
+// SetLastSeq. Zero if none.
+func (m *MessageMemory) GetLastSeq(chName string) (int64, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	seq := m.Store.seqs[chName]
+	for _, msg := range m.Store.messages {
+		if msg.ChannelName == chName && msg.Seq > seq {
+			seq = msg.Seq
+		}
+	}
+	return seq, nil
+}
+
+// Keep the last sequence number of the channel, if greater than kept before
+func (m *MessageMemory) SetLastSeq(chName string, seq int64) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if seq > m.Store.seqs[chName] {
+		m.Store.seqs[chName] = seq
+	}
+	return nil
+}
+
+// Add a subscriber's reaction to a message. Returns false if already added.
+func (m *MessageMemory) AddReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	msg, ok := m.Store.messages[id]
+	if !ok {
+		return false, errors.New("message not found: " + id)
+	}
+
+	if msg.reactions[reaction] == nil {
+		msg.reactions[reaction] = make(map[string]bool)
+	}
+	if msg.reactions[reaction][subscriberName] {
+		return false, nil
+	}
+	msg.reactions[reaction][subscriberName] = true
+
+	return true, nil
+}
+
+// Remove a subscriber's reaction from a message. Returns false if there was none.
+func (m *MessageMemory) RemoveReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	msg, ok := m.Store.messages[id]
+	if !ok || !msg.reactions[reaction][subscriberName] {
+		return false, nil
+	}
+	delete(msg.reactions[reaction], subscriberName)
+
+	return true, nil
+}
+
+// Count the subscribers who reacted to a message with the reaction
+func (m *MessageMemory) CountReactions(id string, reaction string) (int, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	msg, ok := m.Store.messages[id]
+	if !ok {
+		return 0, nil
+	}
+	return len(msg.reactions[reaction]), nil
+}
+
+// Search messages containing all words of the search text, latest first.
+// Deleted messages are excluded.
+func (m *MessageMemory) Search(search model.IMessageSearch) ([]model.IMessage, error) {
+
+	words := strings.Fields(strings.ToLower(search.GetText()))
+	if len(words) == 0 || len(search.GetChannels()) == 0 {
+		return []model.IMessage{}, nil
+	}
+
+	channels := make(map[string]bool, len(search.GetChannels()))
+	for _, chName := range search.GetChannels() {
+		channels[chName] = true
+	}
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	found := []*memoryMessage{}
+	for _, msg := range m.Store.messages {
+		if msg.Deleted || !channels[msg.ChannelName] {
+			continue
+		}
+		if search.GetSender() != "" && msg.SubscriberName != search.GetSender() {
+			continue
+		}
+		if !search.GetFrom().IsZero() && msg.Created.Before(search.GetFrom()) {
+			continue
+		}
+		if !search.GetTo().IsZero() && !msg.Created.Before(search.GetTo()) {
+			continue
+		}
+
+		text := strings.ToLower(msg.Message.Message)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, msg)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return messageBefore(&found[j].Message, &found[i].Message)
+	})
+
+	offset := search.GetOffset()
+	if offset > len(found) {
+		offset = len(found)
+	}
+	found = found[offset:]
+	if len(found) > search.GetLimit() {
+		found = found[:search.GetLimit()]
+	}
+
+	results := m.load(found, false)
+	for _, result := range results {
+		msg := result.(*Message)
+		msg.Reactions = nil
+		msg.Snippet = highlight(msg.Message, words)
+	}
+
+	return results, nil
+}
+
+// Mark the words in the HTML escaped text, as the Pgsql search snippets
+func highlight(text string, words []string) string {
+
+	var snippet strings.Builder
+	start := 0 // Text not yet written
+
+	for i := 0; i < len(text); {
+		matched := ""
+		for _, word := range words {
+			end := i + len(word)
+			if end <= len(text) && strings.EqualFold(text[i:end], word) && len(word) > len(matched) {
+				matched = word
+			}
+		}
+		if matched == "" {
+			i++
+			continue
+		}
+		snippet.WriteString(html.EscapeString(text[start:i]))
+		snippet.WriteString("<mark>" + html.EscapeString(text[i:i+len(matched)]) + "</mark>")
+		i += len(matched)
+		start = i
+	}
+	snippet.WriteString(html.EscapeString(text[start:]))
+
+	return snippet.String()
+}
+
+//
+// Channel members
+//
+
+type ChannelMemberMemory struct {
+	model.IChannelMemberDS
+	Store *MemoryStore
+}
+
+func (m *ChannelMemberMemory) Add(member model.IChannelMember) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	key := memberKey{member.GetChannelName(), member.GetSubscriberName()}
+	if _, ok := m.Store.members[key]; ok {
+		return ErrDuplicate
+	}
+
+	m.Store.members[key] = &memoryMember{
+		ChannelMember: copyMember(member),
+		created:       time.Now(),
+	}
+	return nil
+}
+
+func (m *ChannelMemberMemory) Update(member model.IChannelMember) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	key := memberKey{member.GetChannelName(), member.GetSubscriberName()}
+	if stored, ok := m.Store.members[key]; ok {
+		stored.ChannelMember = copyMember(member)
+	}
+	return nil
+}
+
+func (m *ChannelMemberMemory) Get(chName string, subscriberName string) (model.IChannelMember, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	stored, ok := m.Store.members[memberKey{chName, subscriberName}]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := stored.ChannelMember
+	return &copied, nil
+}
+
+// Get pending invitations of a subscriber
+func (m *ChannelMemberMemory) GetInvites(subscriberName string) ([]model.IChannelMember, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	invites := []*memoryMember{}
+	for key, stored := range m.Store.members {
+		if key.subscriber == subscriberName && stored.Status == MEMBER_STATUS_INVITED {
+			invites = append(invites, stored)
+		}
+	}
+
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].created.Before(invites[j].created)
+	})
+
+	members := make([]model.IChannelMember, 0, len(invites))
+	for _, stored := range invites {
+		copied := stored.ChannelMember
+		members = append(members, &copied)
+	}
+	return members, nil
+}
+
+func (m *ChannelMemberMemory) Remove(chName string, subscriberName string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	delete(m.Store.members, memberKey{chName, subscriberName})
+	return nil
+}
+
+func copyMember(member model.IChannelMember) ChannelMember {
+	return ChannelMember{
+		ChannelName:    member.GetChannelName(),
+		SubscriberName: member.GetSubscriberName(),
+		Status:         member.GetStatus(),
+		InvitedBy:      member.GetInvitedBy(),
+		Role:           member.GetRole(),
+		Banned:         member.IsBanned(),
+		Muted:          member.IsMuted(),
+	}
+}
+
+//
+// Read markers
+//
+
+type ReadMarkerMemory struct {
+	model.IReadMarkerDS
+	Store *MemoryStore
+}
+
+// Start tracking a channel for the subscriber, from the latest message
+func (m *ReadMarkerMemory) Init(chName string, subscriberName string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	key := memberKey{chName, subscriberName}
+	if _, ok := m.Store.markers[key]; ok {
+		return nil
+	}
+
+	readCreated := time.Time{}
+	for _, msg := range m.Store.messages {
+		if msg.ChannelName == chName && msg.Created.After(readCreated) {
+			readCreated = msg.Created
+		}
+	}
+	if readCreated.IsZero() {
+		readCreated = time.Now().UTC()
+	}
+
+	m.Store.markers[key] = &memoryMarker{readCreated: readCreated}
+	return nil
+}
+
+// Move the read marker up to the message. Markers never move back.
+func (m *ReadMarkerMemory) Set(chName string, subscriberName string, messageId string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	msg, ok := m.Store.messages[messageId]
+	if !ok || msg.ChannelName != chName {
+		return nil
+	}
+
+	key := memberKey{chName, subscriberName}
+	marker, ok := m.Store.markers[key]
+	if !ok {
+		m.Store.markers[key] = &memoryMarker{messageId: messageId, readCreated: msg.Created}
+	} else if marker.readCreated.Before(msg.Created) {
+		marker.messageId = messageId
+		marker.readCreated = msg.Created
+	}
+	return nil
+}
+
+func (m *ReadMarkerMemory) Get(chName string, subscriberName string) (model.IReadMarker, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	key := memberKey{chName, subscriberName}
+	if _, ok := m.Store.markers[key]; !ok {
+		return nil, nil
+	}
+	return m.load(key), nil
+}
+
+// Stop tracking a channel the subscriber left
+func (m *ReadMarkerMemory) Remove(chName string, subscriberName string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	delete(m.Store.markers, memberKey{chName, subscriberName})
+	return nil
+}
+
+// Get the read markers of all channels the subscriber joined
+func (m *ReadMarkerMemory) GetAll(subscriberName string) ([]model.IReadMarker, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	keys := []memberKey{}
+	for key := range m.Store.markers {
+		if key.subscriber == subscriberName {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].channel < keys[j].channel
+	})
+
+	markers := make([]model.IReadMarker, 0, len(keys))
+	for _, key := range keys {
+		markers = append(markers, m.load(key))
+	}
+	return markers, nil
+}
+
+// Messages sent by others after the read marker, and not deleted, are unread.
+// Store must be read locked.
+func (m *ReadMarkerMemory) load(key memberKey) *ReadMarker {
+
+	marker := m.Store.markers[key]
+
+	unread := 0
+	for _, msg := range m.Store.messages {
+		if msg.ChannelName == key.channel && msg.Created.After(marker.readCreated) &&
+			msg.SubscriberName != key.subscriber && !msg.Deleted {
+			unread++
+		}
+	}
+
+	return &ReadMarker{
+		ChannelName:    key.channel,
+		SubscriberName: key.subscriber,
+		MessageId:      marker.messageId,
+		UnreadCount:    unread,
+	}
+}
+
+//
+// Mentions
+//
+
+type MentionMemory struct {
+	model.IMentionDS
+	Store *MemoryStore
+}
+
+// Store a mention not yet seen by the mentioned subscriber
+func (m *MentionMemory) Add(mention model.IMention) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	m.Store.mentions = append(m.Store.mentions, &memoryMention{
+		Mention: Mention{
+			SubscriberName: mention.GetSubscriberName(),
+			ChannelName:    mention.GetChannelName(),
+			MessageId:      mention.GetMessageId(),
+			SenderName:     mention.GetSenderName(),
+			Created:        mention.GetCreated(),
+		},
+	})
+	return nil
+}
+
+// Get unseen mentions of a subscriber, oldest first, and mark them seen
+func (m *MentionMemory) TakeUnseen(subscriberName string) ([]model.IMention, error) {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	mentions := []model.IMention{}
+	for _, stored := range m.Store.mentions {
+		if stored.SubscriberName != subscriberName || stored.seen {
+			continue
+		}
+		stored.seen = true
+
+		copied := stored.Mention
+		if msg, ok := m.Store.messages[copied.MessageId]; ok {
+			copied.Message = msg.Message.Message
+		}
+		mentions = append(mentions, &copied)
+	}
+
+	sort.SliceStable(mentions, func(i, j int) bool {
+		return mentions[i].GetCreated().Before(mentions[j].GetCreated())
+	})
+
+	return mentions, nil
+}
+
+//
+// Attachments
+//
+
+type AttachmentMemory struct {
+	model.IAttachmentDS
+	Store *MemoryStore
+}
+
+func (m *AttachmentMemory) Add(attachment model.IAttachment) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if _, ok := m.Store.attachments[attachment.GetId()]; ok {
+		return ErrDuplicate
+	}
+
+	m.Store.attachments[attachment.GetId()] = &Attachment{
+		Id:             attachment.GetId(),
+		SubscriberName: attachment.GetSubscriberName(),
+		FileName:       attachment.GetFileName(),
+		ContentType:    attachment.GetContentType(),
+		Size:           attachment.GetSize(),
+	}
+	return nil
+}
+
+func (m *AttachmentMemory) Get(id string) (model.IAttachment, error) {
+
+	m.Store.mu.RLock()
+	defer m.Store.mu.RUnlock()
+
+	attachment, ok := m.Store.attachments[id]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *attachment
+	return &copied, nil
+}
+
+// Link an uploaded attachment to the channel message it was sent with
+func (m *AttachmentMemory) Attach(id string, chName string, messageId string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if attachment, ok := m.Store.attachments[id]; ok && attachment.MessageId == "" {
+		attachment.ChannelName = chName
+		attachment.MessageId = messageId
+	}
+	return nil
+}
+
+//
+// Account tokens
+//
+
+type AccountTokenMemory struct {
+	model.IAccountTokenDS
+	Store *MemoryStore
+}
+
+func (m *AccountTokenMemory) Add(token model.IAccountToken) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	if _, ok := m.Store.tokens[token.GetTokenHash()]; ok {
+		return ErrDuplicate
+	}
+
+	m.Store.tokens[token.GetTokenHash()] = &memoryAccountToken{
+		AccountToken: AccountToken{
+			SubscriberName: token.GetSubscriberName(),
+			Purpose:        token.GetPurpose(),
+			TokenHash:      token.GetTokenHash(),
+			Expires:        token.GetExpires(),
+		},
+	}
+	return nil
+}
+
+// Take an unused, unexpired token of the purpose, and mark it used. Nil if none.
+func (m *AccountTokenMemory) Take(tokenHash string, purpose string) (model.IAccountToken, error) {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	stored, ok := m.Store.tokens[tokenHash]
+	if !ok || stored.used || stored.Purpose != purpose || !stored.Expires.After(time.Now()) {
+		return nil, nil
+	}
+	stored.used = true
+
+	copied := stored.AccountToken
+	return &copied, nil
+}
+
+// Delete all tokens of the subscriber of the purpose
+func (m *AccountTokenMemory) DeleteAll(subscriberName string, purpose string) error {
+
+	m.Store.mu.Lock()
+	defer m.Store.mu.Unlock()
+
+	for hash, stored := range m.Store.tokens {
+		if stored.SubscriberName == subscriberName && stored.Purpose == purpose {
+			delete(m.Store.tokens, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHighlight(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		text  string
+		words []string
+		want  string
+	}{
+		{"no match", "hello", []string{"bye"}, "hello"},
+		{"case insensitive", "Hello World", []string{"world"}, "Hello <mark>World</mark>"},
+		{"every match", "go go", []string{"go"}, "<mark>go</mark> <mark>go</mark>"},
+		{"longest word", "database", []string{"data", "database"}, "<mark>database</mark>"},
+		{"escaped text", "<script>x</script>", []string{"x"},
+			"&lt;script&gt;<mark>x</mark>&lt;/script&gt;"},
+		{"escaped match", "a<b", []string{"<"}, "a<mark>&lt;</mark>b"},
+		{"no words", "a&b", []string{}, "a&amp;b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.text, tt.words); got != tt.want {
+				t.Errorf("highlight(%q, %q) = %q, want %q", tt.text, tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageBefore(t *testing.T) {
+
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		a    Message
+		b    Message
+		want bool
+	}{
+		{"lower seq", Message{Seq: 1, Created: now}, Message{Seq: 2, Created: now.Add(-time.Hour)}, true},
+		{"higher seq", Message{Seq: 2}, Message{Seq: 1}, false},
+		{"same seq, earlier", Message{Seq: 1, Created: now}, Message{Seq: 1, Created: now.Add(time.Second)}, true},
+		{"same seq, later", Message{Seq: 1, Created: now.Add(time.Second)}, Message{Seq: 1, Created: now}, false},
+		{"same time, lower id", Message{Id: "a", Created: now}, Message{Id: "b", Created: now}, true},
+		{"same message", Message{Id: "a", Created: now}, Message{Id: "a", Created: now}, false},
+		{"unsequenced first", Message{Created: now}, Message{Seq: 1, Created: now.Add(-time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageBefore(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("messageBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageMemoryGetPage(t *testing.T) {
+	testGetPage(t, &MessageMemory{Store: NewMemoryStore()})
+}
+
+func TestMessageMemorySearch(t *testing.T) {
+	testSearch(t, &MessageMemory{Store: NewMemoryStore()})
+}
+
+func TestReadMarkerMemory(t *testing.T) {
+
+	store := NewMemoryStore()
+	testReadMarker(t, &MessageMemory{Store: store}, &ReadMarkerMemory{Store: store})
+}
+
+func TestAccountTokenMemoryTake(t *testing.T) {
+	testAccountTokenTake(t, &AccountTokenMemory{Store: NewMemoryStore()})
+}
+
+func TestAccountTokenMemoryDeleteAll(t *testing.T) {
+	testAccountTokenDeleteAll(t, &AccountTokenMemory{Store: NewMemoryStore()})
+}
+
+func TestMessageMemoryLastSeq(t *testing.T) {
+	testLastSeq(t, &MessageMemory{Store: NewMemoryStore()})
+}
+
+func TestChannelMemory(t *testing.T) {
+	testChannelDS(t, &ChannelMemory{Store: NewMemoryStore()})
+}
+
+func TestSubscriberMemory(t *testing.T) {
+	testSubscriberDS(t, &SubscriberMemory{Store: NewMemoryStore()})
+}
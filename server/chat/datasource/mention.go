@@ -0,0 +1,191 @@
+package datasource
+
+import (
+	"database/sql"
+	"time"
+	"yt/chat/server/chat/model"
+)
+
+type Mention struct {
+	model.IMention
+	SubscriberName string // Mentioned subscriber
+	ChannelName    string
+	MessageId      string
+	SenderName     string
+	Message        string
+	Created        time.Time
+}
+
+func (m *Mention) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *Mention) GetChannelName() string {
+	return m.ChannelName
+}
+
+func (m *Mention) GetMessageId() string {
+	return m.MessageId
+}
+
+func (m *Mention) GetSenderName() string {
+	return m.SenderName
+}
+
+func (m *Mention) GetMessage() string {
+	return m.Message
+}
+
+func (m *Mention) GetCreated() time.Time {
+	return m.Created
+}
+
+type MentionPgsql struct {
+	model.IMentionDS
+	DbConn *sql.DB
+}
+
+// Store a mention not yet seen by the mentioned subscriber
+func (m *MentionPgsql) Add(mention model.IMention) error {
+
+	sqlStmt := `INSERT INTO mention(subscriber, channel, message_id, sender, created)
+		VALUES($1, $2, $3, $4, $5)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		mention.GetSubscriberName(),
+		mention.GetChannelName(),
+		mention.GetMessageId(),
+		mention.GetSenderName(),
+		mention.GetCreated(),
+	)
+
+	return err
+}
+
+// Get unseen mentions of a subscriber, oldest first, and mark them seen
+func (m *MentionPgsql) TakeUnseen(subscriberName string) ([]model.IMention, error) {
+
+	sqlStmt := `WITH taken AS (
+			UPDATE mention SET seen = TRUE WHERE subscriber = $1 AND NOT seen
+			RETURNING subscriber, channel, message_id, sender, created
+		)
+		SELECT t.subscriber, t.channel, t.message_id, t.sender,
+			COALESCE(msg.message, ''), t.created
+		FROM taken t LEFT JOIN message msg ON msg.id = t.message_id
+		ORDER BY t.created`
+
+	rows, err := m.DbConn.Query(sqlStmt, subscriberName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []model.IMention{}
+	for rows.Next() {
+		mention := &Mention{}
+		err = rows.Scan(
+			&mention.SubscriberName,
+			&mention.ChannelName,
+			&mention.MessageId,
+			&mention.SenderName,
+			&mention.Message,
+			&mention.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, rows.Err()
+}
+
+type MentionSqlite struct {
+	model.IMentionDS
+	DbConn *sql.DB
+}
+
+// Store a mention not yet seen by the mentioned subscriber
+func (m *MentionSqlite) Add(mention model.IMention) error {
+
+	sqlStmt := `INSERT INTO mention(subscriber, channel, message_id, sender, created)
+		VALUES(?, ?, ?, ?, ?)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		mention.GetSubscriberName(),
+		mention.GetChannelName(),
+		mention.GetMessageId(),
+		mention.GetSenderName(),
+		mention.GetCreated().UTC(),
+	)
+
+	return err
+}
+
+// Get unseen mentions of a subscriber, oldest first, and mark them seen
+func (m *MentionSqlite) TakeUnseen(subscriberName string) ([]model.IMention, error) {
+
+	tx, err := m.DbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	sqlStmt := `SELECT t.subscriber, t.channel, t.message_id, t.sender,
+			COALESCE(msg.message, ''), t.created
+		FROM mention t LEFT JOIN message msg ON msg.id = t.message_id
+		WHERE t.subscriber = ? AND NOT t.seen
+		ORDER BY t.created`
+
+	rows, err := tx.Query(sqlStmt, subscriberName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []model.IMention{}
+	for rows.Next() {
+		mention := &Mention{}
+		err = rows.Scan(
+			&mention.SubscriberName,
+			&mention.ChannelName,
+			&mention.MessageId,
+			&mention.SenderName,
+			&mention.Message,
+			&mention.Created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mention)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Same transaction. No mention added after the select is marked seen.
+	_, err = tx.Exec("UPDATE mention SET seen = TRUE WHERE subscriber = ? AND NOT seen", subscriberName)
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, tx.Commit()
+}
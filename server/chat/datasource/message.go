@@ -0,0 +1,1098 @@
+package datasource
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"yt/chat/server/chat/model"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	MESSAGE_ACTION_EDIT   = "edit"
+	MESSAGE_ACTION_DELETE = "delete"
+
+	// Search matches are marked with control characters, and replaced by
+	// <mark> elements once the message text is HTML escaped
+	SNIPPET_START_SEL = "\x02"
+	SNIPPET_STOP_SEL  = "\x03"
+)
+
+var snippetMarker = strings.NewReplacer(SNIPPET_START_SEL, "<mark>", SNIPPET_STOP_SEL, "</mark>")
+
+type Message struct {
+	model.IMessage
+	Id             string
+	ChannelName    string
+	SubscriberId   string
+	SubscriberName string
+	Message        string
+	Created        time.Time
+	Seq            int64 // Order in channel. Zero for messages stored before sequencing
+	Edited         bool
+	Deleted        bool
+	Reactions      map[string]int // Reaction counts by reaction key
+	ParentId       string         // Thread the message replies to. Empty if none
+	ReplyCount     int
+	LastReply      time.Time
+	Attachments    []string // Attachment ids
+	Snippet        string   // Highlighted search match. See Search()
+}
+
+func (m *Message) GetId() string {
+	return m.Id
+}
+
+func (m *Message) GetChannelName() string {
+	return m.ChannelName
+}
+
+func (m *Message) GetSubscriberId() string {
+	return m.SubscriberId
+}
+
+func (m *Message) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *Message) GetMessage() string {
+	return m.Message
+}
+
+func (m *Message) GetCreated() time.Time {
+	return m.Created
+}
+
+func (m *Message) GetSeq() int64 {
+	return m.Seq
+}
+
+func (m *Message) IsEdited() bool {
+	return m.Edited
+}
+
+func (m *Message) IsDeleted() bool {
+	return m.Deleted
+}
+
+func (m *Message) GetReactions() map[string]int {
+	return m.Reactions
+}
+
+func (m *Message) GetParentId() string {
+	return m.ParentId
+}
+
+func (m *Message) GetReplyCount() int {
+	return m.ReplyCount
+}
+
+func (m *Message) GetLastReply() time.Time {
+	return m.LastReply
+}
+
+func (m *Message) GetAttachments() []string {
+	return m.Attachments
+}
+
+func (m *Message) GetSnippet() string {
+	return m.Snippet
+}
+
+type MessageSearch struct {
+	model.IMessageSearch
+	Text     string
+	Channels []string  // Channels to search in. Required
+	Sender   string    // Optional filters
+	From     time.Time // Inclusive
+	To       time.Time // Exclusive
+	Offset   int
+	Limit    int
+}
+
+func (m *MessageSearch) GetText() string {
+	return m.Text
+}
+
+func (m *MessageSearch) GetChannels() []string {
+	return m.Channels
+}
+
+func (m *MessageSearch) GetSender() string {
+	return m.Sender
+}
+
+func (m *MessageSearch) GetFrom() time.Time {
+	return m.From
+}
+
+func (m *MessageSearch) GetTo() time.Time {
+	return m.To
+}
+
+func (m *MessageSearch) GetOffset() int {
+	return m.Offset
+}
+
+func (m *MessageSearch) GetLimit() int {
+	return m.Limit
+}
+
+const messageColumns = `id, channel, subscriber_id, subscriber_name, message, created,
+	COALESCE(seq, 0), edited IS NOT NULL, deleted IS NOT NULL, COALESCE(parent_id::text, '')`
+
+// Scan a row of messageColumns, followed by the extra columns if any
+func scanMessage(row interface{ Scan(dest ...any) error }, extra ...any) (*Message, error) {
+
+	msg := &Message{}
+	dest := []any{
+		&msg.Id,
+		&msg.ChannelName,
+		&msg.SubscriberId,
+		&msg.SubscriberName,
+		&msg.Message,
+		&msg.Created,
+		&msg.Seq,
+		&msg.Edited,
+		&msg.Deleted,
+		&msg.ParentId,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+type MessagePgsql struct {
+	model.IMessageDS
+	DbConn *sql.DB
+}
+
+func (m *MessagePgsql) Add(message model.IMessage) error {
+
+	sqlStmt := `INSERT INTO message(id, channel, subscriber_id, subscriber_name, message, created, seq, parent_id)
+		VALUES($1, $2, $3, $4, $5, $6, NULLIF($7::bigint, 0), NULLIF($8, '')::uuid)`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		message.GetId(),
+		message.GetChannelName(),
+		message.GetSubscriberId(),
+		message.GetSubscriberName(),
+		message.GetMessage(),
+		message.GetCreated(),
+		message.GetSeq(),
+		message.GetParentId(),
+	)
+
+	return err
+}
+
+func (m *MessagePgsql) Get(id string) (model.IMessage, error) {
+
+	sqlStmt := `SELECT ` + messageColumns + ` FROM message WHERE id = $1 LIMIT 1`
+
+	msg, err := scanMessage(m.DbConn.QueryRow(sqlStmt, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Replace the text of a message. The previous text is kept in the edit history.
+func (m *MessagePgsql) Edit(id string, text string, editor string) error {
+
+	sqlStmt := `UPDATE message SET message = $2, edited = CURRENT_TIMESTAMP WHERE id = $1`
+
+	return m.audit(id, MESSAGE_ACTION_EDIT, editor, sqlStmt, id, text)
+}
+
+// Tombstone a message. The deleted text is kept in the edit history.
+func (m *MessagePgsql) Delete(id string, editor string) error {
+
+	sqlStmt := `UPDATE message SET message = '', deleted = CURRENT_TIMESTAMP WHERE id = $1`
+
+	return m.audit(id, MESSAGE_ACTION_DELETE, editor, sqlStmt, id)
+}
+
+// Record the current text of a message in the edit history, then run the change
+func (m *MessagePgsql) audit(id string, action string, editor string, sqlStmt string, args ...any) error {
+
+	tx, err := m.DbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	_, err = tx.Exec(
+		`INSERT INTO message_edit(message_id, action, previous, editor)
+			SELECT id, $2, message, $3 FROM message WHERE id = $1`,
+		id,
+		action,
+		editor,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(sqlStmt, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get the latest messages of a channel, oldest first
+func (m *MessagePgsql) GetRecent(chName string, limit int) ([]model.IMessage, error) {
+	return m.GetPage(chName, "", limit)
+}
+
+// Get messages of a channel sent before the cursor, oldest first. Thread
+// replies are left out. The cursor is either a message id or an RFC3339
+// timestamp. An empty cursor starts from the latest message.
+func (m *MessagePgsql) GetPage(chName string, cursor string, limit int) ([]model.IMessage, error) {
+
+	var rows *sql.Rows
+	var err error
+
+	sqlSelect := `SELECT ` + messageColumns + ` FROM message
+		WHERE channel = $1 AND parent_id IS NULL`
+	sqlOrder := ` ORDER BY COALESCE(seq, 0) DESC, created DESC, id DESC LIMIT $2`
+
+	if cursor == "" {
+		rows, err = m.DbConn.Query(sqlSelect+sqlOrder, chName, limit)
+	} else if _, perr := uuid.Parse(cursor); perr == nil {
+		sqlStmt := sqlSelect +
+			` AND (COALESCE(seq, 0), created, id) <
+				(SELECT COALESCE(seq, 0), created, id FROM message WHERE id = $3)` +
+			sqlOrder
+		rows, err = m.DbConn.Query(sqlStmt, chName, limit, cursor)
+	} else if ts, perr := time.Parse(time.RFC3339Nano, cursor); perr == nil {
+		sqlStmt := sqlSelect + ` AND created < $3` + sqlOrder
+		rows, err = m.DbConn.Query(sqlStmt, chName, limit, ts.UTC())
+	} else {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadReactions(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadThreads(messages); err != nil {
+		return nil, err
+	}
+
+	// Rows are read newest first. Reverse for replay.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// Get the last sequence number of the channel, stored messages, or kept by
+// SetLastSeq. Zero if none.
+func (m *MessagePgsql) GetLastSeq(chName string) (int64, error) {
+
+	sqlStmt := `SELECT GREATEST(
+			(SELECT COALESCE(MAX(seq), 0) FROM message WHERE channel = $1),
+			(SELECT COALESCE(MAX(seq), 0) FROM channel_seq WHERE channel = $1))`
+
+	var seq int64
+	err := m.DbConn.QueryRow(sqlStmt, chName).Scan(&seq)
+
+	return seq, err
+}
+
+// Keep the last sequence number of the channel, if greater than kept before
+func (m *MessagePgsql) SetLastSeq(chName string, seq int64) error {
+
+	sqlStmt := `INSERT INTO channel_seq(channel, seq) VALUES($1, $2)
+		ON CONFLICT (channel) DO UPDATE SET seq = GREATEST(channel_seq.seq, EXCLUDED.seq)`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, seq)
+
+	return err
+}
+
+// Get all replies to a message, oldest first
+func (m *MessagePgsql) GetThread(parentId string) ([]model.IMessage, error) {
+
+	sqlStmt := `SELECT ` + messageColumns + ` FROM message
+		WHERE parent_id = $1 ORDER BY COALESCE(seq, 0), created, id`
+
+	rows, err := m.DbConn.Query(sqlStmt, parentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadReactions(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Add a subscriber's reaction to a message. Returns false if it already exists.
+func (m *MessagePgsql) AddReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	sqlStmt := `INSERT INTO message_reaction(message_id, subscriber, reaction)
+		VALUES($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	result, err := m.DbConn.Exec(sqlStmt, id, subscriberName, reaction)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Remove a subscriber's reaction from a message. Returns false if there was none.
+func (m *MessagePgsql) RemoveReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	sqlStmt := `DELETE FROM message_reaction
+		WHERE message_id = $1 AND subscriber = $2 AND reaction = $3`
+
+	result, err := m.DbConn.Exec(sqlStmt, id, subscriberName, reaction)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Count the subscribers who reacted to a message with the reaction
+func (m *MessagePgsql) CountReactions(id string, reaction string) (int, error) {
+
+	sqlStmt := `SELECT COUNT(*) FROM message_reaction WHERE message_id = $1 AND reaction = $2`
+
+	count := 0
+	err := m.DbConn.QueryRow(sqlStmt, id, reaction).Scan(&count)
+
+	return count, err
+}
+
+// Set the aggregated reaction counts of the messages
+func (m *MessagePgsql) loadReactions(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	sqlStmt := `SELECT message_id, reaction, COUNT(*) FROM message_reaction
+		WHERE message_id = ANY($1::uuid[]) GROUP BY message_id, reaction`
+
+	rows, err := m.DbConn.Query(sqlStmt, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		var count int
+
+		if err = rows.Scan(&id, &reaction, &count); err != nil {
+			return err
+		}
+
+		msg := byId[id]
+		if msg == nil {
+			continue
+		}
+		if msg.Reactions == nil {
+			msg.Reactions = make(map[string]int)
+		}
+		msg.Reactions[reaction] = count
+	}
+
+	return rows.Err()
+}
+
+// Set the reply count, and last reply time of the messages
+func (m *MessagePgsql) loadThreads(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	sqlStmt := `SELECT parent_id, COUNT(*), MAX(created) FROM message
+		WHERE parent_id = ANY($1::uuid[]) GROUP BY parent_id`
+
+	rows, err := m.DbConn.Query(sqlStmt, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var count int
+		var lastReply time.Time
+
+		if err = rows.Scan(&id, &count, &lastReply); err != nil {
+			return err
+		}
+
+		if msg := byId[id]; msg != nil {
+			msg.ReplyCount = count
+			msg.LastReply = lastReply
+		}
+	}
+
+	return rows.Err()
+}
+
+// Set the attachment ids of the messages
+func (m *MessagePgsql) loadAttachments(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	sqlStmt := `SELECT message_id, id FROM attachment
+		WHERE message_id = ANY($1::uuid[]) ORDER BY created`
+
+	rows, err := m.DbConn.Query(sqlStmt, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId, id string
+
+		if err = rows.Scan(&messageId, &id); err != nil {
+			return err
+		}
+
+		if msg := byId[messageId]; msg != nil {
+			msg.Attachments = append(msg.Attachments, id)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Full text search of messages in the given channels, best match first.
+// Deleted messages are excluded.
+func (m *MessagePgsql) Search(search model.IMessageSearch) ([]model.IMessage, error) {
+
+	if len(search.GetChannels()) == 0 {
+		return []model.IMessage{}, nil
+	}
+
+	// Match markers in the message text are removed, so only matches are marked
+	sqlStmt := `SELECT ` + messageColumns + `,
+		ts_headline('english', translate(message, $3, ''), query, $4)
+		FROM message, websearch_to_tsquery('english', $1) query
+		WHERE search @@ query AND deleted IS NULL AND channel = ANY($2)`
+
+	args := []any{
+		search.GetText(),
+		search.GetChannels(),
+		SNIPPET_START_SEL + SNIPPET_STOP_SEL,
+		"StartSel=" + SNIPPET_START_SEL + ", StopSel=" + SNIPPET_STOP_SEL + ", MaxFragments=2",
+	}
+
+	if search.GetSender() != "" {
+		args = append(args, search.GetSender())
+		sqlStmt += fmt.Sprintf(` AND subscriber_name = $%d`, len(args))
+	}
+	if !search.GetFrom().IsZero() {
+		args = append(args, search.GetFrom().UTC())
+		sqlStmt += fmt.Sprintf(` AND created >= $%d`, len(args))
+	}
+	if !search.GetTo().IsZero() {
+		args = append(args, search.GetTo().UTC())
+		sqlStmt += fmt.Sprintf(` AND created < $%d`, len(args))
+	}
+
+	args = append(args, search.GetLimit(), search.GetOffset())
+	sqlStmt += fmt.Sprintf(` ORDER BY ts_rank(search, query) DESC, created DESC, id
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := m.DbConn.Query(sqlStmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		var snippet string
+
+		msg, err := scanMessage(rows, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		// Snippets are HTML. Message text must not be markup.
+		msg.Snippet = snippetMarker.Replace(html.EscapeString(snippet))
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+type MessageSqlite struct {
+	model.IMessageDS
+	DbConn *sql.DB
+}
+
+const messageColumnsSqlite = `id, channel, subscriber_id, subscriber_name, message, created,
+	COALESCE(seq, 0), edited IS NOT NULL, deleted IS NOT NULL, COALESCE(parent_id, '')`
+
+// Placeholders, and arguments of an IN list of ids
+func sqliteIn(ids []string) (string, []any) {
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")", args
+}
+
+// Parse a timestamp computed in a query, e.g. MAX(created). Only column
+// values are converted to time by the driver.
+func parseSqliteTime(value string) (time.Time, error) {
+
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if ts, err := time.ParseInLocation(format, value, time.UTC); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+}
+
+// Created times are stored in UTC, so the stored text sorts in time order
+func (m *MessageSqlite) Add(message model.IMessage) error {
+
+	sqlStmt := `INSERT INTO message(id, channel, subscriber_id, subscriber_name, message, created, seq, parent_id)
+		VALUES(?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''))`
+
+	stmt, err := m.DbConn.Prepare(sqlStmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stmt.Close()
+	}()
+
+	_, err = stmt.Exec(
+		message.GetId(),
+		message.GetChannelName(),
+		message.GetSubscriberId(),
+		message.GetSubscriberName(),
+		message.GetMessage(),
+		message.GetCreated().UTC(),
+		message.GetSeq(),
+		message.GetParentId(),
+	)
+
+	return err
+}
+
+func (m *MessageSqlite) Get(id string) (model.IMessage, error) {
+
+	sqlStmt := `SELECT ` + messageColumnsSqlite + ` FROM message WHERE id = ? LIMIT 1`
+
+	msg, err := scanMessage(m.DbConn.QueryRow(sqlStmt, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Replace the text of a message. The previous text is kept in the edit history.
+func (m *MessageSqlite) Edit(id string, text string, editor string) error {
+
+	sqlStmt := `UPDATE message SET message = ?, edited = ? WHERE id = ?`
+
+	return m.audit(id, MESSAGE_ACTION_EDIT, editor, sqlStmt, text, time.Now().UTC(), id)
+}
+
+// Tombstone a message. The deleted text is kept in the edit history.
+func (m *MessageSqlite) Delete(id string, editor string) error {
+
+	sqlStmt := `UPDATE message SET message = '', deleted = ? WHERE id = ?`
+
+	return m.audit(id, MESSAGE_ACTION_DELETE, editor, sqlStmt, time.Now().UTC(), id)
+}
+
+// Record the current text of a message in the edit history, then run the change
+func (m *MessageSqlite) audit(id string, action string, editor string, sqlStmt string, args ...any) error {
+
+	tx, err := m.DbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	_, err = tx.Exec(
+		`INSERT INTO message_edit(message_id, action, previous, editor)
+			SELECT id, ?, message, ? FROM message WHERE id = ?`,
+		action,
+		editor,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(sqlStmt, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get the latest messages of a channel, oldest first
+func (m *MessageSqlite) GetRecent(chName string, limit int) ([]model.IMessage, error) {
+	return m.GetPage(chName, "", limit)
+}
+
+// Get messages of a channel sent before the cursor, oldest first. Thread
+// replies are left out. The cursor is either a message id or an RFC3339
+// timestamp. An empty cursor starts from the latest message.
+func (m *MessageSqlite) GetPage(chName string, cursor string, limit int) ([]model.IMessage, error) {
+
+	var rows *sql.Rows
+	var err error
+
+	sqlSelect := `SELECT ` + messageColumnsSqlite + ` FROM message
+		WHERE channel = ? AND parent_id IS NULL`
+	sqlOrder := ` ORDER BY COALESCE(seq, 0) DESC, created DESC, id DESC LIMIT ?`
+
+	if cursor == "" {
+		rows, err = m.DbConn.Query(sqlSelect+sqlOrder, chName, limit)
+	} else if _, perr := uuid.Parse(cursor); perr == nil {
+		sqlStmt := sqlSelect +
+			` AND (COALESCE(seq, 0), created, id) <
+				(SELECT COALESCE(seq, 0), created, id FROM message WHERE id = ?)` +
+			sqlOrder
+		rows, err = m.DbConn.Query(sqlStmt, chName, cursor, limit)
+	} else if ts, perr := time.Parse(time.RFC3339Nano, cursor); perr == nil {
+		sqlStmt := sqlSelect + ` AND created < ?` + sqlOrder
+		rows, err = m.DbConn.Query(sqlStmt, chName, ts.UTC(), limit)
+	} else {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadReactions(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadThreads(messages); err != nil {
+		return nil, err
+	}
+
+	// Rows are read newest first. Reverse for replay.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// Get the last sequence number of the channel, stored messages, or kept by
+// SetLastSeq. Zero if none.
+func (m *MessageSqlite) GetLastSeq(chName string) (int64, error) {
+
+	sqlStmt := `SELECT MAX(
+			(SELECT COALESCE(MAX(seq), 0) FROM message WHERE channel = ?),
+			(SELECT COALESCE(MAX(seq), 0) FROM channel_seq WHERE channel = ?))`
+
+	var seq int64
+	err := m.DbConn.QueryRow(sqlStmt, chName, chName).Scan(&seq)
+
+	return seq, err
+}
+
+// Keep the last sequence number of the channel, if greater than kept before
+func (m *MessageSqlite) SetLastSeq(chName string, seq int64) error {
+
+	sqlStmt := `INSERT INTO channel_seq(channel, seq) VALUES(?, ?)
+		ON CONFLICT (channel) DO UPDATE SET seq = MAX(seq, excluded.seq)`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, seq)
+
+	return err
+}
+
+// Get all replies to a message, oldest first
+func (m *MessageSqlite) GetThread(parentId string) ([]model.IMessage, error) {
+
+	sqlStmt := `SELECT ` + messageColumnsSqlite + ` FROM message
+		WHERE parent_id = ? ORDER BY COALESCE(seq, 0), created, id`
+
+	rows, err := m.DbConn.Query(sqlStmt, parentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadReactions(messages); err != nil {
+		return nil, err
+	}
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Add a subscriber's reaction to a message. Returns false if it already exists.
+func (m *MessageSqlite) AddReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	sqlStmt := `INSERT INTO message_reaction(message_id, subscriber, reaction)
+		VALUES(?, ?, ?) ON CONFLICT DO NOTHING`
+
+	result, err := m.DbConn.Exec(sqlStmt, id, subscriberName, reaction)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Remove a subscriber's reaction from a message. Returns false if there was none.
+func (m *MessageSqlite) RemoveReaction(id string, subscriberName string, reaction string) (bool, error) {
+
+	sqlStmt := `DELETE FROM message_reaction
+		WHERE message_id = ? AND subscriber = ? AND reaction = ?`
+
+	result, err := m.DbConn.Exec(sqlStmt, id, subscriberName, reaction)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Count the subscribers who reacted to a message with the reaction
+func (m *MessageSqlite) CountReactions(id string, reaction string) (int, error) {
+
+	sqlStmt := `SELECT COUNT(*) FROM message_reaction WHERE message_id = ? AND reaction = ?`
+
+	count := 0
+	err := m.DbConn.QueryRow(sqlStmt, id, reaction).Scan(&count)
+
+	return count, err
+}
+
+// Set the aggregated reaction counts of the messages
+func (m *MessageSqlite) loadReactions(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	in, args := sqliteIn(ids)
+	sqlStmt := `SELECT message_id, reaction, COUNT(*) FROM message_reaction
+		WHERE message_id IN ` + in + ` GROUP BY message_id, reaction`
+
+	rows, err := m.DbConn.Query(sqlStmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		var count int
+
+		if err = rows.Scan(&id, &reaction, &count); err != nil {
+			return err
+		}
+
+		msg := byId[id]
+		if msg == nil {
+			continue
+		}
+		if msg.Reactions == nil {
+			msg.Reactions = make(map[string]int)
+		}
+		msg.Reactions[reaction] = count
+	}
+
+	return rows.Err()
+}
+
+// Set the reply count, and last reply time of the messages
+func (m *MessageSqlite) loadThreads(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	in, args := sqliteIn(ids)
+	sqlStmt := `SELECT parent_id, COUNT(*), MAX(created) FROM message
+		WHERE parent_id IN ` + in + ` GROUP BY parent_id`
+
+	rows, err := m.DbConn.Query(sqlStmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, lastReply string
+		var count int
+
+		if err = rows.Scan(&id, &count, &lastReply); err != nil {
+			return err
+		}
+
+		if msg := byId[id]; msg != nil {
+			msg.ReplyCount = count
+			msg.LastReply, err = parseSqliteTime(lastReply)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// Set the attachment ids of the messages
+func (m *MessageSqlite) loadAttachments(messages []model.IMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	byId := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.GetId())
+		byId[msg.GetId()] = msg.(*Message)
+	}
+
+	in, args := sqliteIn(ids)
+	sqlStmt := `SELECT message_id, id FROM attachment
+		WHERE message_id IN ` + in + ` ORDER BY created`
+
+	rows, err := m.DbConn.Query(sqlStmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageId, id string
+
+		if err = rows.Scan(&messageId, &id); err != nil {
+			return err
+		}
+
+		if msg := byId[messageId]; msg != nil {
+			msg.Attachments = append(msg.Attachments, id)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Search messages in the given channels that contain all the words, latest
+// first. Deleted messages are excluded. Matching is case insensitive for
+// ASCII letters only, the sqlite LIKE operator has no full text index.
+func (m *MessageSqlite) Search(search model.IMessageSearch) ([]model.IMessage, error) {
+
+	words := strings.Fields(strings.ToLower(search.GetText()))
+	if len(words) == 0 || len(search.GetChannels()) == 0 {
+		return []model.IMessage{}, nil
+	}
+
+	in, args := sqliteIn(search.GetChannels())
+	sqlStmt := `SELECT ` + messageColumnsSqlite + ` FROM message
+		WHERE deleted IS NULL AND channel IN ` + in
+
+	// Words are literal text, not patterns
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	for _, word := range words {
+		args = append(args, "%"+escaper.Replace(word)+"%")
+		sqlStmt += ` AND message LIKE ? ESCAPE '\'`
+	}
+
+	if search.GetSender() != "" {
+		args = append(args, search.GetSender())
+		sqlStmt += ` AND subscriber_name = ?`
+	}
+	if !search.GetFrom().IsZero() {
+		args = append(args, search.GetFrom().UTC())
+		sqlStmt += ` AND created >= ?`
+	}
+	if !search.GetTo().IsZero() {
+		args = append(args, search.GetTo().UTC())
+		sqlStmt += ` AND created < ?`
+	}
+
+	args = append(args, search.GetLimit(), search.GetOffset())
+	sqlStmt += ` ORDER BY COALESCE(seq, 0) DESC, created DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DbConn.Query(sqlStmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.IMessage{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msg.Snippet = highlight(msg.Message, words)
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = m.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
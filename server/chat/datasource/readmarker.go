@@ -0,0 +1,233 @@
+package datasource
+
+import (
+	"database/sql"
+	"time"
+	"yt/chat/server/chat/model"
+)
+
+type ReadMarker struct {
+	model.IReadMarker
+	ChannelName    string
+	SubscriberName string
+	MessageId      string // Last read message. Empty if none read yet
+	UnreadCount    int
+}
+
+func (m *ReadMarker) GetChannelName() string {
+	return m.ChannelName
+}
+
+func (m *ReadMarker) GetSubscriberName() string {
+	return m.SubscriberName
+}
+
+func (m *ReadMarker) GetMessageId() string {
+	return m.MessageId
+}
+
+func (m *ReadMarker) GetUnreadCount() int {
+	return m.UnreadCount
+}
+
+type ReadMarkerPgsql struct {
+	model.IReadMarkerDS
+	DbConn *sql.DB
+}
+
+// Messages sent by others after the read marker, and not deleted, are unread
+const readMarkerColumns = `r.channel, r.subscriber, COALESCE(r.message_id::text, ''),
+	(SELECT COUNT(*) FROM message msg WHERE msg.channel = r.channel
+		AND msg.created > r.read_created AND msg.subscriber_name <> r.subscriber
+		AND msg.deleted IS NULL)`
+
+// Start tracking a channel for the subscriber, from the latest message
+func (m *ReadMarkerPgsql) Init(chName string, subscriberName string) error {
+
+	sqlStmt := `INSERT INTO read_marker(channel, subscriber, read_created)
+		SELECT $1, $2, COALESCE(MAX(created), now() AT TIME ZONE 'utc')
+		FROM message WHERE channel = $1
+		ON CONFLICT (channel, subscriber) DO NOTHING`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName)
+
+	return err
+}
+
+// Move the read marker up to the message. Markers never move back.
+func (m *ReadMarkerPgsql) Set(chName string, subscriberName string, messageId string) error {
+
+	sqlStmt := `INSERT INTO read_marker(channel, subscriber, message_id, read_created)
+		SELECT $1, $2, id, created FROM message WHERE id = $3 AND channel = $1
+		ON CONFLICT (channel, subscriber) DO UPDATE
+		SET message_id = EXCLUDED.message_id, read_created = EXCLUDED.read_created,
+			updated = CURRENT_TIMESTAMP
+		WHERE read_marker.read_created < EXCLUDED.read_created`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName, messageId)
+
+	return err
+}
+
+func (m *ReadMarkerPgsql) Get(chName string, subscriberName string) (model.IReadMarker, error) {
+
+	sqlStmt := `SELECT ` + readMarkerColumns + ` FROM read_marker r
+		WHERE r.channel = $1 AND r.subscriber = $2 LIMIT 1`
+
+	marker := &ReadMarker{}
+	err := m.DbConn.QueryRow(sqlStmt, chName, subscriberName).Scan(
+		&marker.ChannelName,
+		&marker.SubscriberName,
+		&marker.MessageId,
+		&marker.UnreadCount,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+// Stop tracking a channel the subscriber left
+func (m *ReadMarkerPgsql) Remove(chName string, subscriberName string) error {
+
+	sqlStmt := "DELETE FROM read_marker WHERE channel = $1 AND subscriber = $2"
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName)
+
+	return err
+}
+
+// Get the read markers of all channels the subscriber joined
+func (m *ReadMarkerPgsql) GetAll(subscriberName string) ([]model.IReadMarker, error) {
+
+	sqlStmt := `SELECT ` + readMarkerColumns + ` FROM read_marker r
+		WHERE r.subscriber = $1 ORDER BY r.channel`
+
+	rows, err := m.DbConn.Query(sqlStmt, subscriberName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := []model.IReadMarker{}
+	for rows.Next() {
+		marker := &ReadMarker{}
+		err = rows.Scan(
+			&marker.ChannelName,
+			&marker.SubscriberName,
+			&marker.MessageId,
+			&marker.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+
+	return markers, rows.Err()
+}
+
+type ReadMarkerSqlite struct {
+	model.IReadMarkerDS
+	DbConn *sql.DB
+}
+
+// Messages sent by others after the read marker, and not deleted, are unread
+const readMarkerColumnsSqlite = `r.channel, r.subscriber, COALESCE(r.message_id, ''),
+	(SELECT COUNT(*) FROM message msg WHERE msg.channel = r.channel
+		AND msg.created > r.read_created AND msg.subscriber_name <> r.subscriber
+		AND msg.deleted IS NULL)`
+
+// Start tracking a channel for the subscriber, from the latest message
+func (m *ReadMarkerSqlite) Init(chName string, subscriberName string) error {
+
+	sqlStmt := `INSERT INTO read_marker(channel, subscriber, read_created)
+		SELECT ?, ?, COALESCE(MAX(created), ?)
+		FROM message WHERE channel = ?
+		ON CONFLICT (channel, subscriber) DO NOTHING`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName, time.Now().UTC(), chName)
+
+	return err
+}
+
+// Move the read marker up to the message. Markers never move back.
+func (m *ReadMarkerSqlite) Set(chName string, subscriberName string, messageId string) error {
+
+	sqlStmt := `INSERT INTO read_marker(channel, subscriber, message_id, read_created)
+		SELECT ?, ?, id, created FROM message WHERE id = ? AND channel = ?
+		ON CONFLICT (channel, subscriber) DO UPDATE
+		SET message_id = excluded.message_id, read_created = excluded.read_created,
+			updated = ?
+		WHERE read_marker.read_created < excluded.read_created`
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName, messageId, chName, time.Now().UTC())
+
+	return err
+}
+
+func (m *ReadMarkerSqlite) Get(chName string, subscriberName string) (model.IReadMarker, error) {
+
+	sqlStmt := `SELECT ` + readMarkerColumnsSqlite + ` FROM read_marker r
+		WHERE r.channel = ? AND r.subscriber = ? LIMIT 1`
+
+	marker := &ReadMarker{}
+	err := m.DbConn.QueryRow(sqlStmt, chName, subscriberName).Scan(
+		&marker.ChannelName,
+		&marker.SubscriberName,
+		&marker.MessageId,
+		&marker.UnreadCount,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+// Stop tracking a channel the subscriber left
+func (m *ReadMarkerSqlite) Remove(chName string, subscriberName string) error {
+
+	sqlStmt := "DELETE FROM read_marker WHERE channel = ? AND subscriber = ?"
+
+	_, err := m.DbConn.Exec(sqlStmt, chName, subscriberName)
+
+	return err
+}
+
+// Get the read markers of all channels the subscriber joined
+func (m *ReadMarkerSqlite) GetAll(subscriberName string) ([]model.IReadMarker, error) {
+
+	sqlStmt := `SELECT ` + readMarkerColumnsSqlite + ` FROM read_marker r
+		WHERE r.subscriber = ? ORDER BY r.channel`
+
+	rows, err := m.DbConn.Query(sqlStmt, subscriberName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := []model.IReadMarker{}
+	for rows.Next() {
+		marker := &ReadMarker{}
+		err = rows.Scan(
+			&marker.ChannelName,
+			&marker.SubscriberName,
+			&marker.MessageId,
+			&marker.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+
+	return markers, rows.Err()
+}
@@ -0,0 +1,69 @@
+package datasource
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"yt/chat/lib/db"
+	"yt/chat/lib/db/migrate"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open a migrated sqlite database, removed after the test
+func openTestSqlite(t *testing.T) *sql.DB {
+
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "chat.db")
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	migrator, err := migrate.NewMigrator(conn, db.DB_DRIVER_SQLITE)
+	if err != nil {
+		t.Fatalf("NewMigrator() failed: %v", err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatalf("Up() failed: %v", err)
+	}
+
+	return conn
+}
+
+func TestMessageSqliteGetPage(t *testing.T) {
+	testGetPage(t, &MessageSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestMessageSqliteSearch(t *testing.T) {
+	testSearch(t, &MessageSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestReadMarkerSqlite(t *testing.T) {
+
+	conn := openTestSqlite(t)
+	testReadMarker(t, &MessageSqlite{DbConn: conn}, &ReadMarkerSqlite{DbConn: conn})
+}
+
+func TestAccountTokenSqliteTake(t *testing.T) {
+	testAccountTokenTake(t, &AccountTokenSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestAccountTokenSqliteDeleteAll(t *testing.T) {
+	testAccountTokenDeleteAll(t, &AccountTokenSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestMessageSqliteLastSeq(t *testing.T) {
+	testLastSeq(t, &MessageSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestChannelSqlite(t *testing.T) {
+	testChannelDS(t, &ChannelSqlite{DbConn: openTestSqlite(t)})
+}
+
+func TestSubscriberSqlite(t *testing.T) {
+	testSubscriberDS(t, &SubscriberSqlite{DbConn: openTestSqlite(t)})
+}
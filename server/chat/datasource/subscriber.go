@@ -2,7 +2,13 @@ package datasource
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
+	"time"
 	"yt/chat/server/chat/model"
+
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
 )
 
 type SubscriberType string
@@ -12,6 +18,11 @@ const (
 	SUBSCRIBER_TYPE_LOGIN     = "login"
 )
 
+var (
+	ErrDuplicateName  = errors.New("subscriber name exists")
+	ErrDuplicateEmail = errors.New("subscriber email exists")
+)
+
 type Subscriber struct {
 	model.ISubscriber `json:"-"`
 	Id                string `json:"id"`
@@ -65,6 +76,15 @@ func (m *SubscriberPgsql) Add(subscriber model.ISubscriber) error {
 		_, err = stmt.Exec(subscriber.GetName(), subscriber.GetPassword(), subscriber.GetEmail())
 	}
 
+	// Unique name, or email violation
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if strings.HasSuffix(pgErr.ConstraintName, "_email_key") {
+			return ErrDuplicateEmail
+		}
+		return ErrDuplicateName
+	}
+
 	return err
 }
 
@@ -114,7 +134,7 @@ func (m *SubscriberPgsql) Get(subscriber model.ISubscriber) (model.ISubscriber,
 
 	var sqlStmt string
 	if subscriber.(*Subscriber).Type == SUBSCRIBER_TYPE_ANONYMOUS {
-		sqlStmt = "SELECT id, name FROM transient where name = $1 LIMIT 1"
+		sqlStmt = "SELECT id, name, email FROM transient where name = $1 LIMIT 1"
 	} else {
 		sqlStmt = "SELECT id, name, email FROM subscriber where name = $1 LIMIT 1"
 	}
@@ -123,6 +143,59 @@ func (m *SubscriberPgsql) Get(subscriber model.ISubscriber) (model.ISubscriber,
 
 	var subs Subscriber
 
+	err := row.Scan(&subs.Id, &subs.Name, &subs.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	subs.Type = subscriber.(*Subscriber).Type
+
+	return &subs, nil
+}
+
+func (m *SubscriberPgsql) UpdateLastSeen(subscriber model.ISubscriber, lastSeen time.Time) error {
+
+	var sqlStmt string
+	if subscriber.(*Subscriber).Type == SUBSCRIBER_TYPE_ANONYMOUS {
+		sqlStmt = "UPDATE transient SET last_seen = $2 WHERE name = $1"
+	} else {
+		sqlStmt = "UPDATE subscriber SET last_seen = $2 WHERE name = $1"
+	}
+
+	_, err := m.DbConn.Exec(sqlStmt, subscriber.GetName(), lastSeen)
+
+	return err
+}
+
+// Get the last time a subscriber was online. Zero if never seen.
+func (m *SubscriberPgsql) GetLastSeen(name string) (time.Time, error) {
+
+	sqlStmt := `SELECT MAX(last_seen) FROM (
+			SELECT last_seen FROM subscriber WHERE name = $1
+			UNION ALL
+			SELECT last_seen FROM transient WHERE name = $1
+		) seen`
+
+	var lastSeen sql.NullTime
+
+	err := m.DbConn.QueryRow(sqlStmt, name).Scan(&lastSeen)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lastSeen.Time, nil
+}
+
+func (m *SubscriberPgsql) GetByEmail(email string) (model.ISubscriber, error) {
+
+	sqlStmt := "SELECT id, name, email FROM subscriber WHERE email = $1 LIMIT 1"
+
+	row := m.DbConn.QueryRow(sqlStmt, email)
+
+	subs := Subscriber{Type: SUBSCRIBER_TYPE_LOGIN}
+
 	err := row.Scan(&subs.Id, &subs.Name, &subs.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -133,3 +206,196 @@ func (m *SubscriberPgsql) Get(subscriber model.ISubscriber) (model.ISubscriber,
 
 	return &subs, nil
 }
+
+func (m *SubscriberPgsql) SetEmailVerified(name string, verified time.Time) error {
+
+	sqlStmt := "UPDATE subscriber SET email_verified = $2, updated = $2 WHERE name = $1"
+
+	_, err := m.DbConn.Exec(sqlStmt, name, verified.UTC())
+
+	return err
+}
+
+// Password is the stored hash. See auth.HashString()
+func (m *SubscriberPgsql) SetPassword(name string, password string) error {
+
+	sqlStmt := "UPDATE subscriber SET password = $2, updated = $3 WHERE name = $1"
+
+	_, err := m.DbConn.Exec(sqlStmt, name, password, time.Now().UTC())
+
+	return err
+}
+
+type SubscriberSqlite struct {
+	model.ISubscriberDS
+	DbConn *sql.DB
+}
+
+// Registered, or anonymous subscribers table by the subscriber type
+func subscriberTable(subscriber model.ISubscriber) string {
+
+	if subscriber.(*Subscriber).Type == SUBSCRIBER_TYPE_ANONYMOUS {
+		return "transient"
+	}
+	return "subscriber"
+}
+
+func (m *SubscriberSqlite) Add(subscriber model.ISubscriber) error {
+
+	var err error
+	if subscriber.(*Subscriber).Type == SUBSCRIBER_TYPE_ANONYMOUS {
+		_, err = m.DbConn.Exec("INSERT INTO transient(name, email) VALUES(?, ?)",
+			subscriber.GetName(), subscriber.GetEmail())
+	} else {
+		_, err = m.DbConn.Exec("INSERT INTO subscriber(name, password, email) VALUES(?, ?, ?)",
+			subscriber.GetName(), subscriber.GetPassword(), subscriber.GetEmail())
+	}
+
+	// Unique name, or email violation. e.g. "UNIQUE constraint failed: subscriber.email"
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		if strings.HasSuffix(sqliteErr.Error(), ".email") {
+			return ErrDuplicateEmail
+		}
+		return ErrDuplicateName
+	}
+
+	return err
+}
+
+func (m *SubscriberSqlite) Remove(subscriber model.ISubscriber) error {
+
+	sqlStmt := "DELETE FROM " + subscriberTable(subscriber) + " WHERE name = ?"
+
+	_, err := m.DbConn.Exec(sqlStmt, subscriber.GetName())
+
+	return err
+}
+
+// Works only for subscribers - registered users
+func (m *SubscriberSqlite) GetLoginInfo(subscriber model.ISubscriber) (model.ISubscriber, error) {
+
+	sqlStmt := "SELECT name, password FROM subscriber WHERE name = ? LIMIT 1"
+
+	row := m.DbConn.QueryRow(sqlStmt, subscriber.GetName())
+
+	var subs Subscriber
+
+	err := row.Scan(&subs.Name, &subs.Password)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &subs, nil
+}
+
+func (m *SubscriberSqlite) Get(subscriber model.ISubscriber) (model.ISubscriber, error) {
+
+	sqlStmt := "SELECT id, name, email FROM " + subscriberTable(subscriber) + " WHERE name = ? LIMIT 1"
+
+	row := m.DbConn.QueryRow(sqlStmt, subscriber.GetName())
+
+	var subs Subscriber
+
+	err := row.Scan(&subs.Id, &subs.Name, &subs.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	subs.Type = subscriber.(*Subscriber).Type
+
+	return &subs, nil
+}
+
+func (m *SubscriberSqlite) GetAll() ([]model.ISubscriber, error) {
+
+	rows, err := m.DbConn.Query("SELECT id, name, email FROM subscriber ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscribers := []model.ISubscriber{}
+	for rows.Next() {
+		subs := &Subscriber{Type: SUBSCRIBER_TYPE_LOGIN}
+		if err = rows.Scan(&subs.Id, &subs.Name, &subs.Email); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subs)
+	}
+
+	return subscribers, rows.Err()
+}
+
+func (m *SubscriberSqlite) UpdateLastSeen(subscriber model.ISubscriber, lastSeen time.Time) error {
+
+	sqlStmt := "UPDATE " + subscriberTable(subscriber) + " SET last_seen = ? WHERE name = ?"
+
+	_, err := m.DbConn.Exec(sqlStmt, lastSeen.UTC(), subscriber.GetName())
+
+	return err
+}
+
+// Get the last time a subscriber was online. Zero if never seen.
+func (m *SubscriberSqlite) GetLastSeen(name string) (time.Time, error) {
+
+	var lastSeen time.Time
+
+	for _, table := range []string{"subscriber", "transient"} {
+
+		var seen sql.NullTime
+
+		err := m.DbConn.QueryRow("SELECT last_seen FROM "+table+" WHERE name = ?", name).Scan(&seen)
+		if err != nil && err != sql.ErrNoRows {
+			return time.Time{}, err
+		}
+		if seen.Valid && seen.Time.After(lastSeen) {
+			lastSeen = seen.Time
+		}
+	}
+
+	return lastSeen, nil
+}
+
+func (m *SubscriberSqlite) GetByEmail(email string) (model.ISubscriber, error) {
+
+	sqlStmt := "SELECT id, name, email FROM subscriber WHERE email = ? LIMIT 1"
+
+	row := m.DbConn.QueryRow(sqlStmt, email)
+
+	subs := Subscriber{Type: SUBSCRIBER_TYPE_LOGIN}
+
+	err := row.Scan(&subs.Id, &subs.Name, &subs.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &subs, nil
+}
+
+func (m *SubscriberSqlite) SetEmailVerified(name string, verified time.Time) error {
+
+	sqlStmt := "UPDATE subscriber SET email_verified = ?, updated = ? WHERE name = ?"
+
+	_, err := m.DbConn.Exec(sqlStmt, verified.UTC(), verified.UTC(), name)
+
+	return err
+}
+
+// Password is the stored hash. See auth.HashString()
+func (m *SubscriberSqlite) SetPassword(name string, password string) error {
+
+	sqlStmt := "UPDATE subscriber SET password = ?, updated = ? WHERE name = ?"
+
+	_, err := m.DbConn.Exec(sqlStmt, password, time.Now().UTC(), name)
+
+	return err
+}
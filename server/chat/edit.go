@@ -0,0 +1,83 @@
+package chat
+
+// Edit, or delete a stored channel message. Only the sender, or a channel
+// moderator may change a message. Anonymous subscribers choose their names,
+// so they can not prove they sent a message, and may change none.
+func (m *Session) editMessage(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	if isAnonymous(m.Subscriber) {
+		message.Message = "Not allowed to change the message"
+		m.send(message)
+		return
+	}
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	if message.RequestType == REQ_EDIT_MESSAGE && message.Message == "" {
+		message.Message = "Please delete the message instead"
+		m.send(message)
+		return
+	}
+
+	record, err := channel.messageDs.Get(message.MessageId)
+	if err != nil {
+		logger.Error("Get message failed: " + err.Error())
+	}
+	if record == nil || record.GetChannelName() != channel.Name || record.IsDeleted() {
+		message.Message = "Message not found"
+		m.send(message)
+		return
+	}
+
+	allowed := record.GetSubscriberName() == m.Subscriber.Name
+	if !allowed {
+		allowed, err = channel.isModerator(m.Subscriber.Name)
+		if err != nil {
+			logger.Error("Get channel member failed: " + err.Error())
+		}
+	}
+	if !allowed {
+		message.Message = "Not allowed to change the message"
+		m.send(message)
+		return
+	}
+
+	if message.RequestType == REQ_EDIT_MESSAGE {
+		err = channel.messageDs.Edit(record.GetId(), message.Message, m.Subscriber.Name)
+	} else {
+		err = channel.messageDs.Delete(record.GetId(), m.Subscriber.Name)
+	}
+	if err != nil {
+		logger.Error("Change message failed: " + err.Error())
+		message.Message = "Can not change the message"
+		m.send(message)
+		return
+	}
+
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+
+	// Let channel members update, or tombstone the message in place
+	update := NewMessage(MSGTYPE_BCAST)
+	update.RequestType = REQ_SEND_MESSAGE
+	update.RequestSubType = message.RequestType
+	update.ChannelName = channel.Name
+	update.Session = m
+	update.MessageId = record.GetId()
+	if message.RequestType == REQ_EDIT_MESSAGE {
+		update.Message = message.Message
+		update.Edited = true
+	} else {
+		update.Deleted = true
+	}
+
+	channel.broadcast <- update
+}
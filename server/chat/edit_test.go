@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEditMessage(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice") // Owner, who opens the channel
+	bob := server.connect(t, "bob")
+	carol := server.connect(t, "carol")
+	alice.join("general")
+	bob.join("general")
+	carol.join("general")
+
+	sent := bob.say("general", "hello")
+	messageId := sent.MessageId
+
+	// Anonymous subscribers may take the sender's name
+	impostor := server.connectAnonymous(t, "bob")
+	impostor.join("general")
+
+	tests := []struct {
+		name    string
+		client  *testClient
+		request string
+		text    string
+		status  string
+	}{
+		{"anonymous namesake edits", impostor, REQ_EDIT_MESSAGE, "spoofed", STATUS_FAILED},
+		{"anonymous namesake deletes", impostor, REQ_DELETE_MESSAGE, "", STATUS_FAILED},
+		{"member edits another's", carol, REQ_EDIT_MESSAGE, "changed", STATUS_FAILED},
+		{"sender clears the text", bob, REQ_EDIT_MESSAGE, "", STATUS_FAILED},
+		{"sender edits", bob, REQ_EDIT_MESSAGE, "hello, all", STATUS_SUCCESS},
+		{"owner deletes", alice, REQ_DELETE_MESSAGE, "", STATUS_SUCCESS},
+		{"sender edits deleted", bob, REQ_EDIT_MESSAGE, "again", STATUS_FAILED},
+	}
+
+	for _, tt := range tests {
+
+		ack := tt.client.request(&Message{
+			RequestType: tt.request,
+			ChannelName: "general",
+			MessageId:   messageId,
+			Message:     tt.text,
+		})
+		if ack.Status != tt.status {
+			t.Fatalf("%s: %s (%s), want %s", tt.name, ack.Status, ack.Message, tt.status)
+		}
+		if tt.status != STATUS_SUCCESS {
+			continue
+		}
+
+		// Members update the message in place
+		update := carol.expect(func(message *Message) bool {
+			return message.MessageType == MSGTYPE_BCAST && message.RequestSubType == tt.request
+		})
+		if update.MessageId != messageId || update.Message != tt.text {
+			t.Errorf("%s: update of %s to %q, want %s to %q", tt.name, update.MessageId, update.Message, messageId, tt.text)
+		}
+	}
+
+	// Failed requests change nothing
+	carol.expectNone(func(message *Message) bool {
+		return message.MessageType == MSGTYPE_BCAST && message.Message == "spoofed"
+	}, 100*time.Millisecond)
+
+	record, err := server.messageDs.Get(messageId)
+	if err != nil || record == nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if !record.IsDeleted() {
+		t.Error("message not deleted")
+	}
+}
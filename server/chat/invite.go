@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"fmt"
+	"yt/chat/server/chat/datasource"
+)
+
+const INVITE_MESSAGE_FORMAT = "%s invited you to %s"
+
+// Invite a subscriber to a private channel the session has joined
+func (m *Session) inviteChannel(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	if message.Target == "" || message.Target == m.Subscriber.Name {
+		message.Message = "Please specify the subscriber to invite"
+		m.send(message)
+		return
+	}
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	// Public channels need no invitation. Two party channels can not have more.
+	if !channel.IsPrivate() || isPrivateChannelName(channel.Name) {
+		message.Message = "Can not invite to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	// Only registered subscribers can be invited. Anonymous names are not owned.
+	target, err := m.wsSrvr.subsciberDs.Get(&datasource.Subscriber{
+		Name: message.Target,
+		Type: datasource.SUBSCRIBER_TYPE_LOGIN,
+	})
+	if err != nil || target == nil {
+		if err != nil {
+			logger.Error("Get subscriber failed: " + err.Error())
+		}
+		message.Message = "Can not invite " + message.Target
+		m.send(message)
+		return
+	}
+
+	memberDs := m.wsSrvr.memberDs
+
+	member, err := memberDs.Get(channel.Name, message.Target)
+	if err != nil {
+		logger.Error("Get channel member failed: " + err.Error())
+		message.Message = "Can not invite " + message.Target
+		m.send(message)
+		return
+	}
+	if member != nil {
+		message.Message = message.Target + " is already " + member.GetStatus()
+		m.send(message)
+		return
+	}
+
+	err = memberDs.Add(&datasource.ChannelMember{
+		ChannelName:    channel.Name,
+		SubscriberName: message.Target,
+		Status:         datasource.MEMBER_STATUS_INVITED,
+		InvitedBy:      m.Subscriber.Name,
+		Role:           datasource.MEMBER_ROLE_MEMBER,
+	})
+	if err != nil {
+		logger.Error("Add channel member failed: " + err.Error())
+		message.Message = "Can not invite " + message.Target
+		m.send(message)
+		return
+	}
+
+	// Notify the invited subscriber, on whichever server they are connected
+	request := NewMessage(MSGTYPE_BCAST)
+	request.RequestType = REQ_INVITE_CHANNEL
+	request.ChannelName = channel.Name
+	request.Session = m
+	request.Target = message.Target
+	request.Message = fmt.Sprintf(INVITE_MESSAGE_FORMAT, m.Subscriber.Name, channel.Name)
+
+	err = m.wsSrvr.publish(request)
+	if err != nil {
+		// Invitation is delivered on the next sign-in
+		logger.Error("Publish invitation failed: " + err.Error())
+	}
+
+	message.Status = STATUS_SUCCESS
+	message.Message = "Invited " + message.Target
+	m.send(message)
+}
+
+// Accept a pending invitation and join the private channel
+func (m *Session) acceptInvite(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	member, err := m.getInvite(message.ChannelName)
+	if err != nil || member == nil {
+		message.Message = "No invitation to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	member.Status = datasource.MEMBER_STATUS_JOINED
+	err = m.wsSrvr.memberDs.Update(member)
+	if err == nil {
+		_, err = m.joinChannel(message.ChannelName, m.Subscriber)
+	}
+	if err != nil {
+		logger.Error("Accept invitation failed: " + err.Error())
+		message.Message = "Can not join channel " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	message.Status = STATUS_SUCCESS
+	message.Message = "Welcome to " + message.ChannelName
+	m.send(message)
+}
+
+// Decline a pending invitation
+func (m *Session) declineInvite(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	member, err := m.getInvite(message.ChannelName)
+	if err != nil || member == nil {
+		message.Message = "No invitation to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	err = m.wsSrvr.memberDs.Remove(member.ChannelName, member.SubscriberName)
+	if err != nil {
+		logger.Error("Decline invitation failed: " + err.Error())
+		message.Message = "Can not decline invitation to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	message.Status = STATUS_SUCCESS
+	message.Message = "Declined invitation to " + message.ChannelName
+	m.send(message)
+}
+
+// Get the pending invitation of the session subscriber to a channel
+func (m *Session) getInvite(channelName string) (*datasource.ChannelMember, error) {
+
+	if isAnonymous(m.Subscriber) {
+		return nil, nil
+	}
+
+	member, err := m.wsSrvr.memberDs.Get(channelName, m.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get channel member failed: " + err.Error())
+		return nil, err
+	}
+	if member == nil || member.GetStatus() != datasource.MEMBER_STATUS_INVITED {
+		return nil, nil
+	}
+
+	return member.(*datasource.ChannelMember), nil
+}
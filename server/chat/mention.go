@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+)
+
+const MAX_MENTIONS = 10 // Max. subscribers notified per message
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]+)`)
+
+// Get the unique @names in a message, in order of appearance. Trailing
+// punctuation is not part of the name, e.g. "Thanks @bob."
+func parseMentions(text string) []string {
+
+	names := []string{}
+	unique := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if name != "" && !unique[name] {
+			unique[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Notify the subscribers mentioned in a channel message. Subscribers not
+// online get the mention on their next sign-in.
+func (m *Session) notifyMentions(channel *Channel, message *Message) {
+
+	names := parseMentions(message.Message)
+	if len(names) > MAX_MENTIONS {
+		names = names[:MAX_MENTIONS]
+	}
+
+	for _, name := range names {
+
+		if name == m.Subscriber.Name {
+			continue
+		}
+
+		subscriber, err := m.wsSrvr.findSubscriber(name)
+		if err != nil {
+			logger.Error("Get subscriber failed: " + err.Error())
+			continue
+		}
+		if subscriber == nil {
+			continue
+		}
+
+		// Keep private channel messages to members
+		if channel.IsPrivate() {
+			ok, err := m.wsSrvr.isChannelMember(channel.Name, name)
+			if err != nil || !ok {
+				continue
+			}
+		}
+
+		presence, err := m.wsSrvr.getPresence(name)
+		if err != nil {
+			logger.Error("Get presence failed: " + err.Error())
+		}
+
+		// Keep the mention unless the subscriber is known to be online
+		if err != nil || presence == PRESENCE_OFFLINE {
+			err = m.wsSrvr.mentionDs.Add(&datasource.Mention{
+				SubscriberName: name,
+				ChannelName:    channel.Name,
+				MessageId:      message.Id.String(),
+				SenderName:     m.Subscriber.Name,
+				Created:        time.Now().UTC(),
+			})
+			if err != nil {
+				logger.Error("Add mention failed: " + err.Error())
+			}
+			continue
+		}
+
+		// Deliver to all sessions, on whichever server they are connected
+		mention := NewMessage(MSGTYPE_BCAST)
+		mention.RequestType = REQ_MENTION
+		mention.ChannelName = channel.Name
+		mention.Session = m
+		mention.Target = name
+		mention.MessageId = message.Id.String()
+		mention.Message = message.Message
+
+		err = m.wsSrvr.publish(mention)
+		if err != nil {
+			logger.Error("Publish mention failed: " + err.Error())
+		}
+	}
+}
+
+// Find a registered, or anonymous subscriber by name
+func (m *Server) findSubscriber(name string) (model.ISubscriber, error) {
+
+	for _, subscriberType := range []string{
+		datasource.SUBSCRIBER_TYPE_LOGIN,
+		datasource.SUBSCRIBER_TYPE_ANONYMOUS,
+	} {
+		subscriber, err := m.subsciberDs.Get(&datasource.Subscriber{
+			Name: name,
+			Type: subscriberType,
+		})
+		if err != nil || subscriber != nil {
+			return subscriber, err
+		}
+	}
+
+	return nil, nil
+}
+
+// Send mentions received while offline to a new session
+func (m *Server) sendMentions(session *Session) {
+
+	mentions, err := m.mentionDs.TakeUnseen(session.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get mentions failed: " + err.Error())
+		return
+	}
+
+	for _, mention := range mentions {
+		message := NewMessage(MSGTYPE_BCAST)
+		message.RequestType = REQ_MENTION
+		message.ChannelName = mention.GetChannelName()
+		message.Session = &Session{
+			Subscriber: &datasource.Subscriber{Name: mention.GetSenderName()},
+		}
+		message.Target = session.Subscriber.Name
+		message.MessageId = mention.GetMessageId()
+		message.Message = mention.GetMessage()
+		session.send(message)
+	}
+}
@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "hello", []string{}},
+		{"single", "hi @bob", []string{"bob"}},
+		{"start of text", "@bob hi", []string{"bob"}},
+		{"in order", "@carol and @bob", []string{"carol", "bob"}},
+		{"unique", "@bob @bob", []string{"bob"}},
+		{"trailing period", "Thanks @bob.", []string{"bob"}},
+		{"trailing dash", "@bob- see above", []string{"bob"}},
+		{"dots in name", "cc @bob.smith", []string{"bob.smith"}},
+		{"punctuation only", "@. @-", []string{}},
+		{"email", "mail bob@example.com", []string{}},
+		{"double at", "@@bob", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMentions(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
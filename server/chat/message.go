@@ -2,7 +2,10 @@ package chat
 
 import (
 	"encoding/json"
+	"time"
 	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
 
 	"github.com/google/uuid"
 )
@@ -14,15 +17,55 @@ import (
 const (
 	REQ_SEND_MESSAGE = "message"
 
+	REQ_EDIT_MESSAGE   = "edit-message"
+	REQ_DELETE_MESSAGE = "delete-message"
+
+	REQ_ADD_REACTION    = "add-reaction"
+	REQ_REMOVE_REACTION = "remove-reaction"
+
+	REQ_MARK_READ    = "mark-read"
+	REQ_UNREAD_COUNT = "unread-count"
+
+	REQ_MENTION = "mention"
+
+	REQ_TYPING_START = "typing-start"
+	REQ_TYPING_STOP  = "typing-stop"
+
 	REQ_JOIN_CHANNEL   = "join-channel"
 	REQ_LEAVE_CHANNEL  = "leave-channel"
 	REQ_JOINED_CHANNEL = "joined-channel"
+	REQ_FETCH_HISTORY  = "fetch-history"
+	REQ_FETCH_THREAD   = "fetch-thread"
+
+	REQ_SEARCH = "search"
+
+	REQ_RESUME       = "resume"
+	REQ_RESUME_TOKEN = "resume-token"
+
+	REQ_REVOKE_SESSIONS = "revoke-sessions"
 
 	REQ_SUBSCRIBER_JOINED = "subscriber-joined"
 	REQ_SUBSCRIBER_LEFT   = "subscriber-left"
 
+	REQ_PRESENCE     = "presence"
+	REQ_SET_PRESENCE = "set-presence"
+	REQ_GET_PRESENCE = "get-presence"
+
 	REQ_JOIN_PRIVATE_CHANNEL = "join-private-channel"
 
+	REQ_INVITE_CHANNEL = "invite-channel"
+	REQ_ACCEPT_INVITE  = "accept-invite"
+	REQ_DECLINE_INVITE = "decline-invite"
+
+	REQ_KICK     = "kick"
+	REQ_BAN      = "ban"
+	REQ_UNBAN    = "unban"
+	REQ_MUTE     = "mute"
+	REQ_UNMUTE   = "unmute"
+	REQ_SET_ROLE = "set-role"
+
+	REQ_CHANNEL_HISTORY = "channel-history"
+
 	STATUS_SUCCESS = "success"
 	STATUS_FAILED  = "failed"
 )
@@ -48,6 +91,55 @@ type Message struct {
 	ChannelName    string      `json:"channelname"`
 	Session        *Session    `json:"session"`
 	Status         string      `json:"status"`
+	Seq            int64       `json:"seq,omitempty"`     // Channel order of broadcast messages
+	Created        *time.Time  `json:"created,omitempty"` // Server time of broadcast messages
+	Target         string      `json:"target,omitempty"`  // Subscriber name the request is addressed to
+	Private        bool        `json:"private,omitempty"` // Create channel as private on join
+	Role           string      `json:"role,omitempty"`    // Channel role of the target subscriber
+
+	// Stored channel message the request refers to, and its state
+	MessageId string `json:"messageid,omitempty"`
+	Edited    bool   `json:"edited,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+
+	// Reaction key of a reaction request, and reaction counts by key
+	Reaction  string         `json:"reaction,omitempty"`
+	Reactions map[string]int `json:"reactions,omitempty"`
+
+	// Thread a message replies to. Reply stats are set on thread parents.
+	ParentId   string     `json:"parentid,omitempty"`
+	ReplyCount int        `json:"replycount,omitempty"`
+	LastReply  *time.Time `json:"lastreply,omitempty"`
+
+	// Uploaded attachment ids sent with the message. See POST /attachments
+	Attachments []string `json:"attachments,omitempty"`
+
+	// Num. of unread channel messages. See REQ_MARK_READ
+	Unread *int `json:"unread,omitempty"`
+
+	// Subscriber presence. See REQ_GET_PRESENCE
+	Presence     string      `json:"presence,omitempty"`
+	Targets      []string    `json:"targets,omitempty"`
+	PresenceList []*Presence `json:"presencelist,omitempty"`
+
+	// Search filters, and highlighted match of results. See REQ_SEARCH
+	// Snippets are HTML escaped text, with matches in <mark> elements.
+	Sender  string     `json:"sender,omitempty"`
+	From    *time.Time `json:"from,omitempty"`
+	To      *time.Time `json:"to,omitempty"`
+	Snippet string     `json:"snippet,omitempty"`
+
+	// Session resume token, and last sequence seen by channel. See REQ_RESUME
+	ResumeToken string           `json:"resumetoken,omitempty"`
+	LastSeq     map[string]int64 `json:"lastseq,omitempty"`
+
+	// Channel history paging. See REQ_FETCH_HISTORY
+	Cursor   string     `json:"cursor,omitempty"`
+	PageSize int        `json:"pagesize,omitempty"`
+	History  []*Message `json:"history,omitempty"`
+
+	// Result of storing a sent message. See Channel.storeMessage()
+	stored chan bool
 }
 
 func NewMessage(messageType MessageType) *Message {
@@ -70,6 +162,81 @@ func (m *Message) Decode(data *string) error {
 	return json.Unmarshal([]byte(*data), m)
 }
 
+// Keep only the fields a subscriber sets on a new channel message. Message
+// state, e.g. edits, reactions and reply stats, and stamps are the server's.
+func (m *Message) clearServerFields() {
+
+	*m = Message{
+		Id:          m.Id,
+		MessageType: m.MessageType,
+		RequestType: m.RequestType,
+		ChannelName: m.ChannelName,
+		Message:     m.Message,
+		Session:     m.Session,
+		ParentId:    m.ParentId,
+		Attachments: m.Attachments,
+	}
+}
+
+// Convert a channel message to its data source record
+func (m *Message) toRecord() *datasource.Message {
+
+	created := time.Now().UTC()
+	if m.Created != nil {
+		created = *m.Created
+	}
+
+	return &datasource.Message{
+		Id:             m.Id.String(),
+		ChannelName:    m.ChannelName,
+		SubscriberId:   m.Session.Subscriber.Id,
+		SubscriberName: m.Session.Subscriber.Name,
+		Message:        m.Message,
+		Created:        created,
+		Seq:            m.Seq,
+		ParentId:       m.ParentId,
+	}
+}
+
+// Restore a channel message from its data source record
+func newMessageFromRecord(record model.IMessage) *Message {
+
+	id, _ := uuid.Parse(record.GetId())
+
+	created := record.GetCreated().UTC()
+
+	var lastReply *time.Time
+	if record.GetReplyCount() > 0 {
+		ts := record.GetLastReply().UTC()
+		lastReply = &ts
+	}
+
+	return &Message{
+		Id:             id,
+		MessageType:    MSGTYPE_BCAST,
+		RequestType:    REQ_SEND_MESSAGE,
+		RequestSubType: REQ_CHANNEL_HISTORY,
+		Seq:            record.GetSeq(),
+		Created:        &created,
+		Message:        record.GetMessage(),
+		ChannelName:    record.GetChannelName(),
+		Edited:         record.IsEdited(),
+		Deleted:        record.IsDeleted(),
+		Reactions:      record.GetReactions(),
+		ParentId:       record.GetParentId(),
+		ReplyCount:     record.GetReplyCount(),
+		LastReply:      lastReply,
+		Attachments:    record.GetAttachments(),
+		Snippet:        record.GetSnippet(),
+		Session: &Session{
+			Subscriber: &datasource.Subscriber{
+				Id:   record.GetSubscriberId(),
+				Name: record.GetSubscriberName(),
+			},
+		},
+	}
+}
+
 //
 // Http request, response messaging
 //
@@ -80,4 +247,20 @@ type AppResponse struct {
 	Email   string          `json:"email"`
 	Status  string          `json:"status"`
 	Message string          `json:"message"`
+	Code    string          `json:"code,omitempty"` // Failure reason. e.g. See REGISTER_ERR_*
+}
+
+type SearchResponse struct {
+	Results  []*Message `json:"results"`
+	Cursor   string     `json:"cursor,omitempty"` // Next page. Empty on last page
+	PageSize int        `json:"pagesize"`
+	Status   string     `json:"status"`
+}
+
+type AttachmentResponse struct {
+	Id          string `json:"id"`
+	FileName    string `json:"filename"`
+	ContentType string `json:"contenttype"`
+	Size        int64  `json:"size"`
+	Status      string `json:"status"`
 }
@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+
+	"github.com/google/uuid"
+)
+
+func TestSendMessage(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	// Client ids are not unique, nor trusted
+	requestId := uuid.New()
+	storedIds := map[string]bool{}
+
+	for i := 0; i < 2; i++ {
+
+		alice.send(&Message{Id: requestId, RequestType: REQ_SEND_MESSAGE, ChannelName: "general", Message: "hello"})
+
+		ack := alice.expect(isAck(REQ_SEND_MESSAGE))
+		if ack.Status != STATUS_SUCCESS || ack.Id != requestId {
+			t.Fatalf("ack %s %s of request %s, want success of %s", ack.Status, ack.Message, ack.Id, requestId)
+		}
+		if ack.MessageId == "" || ack.MessageId == requestId.String() || ack.Seq == 0 {
+			t.Errorf("ack of stored message %q, seq %d, want a server id, and seq", ack.MessageId, ack.Seq)
+		}
+		storedIds[ack.MessageId] = true
+
+		received := bob.expect(isChannelMessage("hello"))
+		if received.Id.String() != ack.MessageId || received.Seq != ack.Seq {
+			t.Errorf("received %s, seq %d, want %s, seq %d", received.Id, received.Seq, ack.MessageId, ack.Seq)
+		}
+	}
+
+	records, err := server.messageDs.GetRecent("general", 10)
+	if err != nil {
+		t.Fatalf("GetRecent() failed: %v", err)
+	}
+	for _, record := range records {
+		delete(storedIds, record.GetId())
+	}
+	if len(records) != 2 || len(storedIds) != 0 {
+		t.Errorf("%d messages stored, want both acknowledged ones", len(records))
+	}
+}
+
+func TestJoinReplaysHistory(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	alice.join("general")
+
+	sent := HISTORY_REPLAY_SIZE + 2
+	for i := 1; i <= sent; i++ {
+		alice.say("general", fmt.Sprint("message ", i))
+	}
+
+	// Latest messages, oldest first, before live traffic
+	carol := server.connect(t, "carol")
+	carol.send(&Message{RequestType: REQ_JOIN_CHANNEL, ChannelName: "general"})
+
+	for i := sent - HISTORY_REPLAY_SIZE + 1; i <= sent; i++ {
+		replayed := carol.expect(isBroadcast(REQ_SEND_MESSAGE))
+		if replayed.Message != fmt.Sprint("message ", i) || replayed.RequestSubType != REQ_CHANNEL_HISTORY {
+			t.Fatalf("replayed %q (%s), want message %d", replayed.Message, replayed.RequestSubType, i)
+		}
+	}
+	carol.expect(isAck(REQ_JOINED_CHANNEL))
+
+	alice.say("general", "live")
+	carol.expect(isChannelMessage("live"))
+}
+
+// Message data source that fails to store messages
+type failingMessageDS struct {
+	*datasource.MessageMemory
+}
+
+func (m *failingMessageDS) Add(message model.IMessage) error {
+	return errors.New("disk full")
+}
+
+func TestSendMessageStoreFailed(t *testing.T) {
+
+	store := datasource.NewMemoryStore()
+	server := newTestServerWith(t, store, &failingMessageDS{&datasource.MessageMemory{Store: store}})
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	ack := alice.say("general", "lost")
+	if ack.Status != STATUS_FAILED {
+		t.Errorf("ack %s, want failed", ack.Status)
+	}
+
+	// Not broadcast
+	bob.expectNone(isChannelMessage("lost"), 200*time.Millisecond)
+}
+
+func TestFetchHistory(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	alice.join("general")
+
+	for i := 1; i <= 7; i++ {
+		alice.say("general", fmt.Sprint("message ", i))
+	}
+
+	// Newest page first. Messages of a page are oldest first.
+	pages := [][]int{{5, 6, 7}, {2, 3, 4}, {1}}
+	cursor := ""
+
+	for i, page := range pages {
+
+		ack := alice.request(&Message{
+			RequestType: REQ_FETCH_HISTORY,
+			ChannelName: "general",
+			Cursor:      cursor,
+			PageSize:    3,
+		})
+		if ack.Status != STATUS_SUCCESS || len(ack.History) != len(page) {
+			t.Fatalf("page %d: %s (%s) of %d messages, want %d", i, ack.Status, ack.Message, len(ack.History), len(page))
+		}
+		for j, n := range page {
+			if ack.History[j].Message != fmt.Sprint("message ", n) {
+				t.Errorf("page %d: message %d is %q, want message %d", i, j, ack.History[j].Message, n)
+			}
+		}
+
+		last := i == len(pages)-1
+		if (ack.Cursor == "") != last {
+			t.Fatalf("page %d: cursor %q, want one unless last", i, ack.Cursor)
+		}
+		cursor = ack.Cursor
+	}
+
+	// Only channels joined by the session
+	ack := alice.request(&Message{RequestType: REQ_FETCH_HISTORY, ChannelName: "other"})
+	if ack.Status != STATUS_FAILED || len(ack.History) != 0 {
+		t.Errorf("history of a channel not joined: %s, %d messages", ack.Status, len(ack.History))
+	}
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type IAccountToken interface {
+	GetSubscriberName() string
+	GetPurpose() string
+	GetTokenHash() string
+	GetExpires() time.Time
+}
+
+type IAccountTokenDS interface {
+	Add(token IAccountToken) error
+	// Take an unused, unexpired token of the purpose, and mark it used.
+	// Nil if none.
+	Take(tokenHash string, purpose string) (IAccountToken, error)
+	// Delete all tokens of the subscriber of the purpose, e.g. on password reset
+	DeleteAll(subscriberName string, purpose string) error
+}
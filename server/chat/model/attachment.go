@@ -0,0 +1,17 @@
+package model
+
+type IAttachment interface {
+	GetId() string
+	GetSubscriberName() string
+	GetFileName() string
+	GetContentType() string
+	GetSize() int64
+	GetChannelName() string
+	GetMessageId() string
+}
+
+type IAttachmentDS interface {
+	Add(attachment IAttachment) error
+	Get(id string) (IAttachment, error)
+	Attach(id string, chName string, messageId string) error
+}
@@ -0,0 +1,19 @@
+package model
+
+type IChannelMember interface {
+	GetChannelName() string
+	GetSubscriberName() string
+	GetStatus() string
+	GetInvitedBy() string
+	GetRole() string
+	IsBanned() bool
+	IsMuted() bool
+}
+
+type IChannelMemberDS interface {
+	Add(member IChannelMember) error
+	Update(member IChannelMember) error
+	Get(chName string, subscriberName string) (IChannelMember, error)
+	GetInvites(subscriberName string) ([]IChannelMember, error)
+	Remove(chName string, subscriberName string) error
+}
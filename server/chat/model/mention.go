@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type IMention interface {
+	GetSubscriberName() string
+	GetChannelName() string
+	GetMessageId() string
+	GetSenderName() string
+	GetMessage() string
+	GetCreated() time.Time
+}
+
+type IMentionDS interface {
+	Add(mention IMention) error
+	TakeUnseen(subscriberName string) ([]IMention, error)
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+type IMessage interface {
+	GetId() string
+	GetChannelName() string
+	GetSubscriberId() string
+	GetSubscriberName() string
+	GetMessage() string
+	GetCreated() time.Time
+	GetSeq() int64
+	IsEdited() bool
+	IsDeleted() bool
+	GetReactions() map[string]int
+	GetParentId() string
+	GetReplyCount() int
+	GetLastReply() time.Time
+	GetAttachments() []string
+	GetSnippet() string
+}
+
+// Full text search of channel messages
+type IMessageSearch interface {
+	GetText() string
+	GetChannels() []string
+	GetSender() string
+	GetFrom() time.Time
+	GetTo() time.Time
+	GetOffset() int
+	GetLimit() int
+}
+
+type IMessageDS interface {
+	Add(message IMessage) error
+	Get(id string) (IMessage, error)
+	Edit(id string, text string, editor string) error
+	Delete(id string, editor string) error
+	GetRecent(chName string, limit int) ([]IMessage, error)
+	GetPage(chName string, cursor string, limit int) ([]IMessage, error)
+	GetThread(parentId string) ([]IMessage, error)
+	GetLastSeq(chName string) (int64, error)
+	SetLastSeq(chName string, seq int64) error
+	AddReaction(id string, subscriberName string, reaction string) (bool, error)
+	RemoveReaction(id string, subscriberName string, reaction string) (bool, error)
+	CountReactions(id string, reaction string) (int, error)
+	Search(search IMessageSearch) ([]IMessage, error)
+}
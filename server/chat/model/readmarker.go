@@ -0,0 +1,16 @@
+package model
+
+type IReadMarker interface {
+	GetChannelName() string
+	GetSubscriberName() string
+	GetMessageId() string
+	GetUnreadCount() int
+}
+
+type IReadMarkerDS interface {
+	Init(chName string, subscriberName string) error
+	Set(chName string, subscriberName string, messageId string) error
+	Get(chName string, subscriberName string) (IReadMarker, error)
+	GetAll(subscriberName string) ([]IReadMarker, error)
+	Remove(chName string, subscriberName string) error
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type ISubscriber interface {
 	GetId() string
 	GetName() string
@@ -11,5 +13,12 @@ type ISubscriberDS interface {
 	Add(subscriber ISubscriber) error
 	Remove(subscriber ISubscriber) error
 	Get(subscriber ISubscriber) (ISubscriber, error)
+	GetLoginInfo(subscriber ISubscriber) (ISubscriber, error)
 	GetAll() ([]ISubscriber, error)
+	UpdateLastSeen(subscriber ISubscriber, lastSeen time.Time) error
+	GetLastSeen(name string) (time.Time, error)
+	// Registered subscribers only
+	GetByEmail(email string) (ISubscriber, error)
+	SetEmailVerified(name string, verified time.Time) error
+	SetPassword(name string, password string) error
 }
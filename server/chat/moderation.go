@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"yt/chat/server/chat/datasource"
+)
+
+const MODERATION_MESSAGE_FORMAT = "%s %s by %s."
+
+// Channel roles by rank. Moderators may only act on lower ranked members.
+var memberRoleRank = map[string]int{
+	datasource.MEMBER_ROLE_MEMBER:    1,
+	datasource.MEMBER_ROLE_MODERATOR: 2,
+	datasource.MEMBER_ROLE_OWNER:     3,
+}
+
+var moderationActions = map[string]string{
+	REQ_KICK:     "was kicked",
+	REQ_BAN:      "was banned",
+	REQ_UNBAN:    "was unbanned",
+	REQ_MUTE:     "was muted",
+	REQ_UNMUTE:   "was unmuted",
+	REQ_SET_ROLE: "role was changed",
+}
+
+// Forward a moderation request to a channel the session has joined
+func (m *Session) moderate(message *Message) {
+
+	if isAnonymous(m.Subscriber) {
+		message.MessageType = MSGTYPE_ACK
+		message.Status = STATUS_FAILED
+		message.Message = "Not allowed to " + message.RequestType + " " + message.Target
+		m.send(message)
+		return
+	}
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.MessageType = MSGTYPE_ACK
+		message.Status = STATUS_FAILED
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	channel.moderate <- message
+}
+
+// Apply a kick, ban, unban, mute, unmute or set-role request, if the
+// requesting subscriber outranks the target.
+func (m *Channel) moderateRequest(message *Message) {
+
+	session := message.Session
+	actor := session.Subscriber.Name
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	if message.Target == "" || message.Target == actor {
+		message.Message = "Please specify the subscriber to moderate"
+		session.send(message)
+		return
+	}
+
+	actorMember, _, err := m.getMember(actor)
+	if err != nil {
+		logger.Error("Get channel member failed: " + err.Error())
+		message.Message = "Can not " + message.RequestType + " " + message.Target
+		session.send(message)
+		return
+	}
+
+	targetMember, stored, err := m.getMember(message.Target)
+	if err != nil {
+		logger.Error("Get channel member failed: " + err.Error())
+		message.Message = "Can not " + message.RequestType + " " + message.Target
+		session.send(message)
+		return
+	}
+
+	if m.IsPrivate() && !stored {
+		message.Message = message.Target + " is not a member of " + m.Name
+		session.send(message)
+		return
+	}
+
+	actorRank := memberRoleRank[actorMember.Role]
+	allowed := actorRank > memberRoleRank[targetMember.Role]
+	if message.RequestType == REQ_SET_ROLE {
+		allowed = allowed && actorMember.Role == datasource.MEMBER_ROLE_OWNER
+	} else {
+		allowed = allowed && actorRank >= memberRoleRank[datasource.MEMBER_ROLE_MODERATOR]
+	}
+
+	if !allowed {
+		message.Message = "Not allowed to " + message.RequestType + " " + message.Target
+		session.send(message)
+		return
+	}
+
+	switch message.RequestType {
+	case REQ_BAN:
+		targetMember.Banned = true
+	case REQ_UNBAN:
+		targetMember.Banned = false
+	case REQ_MUTE:
+		targetMember.Muted = true
+	case REQ_UNMUTE:
+		targetMember.Muted = false
+	case REQ_SET_ROLE:
+		if message.Role != datasource.MEMBER_ROLE_MODERATOR &&
+			message.Role != datasource.MEMBER_ROLE_MEMBER {
+			message.Message = "Invalid role: " + message.Role
+			session.send(message)
+			return
+		}
+		targetMember.Role = message.Role
+	}
+
+	// Kick only removes current sessions. Everything else is kept.
+	if message.RequestType != REQ_KICK {
+		if stored {
+			err = m.memberDs.Update(targetMember)
+		} else {
+			err = m.memberDs.Add(targetMember)
+		}
+		if err != nil {
+			logger.Error("Save channel member failed: " + err.Error())
+			message.Message = "Can not " + message.RequestType + " " + message.Target
+			session.send(message)
+			return
+		}
+	}
+
+	// Kicked, or banned subscribers may not read the channel until they rejoin.
+	// See canReadChannel()
+	if message.RequestType == REQ_KICK || message.RequestType == REQ_BAN {
+		err = session.wsSrvr.readMarkerDs.Remove(m.Name, message.Target)
+		if err != nil {
+			logger.Error("Remove read marker failed: " + err.Error())
+		}
+	}
+
+	// Let every server know. Kicked, or banned sessions are removed on receipt.
+	event := NewMessage(MSGTYPE_BCAST)
+	event.RequestType = message.RequestType
+	event.ChannelName = m.Name
+	event.Session = session
+	event.Target = message.Target
+	event.Role = targetMember.Role
+	event.Message = fmt.Sprintf(
+		MODERATION_MESSAGE_FORMAT,
+		message.Target,
+		moderationActions[message.RequestType],
+		actor,
+	)
+
+	encoded, err := event.Encode()
+	if err != nil {
+		logger.Error("Encoding failed: " + err.Error())
+	} else {
+		err = m.publishEphemeral(context.Background(), *encoded)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	message.Role = targetMember.Role
+	message.Status = STATUS_SUCCESS
+	message.Message = event.Message
+	session.send(message)
+}
+
+// Get the member record of a subscriber. Subscribers without a record are
+// plain members of a public channel. Returns false if there is no record.
+func (m *Channel) getMember(subscriberName string) (*datasource.ChannelMember, bool, error) {
+
+	member, err := m.memberDs.Get(m.Name, subscriberName)
+	if err != nil {
+		return nil, false, err
+	}
+	if member != nil {
+		return member.(*datasource.ChannelMember), true, nil
+	}
+
+	return &datasource.ChannelMember{
+		ChannelName:    m.Name,
+		SubscriberName: subscriberName,
+		Status:         datasource.MEMBER_STATUS_JOINED,
+		Role:           datasource.MEMBER_ROLE_MEMBER,
+	}, false, nil
+}
+
+// Check if the subscriber moderates the channel
+func (m *Channel) isModerator(subscriberName string) (bool, error) {
+
+	member, _, err := m.getMember(subscriberName)
+	if err != nil {
+		return false, err
+	}
+
+	return memberRoleRank[member.Role] >= memberRoleRank[datasource.MEMBER_ROLE_MODERATOR], nil
+}
+
+// Ask the local sessions of a subscriber kicked, or banned from the channel
+// to leave it. Sessions leave on their own goroutine.
+func (m *Channel) kickSessions(message *Message) {
+
+	if message.MessageType != MSGTYPE_BCAST ||
+		(message.RequestType != REQ_KICK && message.RequestType != REQ_BAN) {
+		return
+	}
+
+	for sess := range m.sessions {
+		if sess.Subscriber.Name == message.Target {
+			logger.Debug("Kick session: " + sess.Subscriber.Name + " from channel: " + m.Name)
+			sess.kick(m)
+		}
+	}
+}
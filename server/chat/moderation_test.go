@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"testing"
+	"time"
+	"yt/chat/server/chat/datasource"
+)
+
+func TestModerate(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice") // Owner, who opens the channel
+	bob := server.connect(t, "bob")
+	carol := server.connect(t, "carol")
+	alice.join("general")
+	bob.join("general")
+	carol.join("general")
+
+	steps := []struct {
+		name    string
+		client  *testClient
+		request string
+		target  string
+		role    string
+		status  string
+	}{
+		{"member mutes", bob, REQ_MUTE, "carol", "", STATUS_FAILED},
+		{"owner mutes self", alice, REQ_MUTE, "alice", "", STATUS_FAILED},
+		{"owner sets moderator", alice, REQ_SET_ROLE, "bob", datasource.MEMBER_ROLE_MODERATOR, STATUS_SUCCESS},
+		{"owner sets owner", alice, REQ_SET_ROLE, "carol", datasource.MEMBER_ROLE_OWNER, STATUS_FAILED},
+		{"moderator sets moderator", bob, REQ_SET_ROLE, "carol", datasource.MEMBER_ROLE_MODERATOR, STATUS_FAILED},
+		{"moderator mutes owner", bob, REQ_MUTE, "alice", "", STATUS_FAILED},
+		{"member kicks moderator", carol, REQ_KICK, "bob", "", STATUS_FAILED},
+		{"moderator mutes member", bob, REQ_MUTE, "carol", "", STATUS_SUCCESS},
+	}
+
+	for _, step := range steps {
+		ack := step.client.request(&Message{
+			RequestType: step.request,
+			ChannelName: "general",
+			Target:      step.target,
+			Role:        step.role,
+		})
+		if ack.Status != step.status {
+			t.Fatalf("%s: %s (%s), want %s", step.name, ack.Status, ack.Message, step.status)
+		}
+	}
+
+	// Muted subscribers only read
+	if ack := carol.say("general", "muted"); ack.Status != STATUS_FAILED {
+		t.Errorf("muted subscriber sent: %s", ack.Status)
+	}
+	bob.request(&Message{RequestType: REQ_UNMUTE, ChannelName: "general", Target: "carol"})
+	if ack := carol.say("general", "unmuted"); ack.Status != STATUS_SUCCESS {
+		t.Errorf("unmuted subscriber can not send: %s (%s)", ack.Status, ack.Message)
+	}
+
+	// Everyone learns of the ban. The banned session leaves.
+	if ack := bob.request(&Message{RequestType: REQ_BAN, ChannelName: "general", Target: "carol"}); ack.Status != STATUS_SUCCESS {
+		t.Fatalf("ban: %s (%s)", ack.Status, ack.Message)
+	}
+	for _, client := range []*testClient{alice, carol} {
+		event := client.expect(isBroadcast(REQ_BAN))
+		if event.Target != "carol" {
+			t.Errorf("ban of %s, want carol", event.Target)
+		}
+	}
+
+	deadline := time.Now().Add(TEST_WAIT)
+	for {
+		ack := carol.request(&Message{RequestType: REQ_FETCH_HISTORY, ChannelName: "general"})
+		if ack.Status == STATUS_FAILED {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("banned session did not leave the channel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Nor come back, until unbanned
+	other := server.connect(t, "carol")
+	other.send(&Message{RequestType: REQ_JOIN_CHANNEL, ChannelName: "general"})
+	if ack := other.expect(isAck(REQ_JOIN_CHANNEL)); ack.Status != STATUS_FAILED {
+		t.Errorf("banned subscriber joined: %s", ack.Status)
+	}
+
+	bob.request(&Message{RequestType: REQ_UNBAN, ChannelName: "general", Target: "carol"})
+	other.join("general")
+}
@@ -0,0 +1,217 @@
+package chat
+
+import (
+	"time"
+)
+
+const (
+	PRESENCE_ONLINE  = "online"
+	PRESENCE_AWAY    = "away"
+	PRESENCE_OFFLINE = "offline"
+
+	// Session presence expires unless refreshed by the session ping loop
+	PRESENCE_TTL = 2 * PING_INTERVAL
+
+	MAX_PRESENCE_LIST_SIZE = 100
+)
+
+type Presence struct {
+	Name     string     `json:"name"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"lastseen,omitempty"`
+}
+
+// Set, or refresh the presence of a session in all servers
+func (m *Server) setPresence(session *Session, status string) error {
+	return m.state.SetPresence(session.Subscriber.Name, session.Id.String(), status)
+}
+
+// Remove the presence of a session that went away
+func (m *Server) clearPresence(session *Session) error {
+	return m.state.ClearPresence(session.Subscriber.Name, session.Id.String())
+}
+
+// Get the presence of a subscriber across all of its sessions
+func (m *Server) getPresence(name string) (string, error) {
+
+	presences, err := m.getPresences([]string{name})
+	if err != nil {
+		return PRESENCE_OFFLINE, err
+	}
+
+	return presences[0], nil
+}
+
+// Get the presence of subscribers across all of their sessions. A subscriber
+// is online if any session is online, away if all sessions are away.
+func (m *Server) getPresences(names []string) ([]string, error) {
+
+	statuses, err := m.state.GetSessionStatuses(names)
+	if err != nil {
+		return nil, err
+	}
+
+	presences := make([]string, len(names))
+
+	for i := range names {
+
+		presence := PRESENCE_OFFLINE
+		for _, status := range statuses[i] {
+			if status == PRESENCE_ONLINE {
+				presence = PRESENCE_ONLINE
+			} else if presence == PRESENCE_OFFLINE {
+				presence = PRESENCE_AWAY
+			}
+		}
+		presences[i] = presence
+	}
+
+	return presences, nil
+}
+
+// Get online, and away subscribers of all servers
+func (m *Server) getOnlineSubscribers() ([]*Presence, error) {
+
+	names, err := m.state.GetPresenceSubscribers()
+	if err != nil {
+		return nil, err
+	}
+
+	presences, err := m.getPresences(names)
+	if err != nil {
+		return nil, err
+	}
+
+	online := []*Presence{}
+	offline := []string{}
+	for i, name := range names {
+		if presences[i] == PRESENCE_OFFLINE {
+			offline = append(offline, name)
+			continue
+		}
+		online = append(online, &Presence{Name: name, Status: presences[i]})
+	}
+
+	if err := m.state.RemovePresenceSubscribers(offline); err != nil {
+		logger.Warn("Remove offline subscribers failed: " + err.Error())
+	}
+
+	return online, nil
+}
+
+// Tell all servers the subscriber presence changed
+func (m *Server) publishPresence(session *Session) {
+
+	status, err := m.getPresence(session.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get presence failed: " + err.Error())
+		return
+	}
+
+	message := NewMessage(MSGTYPE_BCAST)
+	message.RequestType = REQ_PRESENCE
+	message.Session = session
+	message.Presence = status
+
+	err = m.publish(message)
+	if err != nil {
+		logger.Error("Publish presence failed: " + err.Error())
+	}
+}
+
+// Keep the session presence alive. Called by the session ping loop.
+func (m *Server) refreshPresence(session *Session) {
+
+	err := session.storePresence("")
+	if err != nil {
+		logger.Error("Refresh presence failed: " + err.Error())
+	}
+
+	err = m.subsciberDs.UpdateLastSeen(session.Subscriber, time.Now().UTC())
+	if err != nil {
+		logger.Error("Update last seen failed: " + err.Error())
+	}
+}
+
+// Set the session online, or away as requested by the subscriber
+func (m *Session) setPresence(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	if message.Presence != PRESENCE_ONLINE && message.Presence != PRESENCE_AWAY {
+		message.Message = "Invalid presence: " + message.Presence
+		m.send(message)
+		return
+	}
+
+	err := m.storePresence(message.Presence)
+	if err != nil {
+		logger.Error("Set presence failed: " + err.Error())
+		message.Message = "Can not set presence"
+		m.send(message)
+		return
+	}
+
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+
+	m.wsSrvr.publishPresence(m)
+}
+
+// Set the session presence in all servers, or refresh it if status is
+// empty. The request handler sets, and the ping loop refreshes, so a refresh
+// never restores an older status.
+func (m *Session) storePresence(status string) error {
+
+	m.presenceLock.Lock()
+	defer m.presenceLock.Unlock()
+
+	if status != "" {
+		m.presence = status
+	}
+	return m.wsSrvr.setPresence(m, m.presence)
+}
+
+// Reply with the presence, and last seen time of the requested subscribers
+func (m *Session) getPresence(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	if len(message.Targets) > MAX_PRESENCE_LIST_SIZE {
+		message.Message = "Too many subscribers requested"
+		m.send(message)
+		return
+	}
+
+	message.PresenceList = make([]*Presence, 0, len(message.Targets))
+
+	for _, name := range message.Targets {
+
+		status, err := m.wsSrvr.getPresence(name)
+		if err != nil {
+			logger.Error("Get presence failed: " + err.Error())
+			message.Message = "Can not get presence"
+			m.send(message)
+			return
+		}
+
+		presence := &Presence{Name: name, Status: status}
+
+		if status == PRESENCE_OFFLINE {
+			lastSeen, err := m.wsSrvr.subsciberDs.GetLastSeen(name)
+			if err != nil {
+				logger.Error("Get last seen failed: " + err.Error())
+			} else if !lastSeen.IsZero() {
+				lastSeen = lastSeen.UTC()
+				presence.LastSeen = &lastSeen
+			}
+		}
+
+		message.PresenceList = append(message.PresenceList, presence)
+	}
+
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+}
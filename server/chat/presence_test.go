@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"testing"
+	"yt/chat/server/chat/datasource"
+)
+
+func TestPresence(t *testing.T) {
+
+	server := newTestServer(t)
+
+	// Last seen is kept for registered subscribers
+	subscriberDs := &datasource.SubscriberMemory{Store: server.store}
+	err := subscriberDs.Add(&datasource.Subscriber{
+		Name:  "bob",
+		Email: "bob@example.com",
+		Type:  datasource.SUBSCRIBER_TYPE_LOGIN,
+	})
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+
+	alice := server.connect(t, "alice")
+
+	isPresenceOf := func(status string) func(message *Message) bool {
+		return func(message *Message) bool {
+			return isBroadcast(REQ_PRESENCE)(message) && message.Session != nil &&
+				message.Session.Subscriber.Name == "bob" && message.Presence == status
+		}
+	}
+
+	getPresence := func() map[string]*Presence {
+
+		t.Helper()
+
+		ack := alice.request(&Message{RequestType: REQ_GET_PRESENCE, Targets: []string{"bob", "carol"}})
+		if ack.Status != STATUS_SUCCESS || len(ack.PresenceList) != 2 {
+			t.Fatalf("get presence: %s (%s), %d subscribers", ack.Status, ack.Message, len(ack.PresenceList))
+		}
+		presences := map[string]*Presence{}
+		for _, presence := range ack.PresenceList {
+			presences[presence.Name] = presence
+		}
+		return presences
+	}
+
+	bob := server.connect(t, "bob")
+	alice.expect(isPresenceOf(PRESENCE_ONLINE))
+
+	presences := getPresence()
+	if presences["bob"].Status != PRESENCE_ONLINE || presences["carol"].Status != PRESENCE_OFFLINE {
+		t.Errorf("bob %s, carol %s, want online, offline", presences["bob"].Status, presences["carol"].Status)
+	}
+
+	if ack := bob.request(&Message{RequestType: REQ_SET_PRESENCE, Presence: "busy"}); ack.Status != STATUS_FAILED {
+		t.Errorf("set invalid presence: %s, want failed", ack.Status)
+	}
+	bob.request(&Message{RequestType: REQ_SET_PRESENCE, Presence: PRESENCE_AWAY})
+	alice.expect(isPresenceOf(PRESENCE_AWAY))
+
+	// Online if any session is
+	other := server.connect(t, "bob")
+	alice.expect(isPresenceOf(PRESENCE_ONLINE))
+
+	other.close()
+	alice.expect(isPresenceOf(PRESENCE_AWAY))
+
+	bob.close()
+	alice.expect(isPresenceOf(PRESENCE_OFFLINE))
+
+	presences = getPresence()
+	if presences["bob"].Status != PRESENCE_OFFLINE || presences["bob"].LastSeen == nil {
+		t.Errorf("bob %s, last seen %v, want offline, and last seen", presences["bob"].Status, presences["bob"].LastSeen)
+	}
+	if presences["carol"].LastSeen != nil {
+		t.Errorf("carol last seen %v, want never", presences["carol"].LastSeen)
+	}
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const MAX_REACTION_LENGTH = 32 // Max. bytes of a reaction key, e.g.: ":thumbsup:"
+
+// Add, or remove the session subscriber's reaction to a stored channel message
+func (m *Session) reactMessage(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	reaction := message.Reaction
+	if reaction == "" || len(reaction) > MAX_REACTION_LENGTH ||
+		!utf8.ValidString(reaction) || strings.ContainsAny(reaction, " \t\r\n") {
+		message.Message = "Invalid reaction"
+		m.send(message)
+		return
+	}
+
+	messageDs := channel.messageDs
+
+	record, err := messageDs.Get(message.MessageId)
+	if err != nil {
+		logger.Error("Get message failed: " + err.Error())
+	}
+	if record == nil || record.GetChannelName() != channel.Name || record.IsDeleted() {
+		message.Message = "Message not found"
+		m.send(message)
+		return
+	}
+
+	var changed bool
+	if message.RequestType == REQ_ADD_REACTION {
+		changed, err = messageDs.AddReaction(record.GetId(), m.Subscriber.Name, reaction)
+	} else {
+		changed, err = messageDs.RemoveReaction(record.GetId(), m.Subscriber.Name, reaction)
+	}
+
+	var count int
+	if err == nil {
+		count, err = messageDs.CountReactions(record.GetId(), reaction)
+	}
+	if err != nil {
+		logger.Error("Change reaction failed: " + err.Error())
+		message.Message = "Can not change the reaction"
+		m.send(message)
+		return
+	}
+
+	message.Reactions = map[string]int{reaction: count}
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+
+	if !changed {
+		// Reaction already added, or removed. Nothing to tell.
+		return
+	}
+
+	// The sub type tells the delta. Counts keep clients in sync.
+	update := NewMessage(MSGTYPE_BCAST)
+	update.RequestType = REQ_SEND_MESSAGE
+	update.RequestSubType = message.RequestType
+	update.ChannelName = channel.Name
+	update.Session = m
+	update.MessageId = record.GetId()
+	update.Reaction = reaction
+	update.Reactions = message.Reactions
+
+	channel.broadcast <- update
+}
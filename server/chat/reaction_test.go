@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReactMessage(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	carol := server.connect(t, "carol")
+	alice.join("general")
+	bob.join("general")
+	carol.join("general")
+
+	messageId := alice.say("general", "hello").MessageId
+
+	isReaction := func(message *Message) bool {
+		return message.MessageType == MSGTYPE_BCAST && message.Reaction != "" &&
+			(message.RequestSubType == REQ_ADD_REACTION || message.RequestSubType == REQ_REMOVE_REACTION)
+	}
+
+	steps := []struct {
+		name      string
+		client    *testClient
+		request   string
+		messageId string
+		reaction  string
+		status    string
+		count     int
+		broadcast bool // Only changes are broadcast
+	}{
+		{"add", bob, REQ_ADD_REACTION, messageId, ":+1:", STATUS_SUCCESS, 1, true},
+		{"add again", bob, REQ_ADD_REACTION, messageId, ":+1:", STATUS_SUCCESS, 1, false},
+		{"add another's", carol, REQ_ADD_REACTION, messageId, ":+1:", STATUS_SUCCESS, 2, true},
+		{"remove", bob, REQ_REMOVE_REACTION, messageId, ":+1:", STATUS_SUCCESS, 1, true},
+		{"remove again", bob, REQ_REMOVE_REACTION, messageId, ":+1:", STATUS_SUCCESS, 1, false},
+		{"with spaces", bob, REQ_ADD_REACTION, messageId, "thumbs up", STATUS_FAILED, 0, false},
+		{"unknown message", bob, REQ_ADD_REACTION, "unknown", ":+1:", STATUS_FAILED, 0, false},
+	}
+
+	for _, step := range steps {
+
+		ack := step.client.request(&Message{
+			RequestType: step.request,
+			ChannelName: "general",
+			MessageId:   step.messageId,
+			Reaction:    step.reaction,
+		})
+		if ack.Status != step.status {
+			t.Fatalf("%s: %s (%s), want %s", step.name, ack.Status, ack.Message, step.status)
+		}
+		if step.status == STATUS_SUCCESS && ack.Reactions[step.reaction] != step.count {
+			t.Errorf("%s: ack count %d, want %d", step.name, ack.Reactions[step.reaction], step.count)
+		}
+
+		if !step.broadcast {
+			alice.expectNone(isReaction, 100*time.Millisecond)
+			continue
+		}
+
+		update := alice.expect(isReaction)
+		if update.RequestSubType != step.request || update.MessageId != messageId ||
+			update.Reactions[step.reaction] != step.count {
+			t.Errorf("%s: update %s of %s, count %d, want %s of %s, count %d", step.name,
+				update.RequestSubType, update.MessageId, update.Reactions[step.reaction],
+				step.request, messageId, step.count)
+		}
+	}
+
+	// History carries the counts
+	ack := alice.request(&Message{RequestType: REQ_FETCH_HISTORY, ChannelName: "general"})
+	if len(ack.History) != 1 {
+		t.Fatalf("history of %d messages, want 1", len(ack.History))
+	}
+	if reactions := ack.History[0].Reactions; len(reactions) != 1 || reactions[":+1:"] != 1 {
+		t.Errorf("history reactions %v, want :+1: once", reactions)
+	}
+}
@@ -0,0 +1,98 @@
+package chat
+
+// Move the read marker of the session subscriber up to a stored channel message
+func (m *Session) markRead(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	record, err := channel.messageDs.Get(message.MessageId)
+	if err != nil {
+		logger.Error("Get message failed: " + err.Error())
+	}
+	if record == nil || record.GetChannelName() != channel.Name {
+		message.Message = "Message not found"
+		m.send(message)
+		return
+	}
+
+	readMarkerDs := m.wsSrvr.readMarkerDs
+
+	err = readMarkerDs.Set(channel.Name, m.Subscriber.Name, record.GetId())
+	if err != nil {
+		logger.Error("Set read marker failed: " + err.Error())
+		message.Message = "Can not mark the message as read"
+		m.send(message)
+		return
+	}
+
+	marker, err := readMarkerDs.Get(channel.Name, m.Subscriber.Name)
+	if err != nil || marker == nil {
+		if err != nil {
+			logger.Error("Get read marker failed: " + err.Error())
+		}
+		message.Message = "Can not mark the message as read"
+		m.send(message)
+		return
+	}
+
+	// A marker that did not move back keeps the later message
+	unread := marker.GetUnreadCount()
+	message.MessageId = marker.GetMessageId()
+	message.Unread = &unread
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+
+	// Keep the other devices of the subscriber in sync
+	update := NewMessage(MSGTYPE_BCAST)
+	update.RequestType = REQ_MARK_READ
+	update.ChannelName = channel.Name
+	update.Session = m
+	update.MessageId = message.MessageId
+	update.Unread = &unread
+	update.Status = STATUS_SUCCESS
+
+	err = m.wsSrvr.publish(update)
+	if err != nil {
+		logger.Error("Publish read marker failed: " + err.Error())
+	}
+}
+
+// Send a read marker update to the other local sessions of the subscriber
+func (m *Server) syncReadMarker(message Message) {
+
+	for sess := range m.sessions {
+		if sess.Id != message.Session.Id &&
+			sess.GetSubscriber().GetName() == message.Session.Subscriber.GetName() {
+			sess.send(&message)
+		}
+	}
+}
+
+// Send the unread message count of every channel the subscriber joined before
+func (m *Server) sendUnreadCounts(session *Session) {
+
+	markers, err := m.readMarkerDs.GetAll(session.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get read markers failed: " + err.Error())
+		return
+	}
+
+	for _, marker := range markers {
+		unread := marker.GetUnreadCount()
+
+		message := NewMessage(MSGTYPE_BCAST)
+		message.RequestType = REQ_UNREAD_COUNT
+		message.ChannelName = marker.GetChannelName()
+		message.MessageId = marker.GetMessageId()
+		message.Unread = &unread
+		session.send(message)
+	}
+}
@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"time"
+)
+
+const (
+	// Sessions can be resumed until the token expires. Refreshed by the
+	// session ping loop.
+	RESUME_TTL = 5 * time.Minute
+
+	// Recent channel messages kept for resuming sessions
+	RESUME_WINDOW_SIZE = 500
+	RESUME_WINDOW_TTL  = RESUME_TTL
+)
+
+// Keep the resume state of the session in all servers
+func (m *Server) saveResumeToken(session *Session) error {
+	return m.state.SaveResumeToken(session.resumeToken, session.Subscriber.Name)
+}
+
+func (m *Server) refreshResumeToken(session *Session) {
+
+	err := m.state.RefreshResumeToken(session.resumeToken)
+	if err != nil {
+		logger.Error("Refresh resume token failed: " + err.Error())
+	}
+}
+
+// Track the channels of the session. Restored on resume.
+func (m *Server) saveResumeChannel(session *Session, channelName string, joined bool) {
+
+	err := m.state.SaveResumeChannel(session.resumeToken, channelName, joined)
+	if err != nil {
+		logger.Error("Save resume channel failed: " + err.Error())
+	}
+}
+
+// Take the channels of a previous session of the subscriber. Tokens are
+// single use. Returns false if the token expired, or is not the subscriber's.
+func (m *Server) takeResumeToken(token string, subscriberName string) ([]string, bool, error) {
+	return m.state.TakeResumeToken(token, subscriberName)
+}
+
+// Keep the broadcast message in the channel's window of recent messages
+func (m *Channel) saveToWindow(message *Message, encoded []byte) error {
+
+	if message.Seq == 0 {
+		return nil
+	}
+
+	return m.state.AddToWindow(m.Name, &WindowMessage{Seq: message.Seq, Payload: encoded})
+}
+
+// Get the window messages sent after the given sequence, oldest first.
+// Returns false if the window no longer holds all of them.
+func (m *Channel) getWindow(afterSeq int64) ([][]byte, bool, error) {
+
+	results, err := m.state.GetWindow(m.Name, afterSeq)
+	if err != nil {
+		return nil, false, err
+	}
+
+	lastSeq, err := m.state.GetSeq(m.Name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	messages := make([][]byte, 0, len(results))
+	for _, result := range results {
+		messages = append(messages, result.Payload)
+	}
+
+	if lastSeq <= afterSeq {
+		// Nothing missed
+		return messages, true, nil
+	}
+
+	complete := len(results) > 0 && results[0].Seq <= afterSeq+1
+	return messages, complete, nil
+}
+
+// Restore the channels of a dropped session, and replay the messages the
+// subscriber missed. Subscribers order by sequence, and drop duplicates.
+func (m *Session) resume(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	channels, ok, err := m.wsSrvr.takeResumeToken(message.ResumeToken, m.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get resume token failed: " + err.Error())
+		message.Message = "Can not resume session"
+		m.send(message)
+		return
+	}
+	if !ok {
+		message.Message = "Session expired"
+		m.send(message)
+		return
+	}
+
+	resumed := make([]string, 0, len(channels))
+
+	for _, channelName := range channels {
+
+		if m.getChannel(channelName) != nil {
+			resumed = append(resumed, channelName)
+			continue
+		}
+
+		channel, err := m.openChannel(channelName)
+		if err != nil {
+			// Banned, or no longer a member
+			logger.Warn("Resume channel " + channelName + " failed: " + err.Error())
+			continue
+		}
+
+		// Live traffic first. Nothing sent after the window read is lost.
+		m.addChannel(channel)
+		channel.registerSession <- m
+		m.wsSrvr.saveResumeChannel(m, channel.Name, true)
+
+		lastSeq, seen := message.LastSeq[channelName]
+		missed, complete, err := channel.getWindow(lastSeq)
+		if err != nil {
+			logger.Error("Get channel window failed: " + err.Error())
+		}
+
+		if !seen || !complete || err != nil {
+			// Too far behind. Catch up as on join.
+			m.sendHistory(channel)
+		} else {
+			for _, encoded := range missed {
+				m.Msg <- encoded
+			}
+		}
+
+		resumed = append(resumed, channelName)
+	}
+
+	message.ResumeToken = m.resumeToken
+	message.Targets = resumed
+	message.Message = "Session resumed"
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+}
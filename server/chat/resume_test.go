@@ -0,0 +1,85 @@
+package chat
+
+import "testing"
+
+func TestResume(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	bob.say("general", "seen")
+	seen := alice.expect(isChannelMessage("seen"))
+
+	// Dropped, and missed two messages
+	token := alice.resumeToken
+	alice.close()
+	bob.say("general", "missed 1")
+	bob.say("general", "missed 2")
+
+	resumed := server.connect(t, "alice")
+	resumed.send(&Message{
+		RequestType: REQ_RESUME,
+		ResumeToken: token,
+		LastSeq:     map[string]int64{"general": seen.Seq},
+	})
+
+	for i, text := range []string{"missed 1", "missed 2"} {
+		missed := resumed.expect(isBroadcast(REQ_SEND_MESSAGE))
+		if missed.Message != text || missed.Seq != seen.Seq+int64(i)+1 {
+			t.Fatalf("replayed %q, seq %d, want %q, seq %d", missed.Message, missed.Seq, text, seen.Seq+int64(i)+1)
+		}
+	}
+	ack := resumed.expect(isAck(REQ_RESUME))
+	if ack.Status != STATUS_SUCCESS || len(ack.Targets) != 1 || ack.Targets[0] != "general" {
+		t.Fatalf("resume: %s (%s), channels %v", ack.Status, ack.Message, ack.Targets)
+	}
+	if ack.ResumeToken == "" || ack.ResumeToken == token {
+		t.Errorf("resume token %q, want a new one", ack.ResumeToken)
+	}
+
+	// Live again
+	bob.say("general", "live")
+	resumed.expect(isChannelMessage("live"))
+
+	// Tokens are single use, and the subscriber's only
+	tests := []struct {
+		name   string
+		client *testClient
+		token  string
+	}{
+		{"used token", server.connect(t, "alice"), token},
+		{"another's token", bob, ack.ResumeToken},
+		{"unknown token", server.connect(t, "alice"), "unknown"},
+	}
+	for _, tt := range tests {
+		if ack := tt.client.request(&Message{RequestType: REQ_RESUME, ResumeToken: tt.token}); ack.Status != STATUS_FAILED {
+			t.Errorf("%s: %s, want failed", tt.name, ack.Status)
+		}
+	}
+}
+
+func TestResumeWithoutLastSeq(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	alice.join("general")
+	alice.say("general", "before")
+
+	token := alice.resumeToken
+	alice.close()
+
+	// Catch up as on join
+	resumed := server.connect(t, "alice")
+	resumed.send(&Message{RequestType: REQ_RESUME, ResumeToken: token})
+
+	replayed := resumed.expect(isChannelMessage("before"))
+	if replayed.RequestSubType != REQ_CHANNEL_HISTORY {
+		t.Errorf("replayed as %q, want history", replayed.RequestSubType)
+	}
+	if ack := resumed.expect(isAck(REQ_RESUME)); ack.Status != STATUS_SUCCESS {
+		t.Errorf("resume: %s (%s)", ack.Status, ack.Message)
+	}
+}
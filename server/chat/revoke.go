@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"time"
+	"yt/chat/server/chat/datasource"
+
+	"github.com/gorilla/websocket"
+)
+
+const CLOSE_REASON_REVOKED = "Token revoked."
+
+// End the sessions of a subscriber, in all servers. e.g. on use of a revoked token.
+func (m *Server) RevokeSessions(subscriberName string) error {
+
+	message := NewMessage(MSGTYPE_BCAST)
+	message.RequestType = REQ_REVOKE_SESSIONS
+	message.Session = &Session{
+		Subscriber: &datasource.Subscriber{Name: subscriberName},
+	}
+	message.Target = subscriberName
+
+	return m.publishEphemeral(message)
+}
+
+// Close the local sessions of the target subscriber
+func (m *Server) closeSessions(message Message) {
+
+	for sess := range m.sessions {
+		if sess.GetSubscriber().GetName() == message.Target {
+			logger.Info("Close revoked session: " + message.Target)
+			sess.close(websocket.ClosePolicyViolation, CLOSE_REASON_REVOKED)
+		}
+	}
+}
+
+// Ask the client to close the connection. The session is disconnected on
+// the reply, or when the read deadline is hit.
+func (m *Session) close(code int, reason string) {
+
+	if m.wsConn == nil || !m.closing.CompareAndSwap(false, true) {
+		return
+	}
+
+	deadline := time.Now().Add(WRITE_DELAY)
+
+	err := m.wsConn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason), deadline)
+	if err != nil {
+		logger.Error("Send close error: " + err.Error())
+	}
+	m.wsConn.SetReadDeadline(deadline)
+}
@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"yt/chat/server/chat/datasource"
+)
+
+const (
+	SEARCH_PAGE_SIZE     = 20  // Default num. of search results in a page
+	MAX_SEARCH_PAGE_SIZE = 100 // Max. num. of search results in a page
+)
+
+var (
+	ErrEmptySearch   = errors.New("search text required")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Full text search of the stored messages of the channels the subscriber
+// belongs to. Message holds the search text, ChannelName and Sender filter
+// by channel and sender, From and To by date.
+//
+// Results are set in message History, best match first. Cursor is set to
+// the next page if any.
+func (m *Server) Search(subscriberName string, message *Message) error {
+
+	text := strings.TrimSpace(message.Message)
+	if text == "" {
+		return ErrEmptySearch
+	}
+
+	offset := 0
+	if message.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(message.Cursor)
+		if err != nil || offset < 0 {
+			return ErrInvalidCursor
+		}
+	}
+
+	pageSize := message.PageSize
+	if pageSize <= 0 {
+		pageSize = SEARCH_PAGE_SIZE
+	} else if pageSize > MAX_SEARCH_PAGE_SIZE {
+		pageSize = MAX_SEARCH_PAGE_SIZE
+	}
+
+	channels, err := m.getSearchChannels(subscriberName, message.ChannelName)
+	if err != nil {
+		return err
+	}
+
+	search := &datasource.MessageSearch{
+		Text:     text,
+		Channels: channels,
+		Sender:   message.Sender,
+		Offset:   offset,
+		Limit:    pageSize + 1, // Extra result to find out if there is a next page
+	}
+	if message.From != nil {
+		search.From = *message.From
+	}
+	if message.To != nil {
+		search.To = *message.To
+	}
+
+	records, err := m.messageDs.Search(search)
+	if err != nil {
+		return err
+	}
+
+	message.Cursor = ""
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		message.Cursor = strconv.Itoa(offset + pageSize)
+	}
+
+	message.History = make([]*Message, 0, len(records))
+	for _, record := range records {
+		message.History = append(message.History, newMessageFromRecord(record))
+	}
+
+	message.PageSize = pageSize
+	return nil
+}
+
+// Get the channels the subscriber may search in. All readable channels the
+// subscriber joined, or only the given channel.
+func (m *Server) getSearchChannels(subscriberName string, channelName string) ([]string, error) {
+
+	if channelName != "" {
+		allowed, err := m.canReadChannel(channelName, subscriberName)
+		if err != nil || !allowed {
+			return []string{}, err
+		}
+		return []string{channelName}, nil
+	}
+
+	markers, err := m.readMarkerDs.GetAll(subscriberName)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]string, 0, len(markers))
+	for _, marker := range markers {
+		allowed, err := m.canReadChannel(marker.GetChannelName(), subscriberName)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			channels = append(channels, marker.GetChannelName())
+		}
+	}
+
+	return channels, nil
+}
+
+// Reply with a page of messages matching the search
+func (m *Session) search(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+
+	err := m.wsSrvr.Search(m.Subscriber.Name, message)
+	if err != nil {
+		message.Status = STATUS_FAILED
+		if err == ErrEmptySearch || err == ErrInvalidCursor {
+			message.Message = err.Error()
+		} else {
+			logger.Error("Search failed: " + err.Error())
+			message.Message = "Can not search messages"
+		}
+		m.send(message)
+		return
+	}
+
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+}
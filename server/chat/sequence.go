@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"time"
+)
+
+// Seed the channel sequence from the data source. Keeps the stored sequence
+// when another server, or a previous run, has set it. Numbers of messages
+// that are not stored are kept too, see keepSeq, so none are handed out
+// twice after the shared state lost the sequence.
+func (m *Channel) initSeq() error {
+
+	lastSeq, err := m.messageDs.GetLastSeq(m.Name)
+	if err != nil {
+		return err
+	}
+
+	return m.state.InitSeq(m.Name, lastSeq)
+}
+
+// Stamp the message with the server time, and the next sequence number of
+// the channel. Sequence numbers are shared by all servers of the channel.
+// Subscribers order channel messages by sequence.
+func (m *Channel) stamp(message *Message) error {
+
+	created := time.Now().UTC()
+	message.Created = &created
+
+	seq, err := m.state.NextSeq(m.Name)
+	if err != nil {
+		return err
+	}
+
+	message.Seq = seq
+	return nil
+}
+
+// Keep the sequence number of a message that is not stored, e.g. edits, and
+// reactions
+func (m *Channel) keepSeq(message *Message) error {
+
+	if message.Seq == 0 {
+		return nil
+	}
+
+	return m.messageDs.SetLastSeq(m.Name, message.Seq)
+}
@@ -2,12 +2,13 @@ package chat
 
 import (
 	"context"
+	"fmt"
+	"time"
+	"yt/chat/lib/transport"
 	"yt/chat/lib/utils/log"
 	"yt/chat/lib/workermanager"
 	"yt/chat/server/chat/datasource"
 	"yt/chat/server/chat/model"
-
-	"github.com/go-redis/redis/v8"
 )
 
 var logger = log.GetLogger()
@@ -19,10 +20,15 @@ type Server struct {
 	registerSession   chan *Session
 	unregisterSession chan *Session
 	channels          map[model.IChannel]bool
-	subscribers       []model.ISubscriber
 	channelDs         model.IChannelDS
 	subsciberDs       model.ISubscriberDS
-	rds               *redis.Client
+	messageDs         model.IMessageDS
+	memberDs          model.IChannelMemberDS
+	readMarkerDs      model.IReadMarkerDS
+	mentionDs         model.IMentionDS
+	attachmentDs      model.IAttachmentDS
+	state             IState
+	transport         transport.ITransport
 	ctx               context.Context
 	ctxCancel         context.CancelFunc
 
@@ -30,9 +36,15 @@ type Server struct {
 }
 
 func NewServer(
-	rds *redis.Client,
+	state IState,
+	transport transport.ITransport,
 	channelDS model.IChannelDS,
 	subscriberDS model.ISubscriberDS,
+	messageDS model.IMessageDS,
+	memberDS model.IChannelMemberDS,
+	readMarkerDS model.IReadMarkerDS,
+	mentionDS model.IMentionDS,
+	attachmentDS model.IAttachmentDS,
 ) *Server {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -43,7 +55,13 @@ func NewServer(
 		channels:          make(map[model.IChannel]bool),
 		subsciberDs:       subscriberDS,
 		channelDs:         channelDS,
-		rds:               rds,
+		messageDs:         messageDS,
+		memberDs:          memberDS,
+		readMarkerDs:      readMarkerDS,
+		mentionDs:         mentionDS,
+		attachmentDs:      attachmentDS,
+		state:             state,
+		transport:         transport,
 		ctx:               ctx,
 		ctxCancel:         cancel,
 		Stopping:          false,
@@ -98,10 +116,13 @@ func (m *Server) acceptSubscriberRequest() {
 	logger.Info("Listen for subscriber requests...")
 
 	ctx := context.Background()
-	pubsub := m.rds.Subscribe(ctx, MAIN_CHANNEL)
-	defer pubsub.Close()
+	sub, err := m.transport.Subscribe(ctx, MAIN_CHANNEL)
+	if err != nil {
+		logger.Error("Subscribe failed: " + err.Error())
+		return
+	}
 
-	ch := pubsub.Channel()
+	ch := sub.Messages()
 	terminate := false
 
 	for !terminate {
@@ -109,9 +130,10 @@ func (m *Server) acceptSubscriberRequest() {
 		case msg, ok := <-ch:
 			if ok {
 				var message Message
-				logger.Trace(msg.Payload)
+				payload := string(msg)
+				logger.Trace(payload)
 
-				err := message.Decode(&msg.Payload)
+				err := message.Decode(&payload)
 				if err != nil {
 					logger.Error(err.Error())
 					terminate = true
@@ -129,14 +151,24 @@ func (m *Server) acceptSubscriberRequest() {
 						m.leftChannelRequest(message)
 					case REQ_JOIN_PRIVATE_CHANNEL:
 						m.joinPrivateChannel(message)
+					case REQ_INVITE_CHANNEL:
+						m.notifySubscriber(message)
+					case REQ_MARK_READ:
+						m.syncReadMarker(message)
+					case REQ_PRESENCE:
+						m.notifySessions(message)
+					case REQ_MENTION:
+						m.notifySubscriber(message)
+					case REQ_REVOKE_SESSIONS:
+						m.closeSessions(message)
 					}
 				}
 			}
 		case <-m.ctx.Done():
 			logger.Trace("Got a cancellation event. Winding down...")
-			err := pubsub.Unsubscribe(ctx)
+			err := sub.Unsubscribe()
 			if err != nil {
-				logger.Error("Unsubscribe pubsub failed: " + err.Error())
+				logger.Error("Unsubscribe failed: " + err.Error())
 			}
 			terminate = true
 		}
@@ -200,27 +232,48 @@ func (m *Server) registerSessionRequest(session *Session) error {
 
 	// Publish to all session in main channel?
 	ctx := context.Background()
-	if err := m.rds.Publish(ctx, MAIN_CHANNEL, *encoded).Err(); err != nil {
+	if err := m.transport.Publish(ctx, MAIN_CHANNEL, *encoded); err != nil {
 		logger.Error(err.Error())
 		return err
 	}
 
-	// List online sessions
-	var uniqueSubs = make(map[string]bool)
-	for _, sub := range m.subscribers {
-		if ok := uniqueSubs[sub.GetId()]; !ok {
-			message := &Message{
-				RequestType: REQ_SUBSCRIBER_JOINED,
-				Session:     session,
-			}
-			uniqueSubs[sub.GetId()] = true
+	// Online in all servers
+	if err := session.storePresence(PRESENCE_ONLINE); err != nil {
+		logger.Error("Set presence failed: " + err.Error())
+	}
+	m.publishPresence(session)
 
-			encoded, _ = message.Encode()
-			message = nil
-			session.Msg <- *encoded
+	// List online subscribers, from all servers
+	online, err := m.getOnlineSubscribers()
+	if err != nil {
+		logger.Error("Get online subscribers failed: " + err.Error())
+	}
+	for _, presence := range online {
+		message := NewMessage(MSGTYPE_BCAST)
+		message.RequestType = REQ_SUBSCRIBER_JOINED
+		message.Session = &Session{
+			Subscriber: &datasource.Subscriber{Name: presence.Name},
 		}
+		message.Presence = presence.Status
+		session.send(message)
 	}
-	uniqueSubs = nil
+
+	// Token to resume the session after a dropped connection
+	if err := m.saveResumeToken(session); err != nil {
+		logger.Error("Save resume token failed: " + err.Error())
+	} else {
+		message := NewMessage(MSGTYPE_BCAST)
+		message.RequestType = REQ_RESUME_TOKEN
+		message.ResumeToken = session.resumeToken
+		session.send(message)
+	}
+
+	// Deliver invitations received while offline
+	m.sendInvites(session)
+	// Unread badges of the channels joined before
+	m.sendUnreadCounts(session)
+	// Mentions while offline
+	m.sendMentions(session)
 
 	m.sessions[session] = true
 
@@ -242,9 +295,18 @@ func (m *Server) unregisterSessionRequest(session *Session) error {
 		encoded, _ := message.Encode()
 
 		ctx := context.Background()
-		if err := m.rds.Publish(ctx, MAIN_CHANNEL, *encoded).Err(); err != nil {
+		if err := m.transport.Publish(ctx, MAIN_CHANNEL, *encoded); err != nil {
 			logger.Error(err.Error())
 		}
+
+		// Subscriber may still be online from another session
+		if err := m.clearPresence(session); err != nil {
+			logger.Error("Clear presence failed: " + err.Error())
+		}
+		if err := m.subsciberDs.UpdateLastSeen(session.Subscriber, time.Now().UTC()); err != nil {
+			logger.Error("Update last seen failed: " + err.Error())
+		}
+		m.publishPresence(session)
 	}
 
 	return nil
@@ -252,34 +314,69 @@ func (m *Server) unregisterSessionRequest(session *Session) error {
 
 func (m *Server) joinedChannelRequest(message Message) {
 
-	// Add subscriber
-	m.subscribers = append(m.subscribers, message.Session.Subscriber)
 	// broadcast to all sessions?
 	m.notifySessions(message)
 }
 
 func (m *Server) leftChannelRequest(message Message) {
 
-	for i, subs := range m.subscribers {
-		if subs.GetId() == message.Session.Subscriber.GetId() {
-			m.subscribers[i] = m.subscribers[len(m.subscribers)-1]
-			m.subscribers = m.subscribers[:len(m.subscribers)-1]
-			break
-		}
-	}
 	// broadcast to all sessions?
 	m.notifySessions(message)
 }
 
+// Join local sessions of both parties to a private channel. The requesting
+// session joined, and was acknowledged already.
 func (m *Server) joinPrivateChannel(message Message) {
 
-	// Find relevant session
+	requester := message.Session.Subscriber.GetName()
+	message.Status = STATUS_SUCCESS
+
 	for sess := range m.sessions {
-		if sess.GetSubscriber().GetId() == message.Session.Subscriber.GetId() {
-			sess.joinChannel(message.ChannelName, sess.Subscriber)
+
+		if sess.Id == message.Session.Id {
+			continue
+		}
+
+		name := sess.GetSubscriber().GetName()
+		if name != requester && name != message.Target {
+			continue
 		}
+
+		_, err := sess.joinChannel(message.ChannelName, sess.Subscriber)
+		if err != nil {
+			logger.Error("Join private channel failed: " + err.Error())
+			continue
+		}
+
+		// Let the subscriber know the channel is open
+		sess.send(&message)
+	}
+
+}
+
+// Publish a request to all servers listening in the main channel
+func (m *Server) publish(message *Message) error {
+
+	encoded, err := message.Encode()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return m.transport.Publish(ctx, MAIN_CHANNEL, *encoded)
+}
+
+// Publish a request to the servers listening in the main channel now, e.g.
+// session revocations. Not replayed by the streams transport.
+func (m *Server) publishEphemeral(message *Message) error {
+
+	encoded, err := message.Encode()
+	if err != nil {
+		return err
 	}
 
+	ctx := context.Background()
+	return m.transport.PublishEphemeral(ctx, MAIN_CHANNEL, *encoded)
 }
 
 func (m *Server) notifySessions(msg Message) {
@@ -293,25 +390,262 @@ func (m *Server) notifySessions(msg Message) {
 	}
 }
 
+// Send a request to the local sessions of the target subscriber
+func (m *Server) notifySubscriber(message Message) {
+
+	for sess := range m.sessions {
+		if sess.GetSubscriber().GetName() == message.Target {
+			sess.send(&message)
+		}
+	}
+}
+
+// Send pending private channel invitations to a new session
+func (m *Server) sendInvites(session *Session) {
+
+	invites, err := m.memberDs.GetInvites(session.Subscriber.Name)
+	if err != nil {
+		logger.Error("Get invitations failed: " + err.Error())
+		return
+	}
+
+	for _, invite := range invites {
+		message := NewMessage(MSGTYPE_BCAST)
+		message.RequestType = REQ_INVITE_CHANNEL
+		message.ChannelName = invite.GetChannelName()
+		message.Target = session.Subscriber.Name
+		message.Message = invite.GetInvitedBy() + " invited you to " + invite.GetChannelName()
+		session.send(message)
+	}
+}
+
+// Check if the subscriber is an enrolled member of the channel
+func (m *Server) isChannelMember(channelName string, subscriberName string) (bool, error) {
+
+	member, err := m.memberDs.Get(channelName, subscriberName)
+	if err != nil {
+		return false, err
+	}
+
+	return member != nil &&
+		member.GetStatus() == datasource.MEMBER_STATUS_JOINED &&
+		!member.IsBanned(), nil
+}
+
+// Check if the subscriber is banned from the channel
+func (m *Server) isBanned(channelName string, subscriberName string) (bool, error) {
+
+	member, err := m.memberDs.Get(channelName, subscriberName)
+	if err != nil {
+		return false, err
+	}
+
+	return member != nil && member.IsBanned(), nil
+}
+
+// Check if the subscriber may read the stored messages of the channel.
+// Private channels are for members only, public channels for subscribers
+// who joined the channel, and did not leave, or were not kicked since.
+func (m *Server) canReadChannel(channelName string, subscriberName string) (bool, error) {
+
+	if isPrivateChannelName(channelName) {
+		return m.isChannelMember(channelName, subscriberName)
+	}
+
+	channel, err := m.channelDs.Get(channelName)
+	if err != nil {
+		return false, err
+	}
+	if channel != nil && channel.IsPrivate() {
+		return m.isChannelMember(channelName, subscriberName)
+	}
+
+	banned, err := m.isBanned(channelName, subscriberName)
+	if err != nil || banned {
+		return false, err
+	}
+
+	marker, err := m.readMarkerDs.Get(channelName, subscriberName)
+	if err != nil {
+		return false, err
+	}
+
+	return marker != nil, nil
+}
+
+// Check if the subscriber may not send messages to the channel
+func (m *Server) isMuted(channelName string, subscriberName string) (bool, error) {
+
+	member, err := m.memberDs.Get(channelName, subscriberName)
+	if err != nil {
+		return false, err
+	}
+
+	return member != nil && member.IsMuted(), nil
+}
+
 // Create new channel, or reload from data source.
-func (m *Server) GetChannel(channelName string) (*Channel, error) {
+// Private channels are only returned to their members.
+func (m *Server) GetChannel(channelName string, subscriber model.ISubscriber) (*Channel, error) {
+
+	private := isPrivateChannelName(channelName)
+
+	if channel := m.findChannel(channelName); channel != nil {
+		private = channel.IsPrivate()
+	} else {
+		chDs, err := m.channelDs.Get(channelName)
+		if err != nil {
+			return nil, err
+		}
+		if chDs != nil {
+			private = chDs.IsPrivate()
+		} else if private {
+			// Private channels between two subscribers are
+			// only created through a private channel request
+			return nil, ErrNotChannelMember
+		}
+	}
+
+	if private {
+		if isAnonymous(subscriber) {
+			return nil, ErrAnonymousSubscriber
+		}
+		ok, err := m.isChannelMember(channelName, subscriber.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNotChannelMember
+		}
+	}
+
+	// Anonymous subscribers do not own the channels they open
+	creator := subscriber.GetName()
+	if isAnonymous(subscriber) {
+		creator = ""
+	}
+
+	return m.getChannel(channelName, private, creator)
+}
+
+// Create new private channel, or reload from data source.
+// Enrolls members that are not yet enrolled. Callers decide who may be enrolled.
+// The first member owns the channel if it is new.
+func (m *Server) GetPrivateChannel(channelName string, members ...string) (*Channel, error) {
+
+	creator := ""
+	if len(members) > 0 {
+		creator = members[0]
+	}
+
+	channel, err := m.getChannel(channelName, true, creator)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.IsPrivate() {
+		return nil, fmt.Errorf("channel %s is not private", channelName)
+	}
+
+	for _, name := range members {
+
+		member, err := m.memberDs.Get(channelName, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if member == nil {
+			err = m.memberDs.Add(&datasource.ChannelMember{
+				ChannelName:    channelName,
+				SubscriberName: name,
+				Status:         datasource.MEMBER_STATUS_JOINED,
+				Role:           datasource.MEMBER_ROLE_MEMBER,
+			})
+		} else if member.GetStatus() != datasource.MEMBER_STATUS_JOINED {
+			enrolled := member.(*datasource.ChannelMember)
+			enrolled.Status = datasource.MEMBER_STATUS_JOINED
+			err = m.memberDs.Update(enrolled)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return channel, nil
+}
+
+// Create a private channel owned by the subscriber.
+// Returns false if a private channel of the same name already exists, and
+// ErrChannelNotPrivate if a public one does.
+func (m *Server) CreatePrivateChannel(channelName string, owner model.ISubscriber) (bool, error) {
+
+	if isAnonymous(owner) {
+		return false, ErrAnonymousSubscriber
+	}
+
+	if channel := m.findChannel(channelName); channel != nil {
+		if !channel.IsPrivate() {
+			return false, ErrChannelNotPrivate
+		}
+		return false, nil
+	}
+
+	chDs, err := m.channelDs.Get(channelName)
+	if err != nil {
+		return false, err
+	}
+	if chDs != nil {
+		if !chDs.IsPrivate() {
+			return false, ErrChannelNotPrivate
+		}
+		return false, nil
+	}
+
+	_, err = m.GetPrivateChannel(channelName, owner.GetName())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Anonymous subscribers choose their names. Memberships, invitations and
+// roles are keyed on the name, so they are for registered subscribers only.
+func isAnonymous(subscriber model.ISubscriber) bool {
+
+	subscr, ok := subscriber.(*datasource.Subscriber)
+	return !ok || subscr.Type != datasource.SUBSCRIBER_TYPE_LOGIN
+}
+
+// Find channel if previously created and is online
+func (m *Server) findChannel(channelName string) *Channel {
 
-	var channel *Channel = nil
-	// Find channel if previously created and is online
 	for ch := range m.channels {
 		if ch.GetName() == channelName {
-			channel = ch.(*Channel)
-			break
+			return ch.(*Channel)
 		}
 	}
+	return nil
+}
+
+func (m *Server) getChannel(channelName string, private bool, creator string) (*Channel, error) {
 
+	channel := m.findChannel(channelName)
 	if channel != nil {
 		// Channel exists. Return this instance.
 		return channel, nil
 	}
 
 	// No such channel found, create one.
-	channel, err := NewChannel(m.rds, m.channelDs, channelName, false)
+	channel, err := NewChannel(
+		m.state,
+		m.transport,
+		m.channelDs,
+		m.messageDs,
+		m.memberDs,
+		channelName,
+		private,
+		creator,
+	)
 	if err != nil {
 		return nil, err
 	}
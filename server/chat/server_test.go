@@ -0,0 +1,250 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"yt/chat/lib/transport"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// Session flows run against a single server with the in-process transport,
+// and state, and the memory data sources. Subscribers connect through a
+// websocket, without authentication. See newTestServer, and connect.
+
+const TEST_WAIT = 2 * time.Second // Max. wait for an expected message
+
+type testServer struct {
+	*Server
+	store *datasource.MemoryStore
+	http  *httptest.Server
+}
+
+// Start a chat server on the memory data sources
+func newTestServer(t *testing.T) *testServer {
+
+	store := datasource.NewMemoryStore()
+	return newTestServerWith(t, store, &datasource.MessageMemory{Store: store})
+}
+
+// Start a chat server with another message data source, e.g. one that fails
+func newTestServerWith(t *testing.T, store *datasource.MemoryStore, messageDs model.IMessageDS) *testServer {
+
+	t.Helper()
+
+	server := NewServer(
+		NewMemoryState(),
+		transport.NewMemoryTransport(),
+		&datasource.ChannelMemory{Store: store},
+		&datasource.SubscriberMemory{Store: store},
+		messageDs,
+		&datasource.ChannelMemberMemory{Store: store},
+		&datasource.ReadMarkerMemory{Store: store},
+		&datasource.MentionMemory{Store: store},
+		&datasource.AttachmentMemory{Store: store},
+	)
+	server.Start()
+
+	upgrader := websocket.Upgrader{}
+
+	// Subscriber of the request, e.g. /?name=alice&type=login
+	handler := func(resp http.ResponseWriter, req *http.Request) {
+
+		subscriber := &datasource.Subscriber{
+			Name:  req.URL.Query().Get("name"),
+			Email: req.URL.Query().Get("name") + "@example.com",
+			Type:  req.URL.Query().Get("type"),
+		}
+
+		conn, err := upgrader.Upgrade(resp, req, nil)
+		if err != nil {
+			return
+		}
+		NewSession(server, conn, subscriber)
+	}
+
+	ts := &testServer{
+		Server: server,
+		store:  store,
+		http:   httptest.NewServer(http.HandlerFunc(handler)),
+	}
+
+	t.Cleanup(func() {
+		ts.http.CloseClientConnections()
+		ts.http.Close()
+		server.ctxCancel()
+	})
+
+	return ts
+}
+
+type testClient struct {
+	t           *testing.T
+	conn        *websocket.Conn
+	messages    chan *Message
+	resumeToken string // See REQ_RESUME
+}
+
+// Connect a registered subscriber
+func (m *testServer) connect(t *testing.T, name string) *testClient {
+	return m.connectAs(t, name, datasource.SUBSCRIBER_TYPE_LOGIN)
+}
+
+// Connect an anonymous subscriber
+func (m *testServer) connectAnonymous(t *testing.T, name string) *testClient {
+	return m.connectAs(t, name, datasource.SUBSCRIBER_TYPE_ANONYMOUS)
+}
+
+// Connect a subscriber, and wait until the session is registered
+func (m *testServer) connectAs(t *testing.T, name string, subscriberType string) *testClient {
+
+	t.Helper()
+
+	query := url.Values{"name": {name}, "type": {subscriberType}}
+	wsUrl := "ws" + strings.TrimPrefix(m.http.URL, "http") + "/?" + query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatalf("Connect %s failed: %v", name, err)
+	}
+
+	client := &testClient{t: t, conn: conn, messages: make(chan *Message, MESSAGE_QUEUE_SIZE)}
+
+	go func() {
+		defer close(client.messages)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// Queued messages are sent in one websocket message
+			for _, line := range strings.Split(string(data), string(CHAR_NEW_LINE)) {
+				message := &Message{}
+				if json.Unmarshal([]byte(line), message) == nil {
+					client.messages <- message
+				}
+			}
+		}
+	}()
+
+	// Sent once the session is registered
+	registered := client.expect(func(message *Message) bool { return message.RequestType == REQ_RESUME_TOKEN })
+	client.resumeToken = registered.ResumeToken
+
+	return client
+}
+
+func (m *testClient) close() {
+	m.conn.Close()
+}
+
+func (m *testClient) send(request *Message) {
+
+	m.t.Helper()
+
+	request.MessageType = MSGTYPE_REQ
+	if err := m.conn.WriteJSON(request); err != nil {
+		m.t.Fatalf("Send %s failed: %v", request.RequestType, err)
+	}
+}
+
+// Get the next message that matches. Skips others.
+func (m *testClient) expect(match func(message *Message) bool) *Message {
+
+	m.t.Helper()
+
+	timeout := time.After(TEST_WAIT)
+	for {
+		select {
+		case message, ok := <-m.messages:
+			if !ok {
+				m.t.Fatal("connection closed")
+			}
+			if match(message) {
+				return message
+			}
+		case <-timeout:
+			m.t.Fatal("expected message not received")
+		}
+	}
+}
+
+// Check that no message matches for a while. Skips others.
+func (m *testClient) expectNone(match func(message *Message) bool, wait time.Duration) {
+
+	m.t.Helper()
+
+	timeout := time.After(wait)
+	for {
+		select {
+		case message, ok := <-m.messages:
+			if ok && match(message) {
+				m.t.Fatalf("unexpected %s message: %s", message.RequestType, message.Message)
+			}
+			if !ok {
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// Send a request, and get its ack
+func (m *testClient) request(request *Message) *Message {
+
+	m.t.Helper()
+
+	m.send(request)
+	return m.expect(isAck(request.RequestType))
+}
+
+// Join a channel, and check it succeeded
+func (m *testClient) join(channelName string) {
+
+	m.t.Helper()
+
+	m.send(&Message{RequestType: REQ_JOIN_CHANNEL, ChannelName: channelName})
+	ack := m.expect(func(message *Message) bool {
+		return message.MessageType == MSGTYPE_ACK &&
+			(message.RequestType == REQ_JOINED_CHANNEL || message.RequestType == REQ_JOIN_CHANNEL)
+	})
+	if ack.Status != STATUS_SUCCESS {
+		m.t.Fatalf("join %s failed: %s", channelName, ack.Message)
+	}
+}
+
+// Send a channel message, and get its ack
+func (m *testClient) say(channelName string, text string) *Message {
+
+	m.t.Helper()
+
+	return m.request(&Message{RequestType: REQ_SEND_MESSAGE, ChannelName: channelName, Message: text})
+}
+
+func isAck(requestType string) func(message *Message) bool {
+	return func(message *Message) bool {
+		return message.MessageType == MSGTYPE_ACK && message.RequestType == requestType
+	}
+}
+
+func isBroadcast(requestType string) func(message *Message) bool {
+	return func(message *Message) bool {
+		return message.MessageType == MSGTYPE_BCAST && message.RequestType == requestType
+	}
+}
+
+// A channel message of the given text, sent live, or replayed
+func isChannelMessage(text string) func(message *Message) bool {
+	return func(message *Message) bool {
+		return message.MessageType == MSGTYPE_BCAST &&
+			message.RequestType == REQ_SEND_MESSAGE && message.Message == text
+	}
+}
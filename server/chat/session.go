@@ -1,11 +1,14 @@
 package chat
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 	"yt/chat/lib/workermanager"
 	"yt/chat/server/chat/datasource"
 	"yt/chat/server/chat/model"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -19,15 +22,31 @@ const (
 	PING_INTERVAL = (PONG_INTERVAL * 9) / 10
 
 	WRITE_DELAY = 10 * time.Second
+
+	HISTORY_REPLAY_SIZE   = 50  // Num. of recent messages sent on channel join
+	MAX_HISTORY_PAGE_SIZE = 200 // Max. num. of messages in a history page
+
+	KICK_QUEUE_SIZE = 16 // Num. of channels a session may be removed from at once
+
+	// Num. of messages queued for the websocket writer. Ephemeral messages
+	// are dropped when the queue is full.
+	MESSAGE_QUEUE_SIZE = 256
 )
 
 type Session struct {
 	model.ISession `json:"-"`
+	Id             uuid.UUID              `json:"id"`
 	Subscriber     *datasource.Subscriber `json:"subscriber"`
 	channels       map[*Channel]bool      `json:"-"`
+	channelsLock   sync.RWMutex           `json:"-"` // Channels are left by the response handler too
+	kicked         chan *Channel          `json:"-"` // Channels to leave. See kick()
 	wsConn         *websocket.Conn        `json:"-"`
 	wsSrvr         *Server                `json:"-"`
 	Msg            chan []byte            `json:"-"`
+	presence       string                 `json:"-"`
+	presenceLock   sync.Mutex             `json:"-"` // Set by the request handler, refreshed by the response handler
+	resumeToken    string                 `json:"-"` // See REQ_RESUME
+	closing        atomic.Bool            `json:"-"` // Server asked the client to close. See close()
 
 	//stop chan struct{}
 }
@@ -40,19 +59,24 @@ func NewSession(
 	logger.Info("Creating session for: " + subscriber.Name)
 
 	session := &Session{
-		Subscriber: subscriber,
-		wsConn:     wsConn,
-		wsSrvr:     server,
-		Msg:        make(chan []byte),
-		channels:   make(map[*Channel]bool),
+		Id:          uuid.New(),
+		Subscriber:  subscriber,
+		wsConn:      wsConn,
+		wsSrvr:      server,
+		Msg:         make(chan []byte, MESSAGE_QUEUE_SIZE),
+		channels:    make(map[*Channel]bool),
+		kicked:      make(chan *Channel, KICK_QUEUE_SIZE),
+		resumeToken: uuid.New().String(),
 		//stop:       make(chan struct{}),
 	}
 
+	mw := workermanager.GetInstance()
+	// Writer goes first. Registration sends pending notifications.
+	mw.StartWorker(func() { session.responseHandler() }, "responseHandler")
+
 	// Let WS server know that we exist
 	server.registerSession <- session
 
-	mw := workermanager.GetInstance()
-	mw.StartWorker(func() { session.responseHandler() }, "responseHandler")
 	mw.StartWorker(func() { session.requestHandler() }, "requestHandler")
 
 	logger.Info("Created session for: " + subscriber.Name)
@@ -81,6 +105,9 @@ func (m *Session) requestHandler() {
 				logger.Error("WebSocket close error: " + err.Error())
 				// Client closed connection
 				m.disconnect()
+			} else if m.closing.Load() {
+				logger.Debug("Closed by server: " + err.Error())
+				m.disconnect()
 			} else {
 				logger.Error("WebSocket read error: " + err.Error())
 			}
@@ -146,12 +173,22 @@ func (m *Session) responseHandler() {
 					}
 				}
 			}
+		case channel := <-m.kicked:
+			// Kicked, or banned. See Channel.kickSessions()
+			logger.Debug("Leave channel: " + channel.Name + ". Removed by a moderator.")
+			if err := m.leaveChannel(channel.Name); err != nil {
+				logger.Error("Failed to leave " + channel.Name + ": " + err.Error())
+			}
 		case <-ticker.C:
 			if !stop {
 				m.wsConn.SetWriteDeadline(time.Now().Add(WRITE_DELAY))
 				if err := m.wsConn.WriteMessage(websocket.PingMessage, nil); err != nil {
 					logger.Error("Send ping error: " + err.Error())
 					stop = true
+				} else {
+					// Still here. Keep presence alive in all servers.
+					m.wsSrvr.refreshPresence(m)
+					m.wsSrvr.refreshResumeToken(m)
 				}
 			}
 		}
@@ -167,14 +204,19 @@ func (m *Session) disconnect() {
 
 	// Tell server we quit
 	m.wsSrvr.unregisterSession <- m
-	for chn := range m.channels {
+
+	m.channelsLock.Lock()
+	channels := m.channels
+	m.channels = nil // Hasten GC
+	m.channelsLock.Unlock()
+
+	for chn := range channels {
 		select {
 		case chn.unregisterSession <- m:
 		default:
 			logger.Error("unregister from channel: " + chn.Name + " failed. Channel is gone")
 		}
 	}
-	m.channels = nil // Hasten GC
 
 	// Close the session message channel
 	//m.stop <- struct{}{}
@@ -205,17 +247,12 @@ func (m *Session) processSubscriberRequest(msg []byte) {
 	switch message.RequestType {
 	case REQ_SEND_MESSAGE:
 
-		notInChannel := true
-		var ch *Channel
+		// Subscribers may not fake the state of the message
+		message.clearServerFields()
 
-		for ch = range m.channels {
-			if ch.Name == message.ChannelName {
-				notInChannel = false
-				break
-			}
-		}
+		ch := m.getChannel(message.ChannelName)
 
-		if notInChannel {
+		if ch == nil {
 			// Session is not subscribed in the channel
 			// Inform subscriber as so.
 			message.MessageType = MSGTYPE_ACK
@@ -228,22 +265,43 @@ func (m *Session) processSubscriberRequest(msg []byte) {
 			} else {
 				m.Msg <- *encoded
 			}
-		} else {
-			// Send response to client
+		} else if !m.resolveThread(ch, &message) {
+			// Replies must be to a message of the same channel
 			message.MessageType = MSGTYPE_ACK
-			message.Status = STATUS_SUCCESS
+			message.Status = STATUS_FAILED
+			message.Message = "Message not found"
 
-			encoded, err := message.Encode()
+			m.send(&message)
+		} else if muted, err := m.wsSrvr.isMuted(ch.Name, m.Subscriber.Name); err != nil || muted {
+			// Muted subscribers may only read the channel
+			message.MessageType = MSGTYPE_ACK
+			message.Status = STATUS_FAILED
+			message.Message = "Can not send messages to " + message.ChannelName
 			if err != nil {
-				logger.Error("Encoding failed: " + err.Error())
-			} else {
-				m.Msg <- *encoded
+				logger.Error("Get channel member failed: " + err.Error())
 			}
 
-			// broadcast to other subscribers.
+			m.send(&message)
+		} else if !m.resolveAttachments(&message) {
+			// Attachments must be uploaded by the sender. See POST /attachments
+			message.MessageType = MSGTYPE_ACK
+			message.Status = STATUS_FAILED
+			message.Message = "Attachment not found"
+
+			m.send(&message)
+		} else {
+			// broadcast to other subscribers. The channel stores the
+			// message, and acknowledges it. See Channel.storeMessage()
 			logger.Debug("Sending message to " + ch.Name)
 			message.MessageType = MSGTYPE_BCAST
+			message.RequestSubType = ""
+			message.stored = make(chan bool, 1)
 			ch.broadcast <- &message
+
+			// Notify @name subscribers, in or out of the channel
+			if <-message.stored {
+				m.notifyMentions(ch, &message)
+			}
 		}
 
 	case REQ_JOIN_CHANNEL:
@@ -252,7 +310,15 @@ func (m *Session) processSubscriberRequest(msg []byte) {
 		//
 
 		message.MessageType = MSGTYPE_ACK
-		ok, err := m.joinChannel(message.ChannelName, message.Session.Subscriber)
+
+		var ok bool
+		if message.Private && !isPrivateChannelName(message.ChannelName) {
+			// Subscriber becomes the first member of a new private channel
+			_, err = m.wsSrvr.CreatePrivateChannel(message.ChannelName, m.Subscriber)
+		}
+		if err == nil {
+			ok, err = m.joinChannel(message.ChannelName, message.Session.Subscriber)
+		}
 
 		if err != nil {
 
@@ -285,6 +351,38 @@ func (m *Session) processSubscriberRequest(msg []byte) {
 			m.Msg <- *encoded
 		}
 
+	case REQ_FETCH_HISTORY:
+		m.fetchHistory(&message)
+
+	case REQ_FETCH_THREAD:
+		m.fetchThread(&message)
+
+	case REQ_SEARCH:
+		m.search(&message)
+
+	case REQ_RESUME:
+		m.resume(&message)
+
+	case REQ_EDIT_MESSAGE, REQ_DELETE_MESSAGE:
+		m.editMessage(&message)
+
+	case REQ_ADD_REACTION, REQ_REMOVE_REACTION:
+		m.reactMessage(&message)
+
+	case REQ_MARK_READ:
+		m.markRead(&message)
+
+	case REQ_SET_PRESENCE:
+		m.setPresence(&message)
+	case REQ_GET_PRESENCE:
+		m.getPresence(&message)
+
+	case REQ_TYPING_START, REQ_TYPING_STOP:
+		// Not acknowledged. Ignore channels not joined.
+		if ch := m.getChannel(message.ChannelName); ch != nil {
+			ch.typing <- &message
+		}
+
 	case REQ_LEAVE_CHANNEL:
 
 		// Send response to subscriber
@@ -307,8 +405,22 @@ func (m *Session) processSubscriberRequest(msg []byte) {
 			logger.Error("Failed to leave " + message.ChannelName + ": " + err.Error())
 		}
 
+		// Stored messages are for subscribers of the channel. See canReadChannel()
+		err = m.wsSrvr.readMarkerDs.Remove(message.ChannelName, m.Subscriber.Name)
+		if err != nil {
+			logger.Error("Remove read marker failed: " + err.Error())
+		}
+
 	case REQ_JOIN_PRIVATE_CHANNEL:
 		m.joinPrivateChannel(&message)
+	case REQ_INVITE_CHANNEL:
+		m.inviteChannel(&message)
+	case REQ_ACCEPT_INVITE:
+		m.acceptInvite(&message)
+	case REQ_DECLINE_INVITE:
+		m.declineInvite(&message)
+	case REQ_KICK, REQ_BAN, REQ_UNBAN, REQ_MUTE, REQ_UNMUTE, REQ_SET_ROLE:
+		m.moderate(&message)
 	default:
 		logger.Warn("Unknown request received. Ignored message: " + string(msg))
 	}
@@ -327,46 +439,254 @@ func (m *Session) GetMessage() chan []byte {
 	return m.Msg
 }
 
+// Find a channel the session has joined
+func (m *Session) getChannel(channelName string) *Channel {
+
+	m.channelsLock.RLock()
+	defer m.channelsLock.RUnlock()
+
+	for ch := range m.channels {
+		if ch.Name == channelName {
+			return ch
+		}
+	}
+	return nil
+}
+
+func (m *Session) addChannel(channel *Channel) {
+
+	m.channelsLock.Lock()
+	defer m.channelsLock.Unlock()
+
+	if m.channels != nil {
+		m.channels[channel] = true
+	}
+}
+
+func (m *Session) removeChannel(channel *Channel) {
+
+	m.channelsLock.Lock()
+	defer m.channelsLock.Unlock()
+
+	delete(m.channels, channel)
+}
+
+// Ask the session to leave a channel it was removed from. The response
+// handler leaves the channel, so the channel never waits on the session.
+func (m *Session) kick(channel *Channel) {
+
+	select {
+	case m.kicked <- channel:
+	default:
+		logger.Error("Kick session: " + m.Subscriber.Name + " from channel: " + channel.Name + " failed. Queue is full")
+	}
+}
+
+// Encode and queue a message to the subscriber
+func (m *Session) send(message *Message) {
+
+	encoded, err := message.Encode()
+	if err != nil {
+		logger.Error("Encoding failed: " + err.Error())
+		return
+	}
+	m.Msg <- *encoded
+}
+
+// Reply with a page of stored channel messages sent before the requested cursor
+func (m *Session) fetchHistory(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		// Session is not subscribed in the channel
+		message.Status = STATUS_FAILED
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	pageSize := message.PageSize
+	if pageSize <= 0 {
+		pageSize = HISTORY_REPLAY_SIZE
+	} else if pageSize > MAX_HISTORY_PAGE_SIZE {
+		pageSize = MAX_HISTORY_PAGE_SIZE
+	}
+
+	// Read an extra message to find out if there is a next page
+	records, err := channel.messageDs.GetPage(channel.Name, message.Cursor, pageSize+1)
+	if err != nil {
+		logger.Error("Get channel history failed: " + err.Error())
+		message.Status = STATUS_FAILED
+		message.Message = "Can not fetch history of " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	// Next page starts before the oldest message on this page
+	message.Cursor = ""
+	if len(records) > pageSize {
+		records = records[1:]
+		message.Cursor = records[0].GetId()
+	}
+
+	message.History = make([]*Message, 0, len(records))
+	for _, record := range records {
+		message.History = append(message.History, newMessageFromRecord(record))
+	}
+
+	message.PageSize = pageSize
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+}
+
+// Open a private channel with the target subscriber
 func (m *Session) joinPrivateChannel(message *Message) {
 
+	message.MessageType = MSGTYPE_ACK
+
+	if isAnonymous(m.Subscriber) {
+		message.Status = STATUS_FAILED
+		message.Message = "Please login to message " + message.Target
+		m.send(message)
+		return
+	}
+
+	if message.Target == "" || message.Target == m.Subscriber.Name {
+		message.Status = STATUS_FAILED
+		message.Message = "Please specify the subscriber to message"
+		m.send(message)
+		return
+	}
+
+	// Only registered subscribers can be messaged
+	target, err := m.wsSrvr.subsciberDs.Get(&datasource.Subscriber{
+		Name: message.Target,
+		Type: datasource.SUBSCRIBER_TYPE_LOGIN,
+	})
+	if err != nil || target == nil {
+		if err != nil {
+			logger.Error("Get subscriber failed: " + err.Error())
+		}
+		message.Status = STATUS_FAILED
+		message.Message = "Can not message " + message.Target
+		m.send(message)
+		return
+	}
+
+	channelName := privateChannelName(m.Subscriber.Name, message.Target)
+
+	// Create, and persist the channel and its members before other servers look for it
+	_, err = m.wsSrvr.GetPrivateChannel(channelName, m.Subscriber.Name, message.Target)
+	if err == nil {
+		_, err = m.joinChannel(channelName, m.Subscriber)
+	}
+	if err != nil {
+		logger.Error("Failed to open private channel: " + err.Error())
+		message.Status = STATUS_FAILED
+		message.Message = "Can not message " + message.Target
+		m.send(message)
+		return
+	}
+
+	// Join the other sessions of both parties, on whichever server they are connected
+	request := NewMessage(MSGTYPE_BCAST)
+	request.RequestType = REQ_JOIN_PRIVATE_CHANNEL
+	request.ChannelName = channelName
+	request.Session = m
+	request.Target = message.Target
+
+	err = m.wsSrvr.publish(request)
+	if err != nil {
+		logger.Error("Publish private channel request failed: " + err.Error())
+		message.Status = STATUS_FAILED
+		message.Message = "Can not message " + message.Target
+		m.send(message)
+		return
+	}
+
+	message.ChannelName = channelName
+	message.Status = STATUS_SUCCESS
+	message.Message = "Private channel with " + message.Target
+	m.send(message)
+}
+
+// Send the most recent channel messages to the subscriber
+func (m *Session) sendHistory(channel *Channel) {
+
+	records, err := channel.messageDs.GetRecent(channel.Name, HISTORY_REPLAY_SIZE)
+	if err != nil {
+		logger.Error("Get channel history failed: " + err.Error())
+		return
+	}
+
+	for _, record := range records {
+		encoded, err := newMessageFromRecord(record).Encode()
+		if err != nil {
+			logger.Error("Encoding failed: " + err.Error())
+			continue
+		}
+		m.Msg <- *encoded
+	}
 }
 
 func (m *Session) leaveChannel(channelName string) error {
 
-	channel, err := m.wsSrvr.GetChannel(channelName)
-	if err != nil || channel == nil {
-		return err
+	channel := m.getChannel(channelName)
+	if channel == nil {
+		// Not joined. Nothing to leave
+		return nil
 	}
 
 	// De-enlist session from the channel list
+	m.removeChannel(channel)
 	channel.unregisterSession <- m
-	delete(m.channels, channel)
+	m.wsSrvr.saveResumeChannel(m, channel.Name, false)
 
 	return nil
 }
 
-func (m *Session) joinChannel(channelName string, subscriber model.ISubscriber) (bool, error) {
-
-	var channel *Channel
-	var err error
+// Get the channel to join. Checks bans, and membership of private channels.
+func (m *Session) openChannel(channelName string) (*Channel, error) {
 
-	for ch := range m.channels {
-		if ch.GetName() == channelName {
-			logger.Trace("Get channel found: " + ch.GetName())
-			channel = ch
-			break
-		}
+	banned, err := m.wsSrvr.isBanned(channelName, m.Subscriber.Name)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, ErrBannedFromChannel
 	}
 
+	// Private channels are only reachable by their members
+	return m.wsSrvr.GetChannel(channelName, m.Subscriber)
+}
+
+func (m *Session) joinChannel(channelName string, subscriber model.ISubscriber) (bool, error) {
+
+	channel := m.getChannel(channelName)
+
 	if channel == nil {
 
-		channel, err = m.wsSrvr.GetChannel(channelName)
+		var err error
+
+		channel, err = m.openChannel(channelName)
 		if err != nil {
 			return false, err
 		}
 
-		m.channels[channel] = true
+		// Catch up on recent messages before live traffic starts
+		m.sendHistory(channel)
+
+		// Count unread messages from here on
+		err = m.wsSrvr.readMarkerDs.Init(channel.Name, m.Subscriber.Name)
+		if err != nil {
+			logger.Error("Init read marker failed: " + err.Error())
+		}
+
+		m.addChannel(channel)
 		channel.registerSession <- m
+		m.wsSrvr.saveResumeChannel(m, channel.Name, true)
 	}
 
 	if subscriber == nil && channel.IsPrivate() {
@@ -0,0 +1,49 @@
+package chat
+
+// State shared by the servers of a cluster. Kept in Redis, see RedisState,
+// or in process for a single server, see MemoryState.
+type IState interface {
+	ISequenceState
+	IResumeState
+	IPresenceState
+}
+
+// Channel sequence numbers. See Channel.stamp()
+type ISequenceState interface {
+	// Set the last sequence number of the channel, unless set already
+	InitSeq(channelName string, seq int64) error
+	NextSeq(channelName string) (int64, error)
+	// Last sequence number of the channel. Zero if none.
+	GetSeq(channelName string) (int64, error)
+}
+
+// Resume tokens, and recent channel messages. See Session.resume()
+type IResumeState interface {
+	SaveResumeToken(token string, subscriberName string) error
+	RefreshResumeToken(token string) error
+	SaveResumeChannel(token string, channelName string, joined bool) error
+	// Take the channels of the token. Tokens are single use. Returns false
+	// if the token expired, or is not the subscriber's.
+	TakeResumeToken(token string, subscriberName string) ([]string, bool, error)
+	AddToWindow(channelName string, message *WindowMessage) error
+	// Window messages sent after the given sequence, oldest first
+	GetWindow(channelName string, afterSeq int64) ([]*WindowMessage, error)
+}
+
+// Session presence. See Server.setPresence()
+type IPresenceState interface {
+	SetPresence(subscriberName string, sessionId string, status string) error
+	ClearPresence(subscriberName string, sessionId string) error
+	// Statuses of the live sessions of each subscriber. Sessions expired
+	// without a goodbye are removed.
+	GetSessionStatuses(subscriberNames []string) ([][]string, error)
+	// Subscribers with sessions, or removed from the presence list
+	GetPresenceSubscribers() ([]string, error)
+	RemovePresenceSubscribers(subscriberNames []string) error
+}
+
+// An encoded channel message of the resume window
+type WindowMessage struct {
+	Seq     int64
+	Payload []byte
+}
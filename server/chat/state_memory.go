@@ -0,0 +1,316 @@
+package chat
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// State of a single server, kept in process. Lost on shutdown. For the
+// in-process transport, where no Redis is shared with other servers.
+type MemoryState struct {
+	IState
+	mu sync.Mutex
+
+	seqs        map[string]int64
+	resumes     map[string]*memoryResume   // By token
+	windows     map[string]*memoryWindow   // By channel name
+	sessions    map[string]*memorySession  // By session id
+	subscribers map[string]*memoryPresence // By subscriber name
+}
+
+type memoryResume struct {
+	subscriberName string
+	channels       map[string]bool
+	expires        time.Time
+}
+
+type memoryWindow struct {
+	messages []*WindowMessage // By sequence
+	expires  time.Time
+}
+
+type memorySession struct {
+	status  string
+	expires time.Time
+}
+
+type memoryPresence struct {
+	sessionIds map[string]bool
+	expires    time.Time
+}
+
+func NewMemoryState() *MemoryState {
+	return &MemoryState{
+		seqs:        make(map[string]int64),
+		resumes:     make(map[string]*memoryResume),
+		windows:     make(map[string]*memoryWindow),
+		sessions:    make(map[string]*memorySession),
+		subscribers: make(map[string]*memoryPresence),
+	}
+}
+
+//
+// Sequences
+//
+
+func (m *MemoryState) InitSeq(channelName string, seq int64) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.seqs[channelName]; !ok {
+		m.seqs[channelName] = seq
+	}
+	return nil
+}
+
+func (m *MemoryState) NextSeq(channelName string) (int64, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seqs[channelName]++
+	return m.seqs[channelName], nil
+}
+
+func (m *MemoryState) GetSeq(channelName string) (int64, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.seqs[channelName], nil
+}
+
+//
+// Resume
+//
+
+// Get the resume state of a token, unless expired
+func (m *MemoryState) getResume(token string) *memoryResume {
+
+	resume, ok := m.resumes[token]
+	if ok && time.Now().After(resume.expires) {
+		delete(m.resumes, token)
+		return nil
+	}
+	return resume
+}
+
+func (m *MemoryState) SaveResumeToken(token string, subscriberName string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resume := m.getResume(token)
+	if resume == nil {
+		resume = &memoryResume{channels: make(map[string]bool)}
+		m.resumes[token] = resume
+	}
+	resume.subscriberName = subscriberName
+	resume.expires = time.Now().Add(RESUME_TTL)
+
+	return nil
+}
+
+func (m *MemoryState) RefreshResumeToken(token string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if resume := m.getResume(token); resume != nil {
+		resume.expires = time.Now().Add(RESUME_TTL)
+	}
+	return nil
+}
+
+func (m *MemoryState) SaveResumeChannel(token string, channelName string, joined bool) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resume := m.getResume(token)
+	if resume == nil {
+		// Taken, or expired. Channels of no subscriber can not be resumed.
+		resume = &memoryResume{channels: make(map[string]bool)}
+		m.resumes[token] = resume
+	}
+
+	if joined {
+		resume.channels[channelName] = true
+	} else {
+		delete(resume.channels, channelName)
+	}
+	resume.expires = time.Now().Add(RESUME_TTL)
+
+	return nil
+}
+
+func (m *MemoryState) TakeResumeToken(token string, subscriberName string) ([]string, bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resume := m.getResume(token)
+	if resume == nil || resume.subscriberName == "" || resume.subscriberName != subscriberName {
+		return nil, false, nil
+	}
+	delete(m.resumes, token)
+
+	channels := make([]string, 0, len(resume.channels))
+	for channelName := range resume.channels {
+		channels = append(channels, channelName)
+	}
+
+	return channels, true, nil
+}
+
+func (m *MemoryState) AddToWindow(channelName string, message *WindowMessage) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window, ok := m.windows[channelName]
+	if !ok || time.Now().After(window.expires) {
+		window = &memoryWindow{}
+		m.windows[channelName] = window
+	}
+
+	i := sort.Search(len(window.messages), func(i int) bool {
+		return window.messages[i].Seq > message.Seq
+	})
+	window.messages = append(window.messages, nil)
+	copy(window.messages[i+1:], window.messages[i:])
+	window.messages[i] = message
+
+	if len(window.messages) > RESUME_WINDOW_SIZE {
+		window.messages = window.messages[len(window.messages)-RESUME_WINDOW_SIZE:]
+	}
+	window.expires = time.Now().Add(RESUME_WINDOW_TTL)
+
+	return nil
+}
+
+func (m *MemoryState) GetWindow(channelName string, afterSeq int64) ([]*WindowMessage, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := []*WindowMessage{}
+
+	window, ok := m.windows[channelName]
+	if !ok || time.Now().After(window.expires) {
+		delete(m.windows, channelName)
+		return messages, nil
+	}
+
+	for _, message := range window.messages {
+		if message.Seq > afterSeq {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+//
+// Presence
+//
+
+func (m *MemoryState) SetPresence(subscriberName string, sessionId string, status string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := time.Now().Add(PRESENCE_TTL)
+	m.sessions[sessionId] = &memorySession{status: status, expires: expires}
+
+	presence, ok := m.subscribers[subscriberName]
+	if !ok {
+		presence = &memoryPresence{sessionIds: make(map[string]bool)}
+		m.subscribers[subscriberName] = presence
+	}
+	presence.sessionIds[sessionId] = true
+	presence.expires = expires
+
+	return nil
+}
+
+func (m *MemoryState) ClearPresence(subscriberName string, sessionId string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, sessionId)
+	if presence, ok := m.subscribers[subscriberName]; ok {
+		delete(presence.sessionIds, sessionId)
+	}
+
+	return nil
+}
+
+func (m *MemoryState) GetSessionStatuses(subscriberNames []string) ([][]string, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([][]string, len(subscriberNames))
+
+	for i, name := range subscriberNames {
+
+		statuses[i] = []string{}
+
+		presence, ok := m.subscribers[name]
+		if !ok {
+			continue
+		}
+		if now.After(presence.expires) {
+			for id := range presence.sessionIds {
+				delete(m.sessions, id)
+			}
+			presence.sessionIds = make(map[string]bool)
+			continue
+		}
+
+		for id := range presence.sessionIds {
+			session, ok := m.sessions[id]
+			if !ok || now.After(session.expires) {
+				// Session expired without a goodbye
+				delete(m.sessions, id)
+				delete(presence.sessionIds, id)
+				continue
+			}
+			statuses[i] = append(statuses[i], session.status)
+		}
+	}
+
+	return statuses, nil
+}
+
+func (m *MemoryState) GetPresenceSubscribers() ([]string, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.subscribers))
+	for name := range m.subscribers {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (m *MemoryState) RemovePresenceSubscribers(subscriberNames []string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range subscriberNames {
+		if presence, ok := m.subscribers[name]; ok && len(presence.sessionIds) == 0 {
+			delete(m.subscribers, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Redis keys:
+	//  channel:seq:<name>              - last sequence number of a channel's messages
+	//  channel:window:<name>           - recent channel messages by sequence
+	//  session:resume:<token>          - subscriber name of the session
+	//  session:resume:<token>:channels - set of channels joined by the session
+	//  presence:session:<session id>   - status of a session
+	//  presence:subscriber:<name>      - set of session ids of a subscriber
+	//  presence:subscribers            - set of subscribers with sessions
+	CHANNEL_SEQ_KEY          = "channel:seq:"
+	CHANNEL_WINDOW_KEY       = "channel:window:"
+	RESUME_TOKEN_KEY         = "session:resume:"
+	RESUME_CHANNEL_KEY       = ":channels"
+	PRESENCE_SESSION_KEY     = "presence:session:"
+	PRESENCE_SUBSCRIBER_KEY  = "presence:subscriber:"
+	PRESENCE_SUBSCRIBERS_KEY = "presence:subscribers"
+)
+
+// State shared by all servers through Redis
+type RedisState struct {
+	IState
+	Rds *redis.Client
+}
+
+func NewRedisState(rds *redis.Client) *RedisState {
+	return &RedisState{Rds: rds}
+}
+
+//
+// Sequences
+//
+
+func (m *RedisState) InitSeq(channelName string, seq int64) error {
+	return m.Rds.SetNX(context.Background(), CHANNEL_SEQ_KEY+channelName, seq, 0).Err()
+}
+
+func (m *RedisState) NextSeq(channelName string) (int64, error) {
+	return m.Rds.Incr(context.Background(), CHANNEL_SEQ_KEY+channelName).Result()
+}
+
+func (m *RedisState) GetSeq(channelName string) (int64, error) {
+
+	seq, err := m.Rds.Get(context.Background(), CHANNEL_SEQ_KEY+channelName).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
+}
+
+//
+// Resume
+//
+
+func (m *RedisState) SaveResumeToken(token string, subscriberName string) error {
+	return m.Rds.Set(context.Background(), RESUME_TOKEN_KEY+token, subscriberName, RESUME_TTL).Err()
+}
+
+func (m *RedisState) RefreshResumeToken(token string) error {
+
+	ctx := context.Background()
+	key := RESUME_TOKEN_KEY + token
+
+	_, err := m.Rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key, RESUME_TTL)
+		pipe.Expire(ctx, key+RESUME_CHANNEL_KEY, RESUME_TTL)
+		return nil
+	})
+
+	return err
+}
+
+func (m *RedisState) SaveResumeChannel(token string, channelName string, joined bool) error {
+
+	ctx := context.Background()
+	key := RESUME_TOKEN_KEY + token + RESUME_CHANNEL_KEY
+
+	_, err := m.Rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if joined {
+			pipe.SAdd(ctx, key, channelName)
+		} else {
+			pipe.SRem(ctx, key, channelName)
+		}
+		pipe.Expire(ctx, key, RESUME_TTL)
+		return nil
+	})
+
+	return err
+}
+
+func (m *RedisState) TakeResumeToken(token string, subscriberName string) ([]string, bool, error) {
+
+	ctx := context.Background()
+	key := RESUME_TOKEN_KEY + token
+
+	name, err := m.Rds.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if name != subscriberName {
+		return nil, false, nil
+	}
+
+	channels, err := m.Rds.SMembers(ctx, key+RESUME_CHANNEL_KEY).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	deleted, err := m.Rds.Del(ctx, key).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if deleted == 0 {
+		// Resumed by another session meanwhile
+		return nil, false, nil
+	}
+	m.Rds.Del(ctx, key+RESUME_CHANNEL_KEY)
+
+	return channels, true, nil
+}
+
+func (m *RedisState) AddToWindow(channelName string, message *WindowMessage) error {
+
+	ctx := context.Background()
+	key := CHANNEL_WINDOW_KEY + channelName
+
+	_, err := m.Rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, &redis.Z{Score: float64(message.Seq), Member: message.Payload})
+		pipe.ZRemRangeByRank(ctx, key, 0, -RESUME_WINDOW_SIZE-1)
+		pipe.Expire(ctx, key, RESUME_WINDOW_TTL)
+		return nil
+	})
+
+	return err
+}
+
+func (m *RedisState) GetWindow(channelName string, afterSeq int64) ([]*WindowMessage, error) {
+
+	results, err := m.Rds.ZRangeByScoreWithScores(context.Background(), CHANNEL_WINDOW_KEY+channelName,
+		&redis.ZRangeBy{
+			Min: "(" + strconv.FormatInt(afterSeq, 10),
+			Max: "+inf",
+		}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*WindowMessage, 0, len(results))
+	for _, result := range results {
+		messages = append(messages, &WindowMessage{
+			Seq:     int64(result.Score),
+			Payload: []byte(result.Member.(string)),
+		})
+	}
+
+	return messages, nil
+}
+
+//
+// Presence
+//
+
+func (m *RedisState) SetPresence(subscriberName string, sessionId string, status string) error {
+
+	ctx := context.Background()
+	subscriberKey := PRESENCE_SUBSCRIBER_KEY + subscriberName
+
+	_, err := m.Rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, PRESENCE_SESSION_KEY+sessionId, status, PRESENCE_TTL)
+		pipe.SAdd(ctx, subscriberKey, sessionId)
+		pipe.Expire(ctx, subscriberKey, PRESENCE_TTL)
+		pipe.SAdd(ctx, PRESENCE_SUBSCRIBERS_KEY, subscriberName)
+		return nil
+	})
+
+	return err
+}
+
+func (m *RedisState) ClearPresence(subscriberName string, sessionId string) error {
+
+	ctx := context.Background()
+
+	_, err := m.Rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, PRESENCE_SESSION_KEY+sessionId)
+		pipe.SRem(ctx, PRESENCE_SUBSCRIBER_KEY+subscriberName, sessionId)
+		return nil
+	})
+
+	return err
+}
+
+// In a fixed number of round trips, whatever the number of subscribers
+func (m *RedisState) GetSessionStatuses(subscriberNames []string) ([][]string, error) {
+
+	ctx := context.Background()
+
+	sessions := make([]*redis.StringSliceCmd, len(subscriberNames))
+	_, err := m.Rds.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range subscriberNames {
+			sessions[i] = pipe.SMembers(ctx, PRESENCE_SUBSCRIBER_KEY+name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, ids := range sessions {
+		for _, id := range ids.Val() {
+			keys = append(keys, PRESENCE_SESSION_KEY+id)
+		}
+	}
+
+	values := []interface{}{}
+	if len(keys) > 0 {
+		values, err = m.Rds.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([][]string, len(subscriberNames))
+	expired := map[string][]interface{}{}
+	next := 0
+
+	for i, ids := range sessions {
+
+		statuses[i] = []string{}
+		for _, id := range ids.Val() {
+			if status, ok := values[next].(string); ok {
+				statuses[i] = append(statuses[i], status)
+			} else {
+				// Session expired without a goodbye. Server may have died.
+				expired[subscriberNames[i]] = append(expired[subscriberNames[i]], id)
+			}
+			next++
+		}
+	}
+
+	if len(expired) > 0 {
+		_, err = m.Rds.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for name, ids := range expired {
+				pipe.SRem(ctx, PRESENCE_SUBSCRIBER_KEY+name, ids...)
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Warn("Remove expired sessions failed: " + err.Error())
+		}
+	}
+
+	return statuses, nil
+}
+
+func (m *RedisState) GetPresenceSubscribers() ([]string, error) {
+	return m.Rds.SMembers(context.Background(), PRESENCE_SUBSCRIBERS_KEY).Result()
+}
+
+func (m *RedisState) RemovePresenceSubscribers(subscriberNames []string) error {
+
+	if len(subscriberNames) == 0 {
+		return nil
+	}
+
+	names := make([]interface{}, 0, len(subscriberNames))
+	for _, name := range subscriberNames {
+		names = append(names, name)
+	}
+
+	return m.Rds.SRem(context.Background(), PRESENCE_SUBSCRIBERS_KEY, names...).Err()
+}
@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Behaviour shared by the states. Names are unique by test, so tests can
+// share a Redis server.
+func testState(t *testing.T, state IState, prefix string) {
+
+	channel := prefix + "channel"
+
+	t.Run("sequence", func(t *testing.T) {
+
+		// In order. Each step starts from the sequence of the previous step.
+		steps := []struct {
+			name string
+			init int64 // Zero to take the next
+			want int64
+		}{
+			{"init", 5, 5},
+			{"init is kept", 9, 5},
+			{"next", 0, 6},
+			{"next again", 0, 7},
+		}
+
+		for _, step := range steps {
+			var err error
+			if step.init > 0 {
+				err = state.InitSeq(channel, step.init)
+			} else {
+				_, err = state.NextSeq(channel)
+			}
+			if err != nil {
+				t.Fatalf("%s: failed: %v", step.name, err)
+			}
+			if seq, _ := state.GetSeq(channel); seq != step.want {
+				t.Errorf("%s: GetSeq() = %d, want %d", step.name, seq, step.want)
+			}
+		}
+
+		if seq, err := state.GetSeq(prefix + "unknown"); seq != 0 || err != nil {
+			t.Errorf("GetSeq() of unknown channel = %d, %v, want 0", seq, err)
+		}
+	})
+
+	t.Run("resume token", func(t *testing.T) {
+
+		token := prefix + "token"
+		if err := state.SaveResumeToken(token, "alice"); err != nil {
+			t.Fatalf("SaveResumeToken() failed: %v", err)
+		}
+		for _, channelName := range []string{"a", "b", "c"} {
+			state.SaveResumeChannel(token, channelName, true)
+		}
+		state.SaveResumeChannel(token, "b", false)
+		state.RefreshResumeToken(token)
+
+		if _, ok, _ := state.TakeResumeToken(token, "bob"); ok {
+			t.Error("token taken by another subscriber")
+		}
+
+		channels, ok, err := state.TakeResumeToken(token, "alice")
+		sort.Strings(channels)
+		if !ok || err != nil || !reflect.DeepEqual(channels, []string{"a", "c"}) {
+			t.Errorf("TakeResumeToken() = %v, %v, %v, want [a c]", channels, ok, err)
+		}
+
+		if _, ok, _ := state.TakeResumeToken(token, "alice"); ok {
+			t.Error("token taken twice")
+		}
+		if _, ok, _ := state.TakeResumeToken(prefix+"unknown", "alice"); ok {
+			t.Error("unknown token taken")
+		}
+	})
+
+	t.Run("window", func(t *testing.T) {
+
+		for seq := int64(1); seq <= RESUME_WINDOW_SIZE+10; seq++ {
+			err := state.AddToWindow(channel, &WindowMessage{Seq: seq, Payload: []byte(fmt.Sprint(seq))})
+			if err != nil {
+				t.Fatalf("AddToWindow() failed: %v", err)
+			}
+		}
+
+		tests := []struct {
+			name      string
+			afterSeq  int64
+			wantCount int
+			wantFirst int64
+		}{
+			{"recent", RESUME_WINDOW_SIZE + 7, 3, RESUME_WINDOW_SIZE + 8},
+			{"oldest kept", 0, RESUME_WINDOW_SIZE, 11},
+			{"none", RESUME_WINDOW_SIZE + 10, 0, 0},
+		}
+
+		for _, tt := range tests {
+			messages, err := state.GetWindow(channel, tt.afterSeq)
+			if err != nil {
+				t.Fatalf("%s: GetWindow() failed: %v", tt.name, err)
+			}
+			if len(messages) != tt.wantCount {
+				t.Fatalf("%s: %d messages, want %d", tt.name, len(messages), tt.wantCount)
+			}
+			if len(messages) > 0 && (messages[0].Seq != tt.wantFirst ||
+				string(messages[0].Payload) != fmt.Sprint(tt.wantFirst)) {
+				t.Errorf("%s: first message %d %q, want %d", tt.name,
+					messages[0].Seq, messages[0].Payload, tt.wantFirst)
+			}
+		}
+	})
+
+	t.Run("presence", func(t *testing.T) {
+
+		alice, bob, carol := prefix+"alice", prefix+"bob", prefix+"carol"
+
+		state.SetPresence(alice, prefix+"1", PRESENCE_ONLINE)
+		state.SetPresence(alice, prefix+"2", PRESENCE_AWAY)
+		state.SetPresence(bob, prefix+"3", PRESENCE_AWAY)
+		state.ClearPresence(bob, prefix+"3")
+
+		statuses, err := state.GetSessionStatuses([]string{alice, bob, carol})
+		if err != nil {
+			t.Fatalf("GetSessionStatuses() failed: %v", err)
+		}
+		sort.Strings(statuses[0])
+		want := [][]string{{PRESENCE_AWAY, PRESENCE_ONLINE}, {}, {}}
+		if !reflect.DeepEqual(statuses, want) {
+			t.Errorf("GetSessionStatuses() = %v, want %v", statuses, want)
+		}
+
+		state.RemovePresenceSubscribers([]string{bob})
+		names, err := state.GetPresenceSubscribers()
+		if err != nil {
+			t.Fatalf("GetPresenceSubscribers() failed: %v", err)
+		}
+		found := map[string]bool{}
+		for _, name := range names {
+			found[name] = true
+		}
+		if !found[alice] || found[bob] || found[carol] {
+			t.Errorf("GetPresenceSubscribers() = %v, want %s", names, alice)
+		}
+	})
+}
+
+func TestMemoryState(t *testing.T) {
+	testState(t, NewMemoryState(), "")
+}
+
+func TestMemoryStateExpiry(t *testing.T) {
+
+	state := NewMemoryState()
+	state.SaveResumeToken("token", "alice")
+	state.AddToWindow("channel", &WindowMessage{Seq: 1})
+	state.SetPresence("alice", "1", PRESENCE_ONLINE)
+
+	// As if the TTLs passed
+	expired := time.Now().Add(-time.Second)
+	state.resumes["token"].expires = expired
+	state.windows["channel"].expires = expired
+	state.sessions["1"].expires = expired
+
+	if _, ok, _ := state.TakeResumeToken("token", "alice"); ok {
+		t.Error("expired token taken")
+	}
+	if messages, _ := state.GetWindow("channel", 0); len(messages) != 0 {
+		t.Errorf("%d messages of an expired window", len(messages))
+	}
+	if statuses, _ := state.GetSessionStatuses([]string{"alice"}); len(statuses[0]) != 0 {
+		t.Errorf("statuses of expired sessions: %v", statuses[0])
+	}
+
+	// Offline subscribers are removed
+	state.RemovePresenceSubscribers([]string{"alice"})
+	if names, _ := state.GetPresenceSubscribers(); len(names) != 0 {
+		t.Errorf("GetPresenceSubscribers() = %v, want none", names)
+	}
+}
+
+// Needs a Redis server, e.g. TEST_REDIS_ADDR=localhost:6379
+func TestRedisState(t *testing.T) {
+
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+
+	rds := redis.NewClient(&redis.Options{Addr: addr})
+	defer rds.Close()
+
+	prefix := fmt.Sprintf("test-%d-", time.Now().UnixNano())
+	defer func() {
+		ctx := context.Background()
+		keys, _ := rds.Keys(ctx, "*"+prefix+"*").Result()
+		if len(keys) > 0 {
+			rds.Del(ctx, keys...)
+		}
+		rds.SRem(ctx, PRESENCE_SUBSCRIBERS_KEY, prefix+"alice", prefix+"bob", prefix+"carol")
+	}()
+
+	testState(t, NewRedisState(rds), prefix)
+}
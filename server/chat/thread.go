@@ -0,0 +1,71 @@
+package chat
+
+// Check the thread a new message replies to. Replies to a reply go to the
+// thread of the parent, so threads are one level deep.
+func (m *Session) resolveThread(channel *Channel, message *Message) bool {
+
+	if message.ParentId == "" {
+		return true
+	}
+
+	parent, err := channel.messageDs.Get(message.ParentId)
+	if err != nil {
+		logger.Error("Get message failed: " + err.Error())
+		return false
+	}
+	if parent == nil || parent.GetChannelName() != channel.Name {
+		return false
+	}
+
+	if parent.GetParentId() != "" {
+		message.ParentId = parent.GetParentId()
+	}
+
+	return true
+}
+
+// Reply with all replies to a stored channel message
+func (m *Session) fetchThread(message *Message) {
+
+	message.MessageType = MSGTYPE_ACK
+	message.Status = STATUS_FAILED
+
+	channel := m.getChannel(message.ChannelName)
+	if channel == nil {
+		message.Message = "Please subscribe to " + message.ChannelName
+		m.send(message)
+		return
+	}
+
+	parent, err := channel.messageDs.Get(message.MessageId)
+	if err != nil {
+		logger.Error("Get message failed: " + err.Error())
+	}
+	if parent == nil || parent.GetChannelName() != channel.Name {
+		message.Message = "Message not found"
+		m.send(message)
+		return
+	}
+
+	records, err := channel.messageDs.GetThread(parent.GetId())
+	if err != nil {
+		logger.Error("Get thread failed: " + err.Error())
+		message.Message = "Can not fetch the thread"
+		m.send(message)
+		return
+	}
+
+	message.History = make([]*Message, 0, len(records))
+	for _, record := range records {
+		message.History = append(message.History, newMessageFromRecord(record))
+	}
+
+	message.ReplyCount = len(records)
+	if len(records) > 0 {
+		lastReply := records[len(records)-1].GetCreated().UTC()
+		message.LastReply = &lastReply
+	}
+
+	message.Status = STATUS_SUCCESS
+	m.send(message)
+}
@@ -0,0 +1,60 @@
+package chat
+
+import "testing"
+
+func TestThread(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	reply := func(client *testClient, parentId string, text string) *Message {
+		return client.request(&Message{
+			RequestType: REQ_SEND_MESSAGE,
+			ChannelName: "general",
+			ParentId:    parentId,
+			Message:     text,
+		})
+	}
+
+	rootId := alice.say("general", "question").MessageId
+
+	first := reply(bob, rootId, "answer")
+	if first.Status != STATUS_SUCCESS {
+		t.Fatalf("reply: %s (%s)", first.Status, first.Message)
+	}
+	received := alice.expect(isChannelMessage("answer"))
+	if received.ParentId != rootId {
+		t.Errorf("reply to %q, want %q", received.ParentId, rootId)
+	}
+
+	// Threads are one level deep
+	if ack := reply(alice, first.MessageId, "thanks"); ack.Status != STATUS_SUCCESS || ack.ParentId != rootId {
+		t.Errorf("reply to a reply: %s, to %q, want success, to %q", ack.Status, ack.ParentId, rootId)
+	}
+
+	if ack := reply(alice, "unknown", "lost"); ack.Status != STATUS_FAILED {
+		t.Errorf("reply to an unknown message: %s, want failed", ack.Status)
+	}
+
+	ack := alice.request(&Message{RequestType: REQ_FETCH_THREAD, ChannelName: "general", MessageId: rootId})
+	if ack.Status != STATUS_SUCCESS || ack.ReplyCount != 2 || ack.LastReply == nil || len(ack.History) != 2 {
+		t.Fatalf("thread: %s (%s), %d replies", ack.Status, ack.Message, len(ack.History))
+	}
+	for i, text := range []string{"answer", "thanks"} {
+		if ack.History[i].Message != text {
+			t.Errorf("reply %d is %q, want %q", i, ack.History[i].Message, text)
+		}
+	}
+
+	// Replies are not in the channel history. Their parent tells how many.
+	ack = alice.request(&Message{RequestType: REQ_FETCH_HISTORY, ChannelName: "general"})
+	if len(ack.History) != 1 {
+		t.Fatalf("history of %d messages, want the root only", len(ack.History))
+	}
+	if ack.History[0].ReplyCount != 2 {
+		t.Errorf("root of %d replies, want 2", ack.History[0].ReplyCount)
+	}
+}
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	TYPING_TIMEOUT        = 5 * time.Second // Typing state expires without a refresh
+	TYPING_CHECK_INTERVAL = 1 * time.Second
+)
+
+// Ephemeral messages are neither stored, nor acknowledged, and may be dropped
+func isEphemeral(message *Message) bool {
+	return message.RequestType == REQ_TYPING_START || message.RequestType == REQ_TYPING_STOP
+}
+
+// Check if a session sent the message. Decoded messages carry a copy of
+// the sender session, so sessions are compared by id.
+func isSender(session *Session, message *Message) bool {
+	return message.Session != nil && message.Session.Id == session.Id
+}
+
+// Start, refresh or stop the typing state of a session.
+// Only state changes are published.
+func (m *Channel) typingRequest(message *Message) {
+
+	session := message.Session
+
+	if message.RequestType == REQ_TYPING_STOP {
+		m.stopTyping(session)
+		return
+	}
+
+	_, typing := m.typingSessions[session]
+	m.typingSessions[session] = time.Now().Add(TYPING_TIMEOUT)
+
+	if !typing {
+		m.publishTyping(session, REQ_TYPING_START)
+	}
+}
+
+func (m *Channel) stopTyping(session *Session) {
+
+	if _, typing := m.typingSessions[session]; typing {
+		delete(m.typingSessions, session)
+		m.publishTyping(session, REQ_TYPING_STOP)
+	}
+}
+
+// Stop typing sessions that have not refreshed in time
+func (m *Channel) expireTyping() {
+
+	now := time.Now()
+	for session, expiry := range m.typingSessions {
+		if now.After(expiry) {
+			m.stopTyping(session)
+		}
+	}
+}
+
+func (m *Channel) publishTyping(session *Session, requestType string) {
+
+	message := NewMessage(MSGTYPE_BCAST)
+	message.RequestType = requestType
+	message.ChannelName = m.Name
+	message.Session = session
+
+	encoded, err := message.Encode()
+	if err != nil {
+		logger.Error("Encoding failed: " + err.Error())
+		return
+	}
+
+	err = m.publishEphemeral(context.Background(), *encoded)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
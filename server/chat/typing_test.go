@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTyping(t *testing.T) {
+
+	server := newTestServer(t)
+	alice := server.connect(t, "alice")
+	bob := server.connect(t, "bob")
+	alice.join("general")
+	bob.join("general")
+
+	isTyping := func(requestType string) func(message *Message) bool {
+		return func(message *Message) bool {
+			return isBroadcast(requestType)(message) && message.Session != nil &&
+				message.Session.Subscriber.Name == "alice"
+		}
+	}
+
+	steps := []struct {
+		request string
+		publish string // Typing event others get, if any
+	}{
+		{REQ_TYPING_START, REQ_TYPING_START},
+		{REQ_TYPING_START, ""}, // Refresh
+		{REQ_TYPING_STOP, REQ_TYPING_STOP},
+		{REQ_TYPING_STOP, ""},
+	}
+
+	for i, step := range steps {
+
+		alice.send(&Message{RequestType: step.request, ChannelName: "general"})
+
+		if step.publish != "" {
+			bob.expect(isTyping(step.publish))
+		} else {
+			bob.expectNone(isTyping(step.request), 100*time.Millisecond)
+		}
+
+		// Nor acknowledged, nor sent back
+		alice.expectNone(func(message *Message) bool {
+			return message.RequestType == REQ_TYPING_START || message.RequestType == REQ_TYPING_STOP
+		}, 100*time.Millisecond)
+
+		if t.Failed() {
+			t.Fatalf("step %d: %s", i, step.request)
+		}
+	}
+
+	// Typing events are ephemeral, and not in the history
+	alice.say("general", "hello")
+	records, err := server.messageDs.GetRecent("general", 10)
+	if err != nil {
+		t.Fatalf("GetRecent() failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("%d messages stored, want 1", len(records))
+	}
+}
@@ -2,17 +2,22 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"yt/chat/lib/config"
 	"yt/chat/lib/db"
+	"yt/chat/lib/db/migrate"
+	"yt/chat/lib/transport"
 	"yt/chat/lib/utils"
 	"yt/chat/lib/utils/log"
 	"yt/chat/lib/workermanager"
 	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
 	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
 	"yt/chat/server/web"
 
 	_ "net/http/pprof"
@@ -45,12 +50,170 @@ func listenAndServe(server *http.Server) {
 
 }
 
+type dataSources struct {
+	channel    model.IChannelDS
+	subscriber model.ISubscriberDS
+	message    model.IMessageDS
+	member     model.IChannelMemberDS
+	readMarker model.IReadMarkerDS
+	mention    model.IMentionDS
+	attachment model.IAttachmentDS
+	token      model.IAccountTokenDS
+}
+
+// Apply pending schema migrations at startup, if enabled in dotenv config
+func migrateOnStartup(conn *sql.DB) error {
+
+	if config.GetValue("DB_MIGRATE") != "true" {
+		return nil
+	}
+
+	migrator, err := migrate.NewMigrator(conn, db.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	return err
+}
+
+// Setup data sources of the persistence backend in dotenv config.
+// Returns a function to release the backend.
+func getDataSources() (*dataSources, func(), error) {
+
+	switch db.GetDriver() {
+	case db.DB_DRIVER_MEMORY:
+		logger.Info("Using in-memory data sources. Data is lost on shutdown.")
+
+		store := datasource.NewMemoryStore()
+		return &dataSources{
+			channel:    &datasource.ChannelMemory{Store: store},
+			subscriber: &datasource.SubscriberMemory{Store: store},
+			message:    &datasource.MessageMemory{Store: store},
+			member:     &datasource.ChannelMemberMemory{Store: store},
+			readMarker: &datasource.ReadMarkerMemory{Store: store},
+			mention:    &datasource.MentionMemory{Store: store},
+			attachment: &datasource.AttachmentMemory{Store: store},
+			token:      &datasource.AccountTokenMemory{Store: store},
+		}, func() {}, nil
+
+	case db.DB_DRIVER_PGSQL:
+		conn, err := db.GetConnection()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err = migrateOnStartup(conn); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		return &dataSources{
+			channel:    &datasource.ChannelPgsql{DbConn: conn},
+			subscriber: &datasource.SubscriberPgsql{DbConn: conn},
+			message:    &datasource.MessagePgsql{DbConn: conn},
+			member:     &datasource.ChannelMemberPgsql{DbConn: conn},
+			readMarker: &datasource.ReadMarkerPgsql{DbConn: conn},
+			mention:    &datasource.MentionPgsql{DbConn: conn},
+			attachment: &datasource.AttachmentPgsql{DbConn: conn},
+			token:      &datasource.AccountTokenPgsql{DbConn: conn},
+		}, func() { conn.Close() }, nil
+
+	case db.DB_DRIVER_SQLITE:
+		conn, err := db.GetConnection()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err = migrateOnStartup(conn); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		return &dataSources{
+			channel:    &datasource.ChannelSqlite{DbConn: conn},
+			subscriber: &datasource.SubscriberSqlite{DbConn: conn},
+			message:    &datasource.MessageSqlite{DbConn: conn},
+			member:     &datasource.ChannelMemberSqlite{DbConn: conn},
+			readMarker: &datasource.ReadMarkerSqlite{DbConn: conn},
+			mention:    &datasource.MentionSqlite{DbConn: conn},
+			attachment: &datasource.AttachmentSqlite{DbConn: conn},
+			token:      &datasource.AccountTokenSqlite{DbConn: conn},
+		}, func() { conn.Close() }, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_DRIVER: %s", db.GetDriver())
+	}
+}
+
+// Connect to Redis, unless the in-process transport is selected in dotenv
+// config. Returns nil then.
+func getRedis() (*redis.Client, error) {
+
+	if config.GetValue("PUBSUB_TRANSPORT") == transport.TRANSPORT_MEMORY {
+		return nil, nil
+	}
+
+	addr := config.GetValue("PUBSUB_SERVER_HOST") + ":" + config.GetValue("PUBSUB_SERVER_PORT")
+
+	rds := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: config.GetValue("PUBSUB_SERVER_PASS"),
+	})
+
+	err := rds.Ping(context.Background()).Err()
+	if err != nil {
+		rds.Close()
+		return nil, err
+	}
+
+	return rds, nil
+}
+
+// Select the state shared by servers: channel sequences, resume tokens,
+// presence, and revoked tokens. Kept in process without Redis.
+func getState(rds *redis.Client) (chat.IState, auth.IRevocationList) {
+
+	if rds == nil {
+		logger.Info("Using in-process state. Single server only.")
+		return chat.NewMemoryState(), auth.NewMemoryRevocationList()
+	}
+
+	return chat.NewRedisState(rds), auth.NewRedisRevocationList(rds)
+}
+
+// Select message transport from dotenv config
+func getTransport(rds *redis.Client) transport.ITransport {
+
+	switch config.GetValue("PUBSUB_TRANSPORT") {
+	case transport.TRANSPORT_STREAMS:
+		nodeId := config.GetValue("NODE_ID")
+		if nodeId == "" {
+			nodeId, _ = os.Hostname()
+		}
+		logger.Info("Using Redis streams transport. Node: " + nodeId)
+		return transport.NewStreamTransport(rds, nodeId)
+	case transport.TRANSPORT_MEMORY:
+		logger.Info("Using in-process transport. Single server only.")
+		return transport.NewMemoryTransport()
+	default:
+		logger.Info("Using Redis pubsub transport")
+		return transport.NewPubSubTransport(rds)
+	}
+}
+
 func main() {
 
 	defer func() {
 		logger.Stop()
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(os.Args[2:])
+		logger.Stop()
+		os.Exit(code)
+	}
+
 	if config.GetValue("ENV") == "development" {
 		// Profiler. See: net/http/pprof
 		go func() {
@@ -67,42 +230,52 @@ func main() {
 	logger.Info("Start persistence services...")
 
 	// Persistence storage
-	conn, err := db.GetConnection()
-	//conn, err := db.GetConnection(config.GetValue("SERVER_DB"))
+	ds, closeDs, err := getDataSources()
 	if err != nil {
 		panic(err)
 	}
-	defer conn.Close()
+	defer closeDs()
 
 	logger.Info("Start transport services...")
 
 	// PubSub service
 	//
 
-	addr := config.GetValue("PUBSUB_SERVER_HOST") + ":" + config.GetValue("PUBSUB_SERVER_PORT")
-
 	timer.Start()
 
-	rds := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: config.GetValue("PUBSUB_SERVER_PASS"),
-	})
-	defer rds.Close()
-
-	err = rds.Ping(context.Background()).Err()
+	rds, err := getRedis()
 	if err != nil {
 		println("Error connecting to Redis: ", err)
 		return
 	}
+	if rds != nil {
+		defer rds.Close()
+	}
 
 	timer.Stop()
 	logger.Debug(fmt.Sprintf("Redis startup time(ms): %.3f", timer.ElapsedMs()))
 
-	// Setup Data sources
-	//
+	// Message delivery between servers
+	msgTransport := getTransport(rds)
+	// State shared by servers
+	state, revocationList := getState(rds)
+
+	// Uploaded files
+	attachmentStore, err := web.NewAttachmentStore()
+	if err != nil {
+		panic(err)
+	}
+
+	// Access token signing keys
+	if err := auth.LoadKeys(); err != nil {
+		panic(err)
+	}
 
-	channelDs := datasource.ChannelPgsql{DbConn: conn}
-	subscriberDs := datasource.SubscriberPgsql{DbConn: conn}
+	// Account emails
+	mailSender, err := web.NewMailer()
+	if err != nil {
+		panic(err)
+	}
 
 	// Start chat server
 	//
@@ -110,17 +283,47 @@ func main() {
 
 	timer.Start()
 
-	wsServer := chat.NewServer(rds, &channelDs, &subscriberDs)
+	wsServer := chat.NewServer(
+		state,
+		msgTransport,
+		ds.channel,
+		ds.subscriber,
+		ds.message,
+		ds.member,
+		ds.readMarker,
+		ds.mention,
+		ds.attachment,
+	)
 	// Start chat now - creates new thread and listen in the background
 	wsServer.Start()
 
+	// Anonymous subscribers may not use registered names
+	auth.SetSubscriberDS(ds.subscriber)
+
+	// Revoked access tokens, in all servers
+	auth.SetRevocationList(revocationList)
+	auth.OnRevokedToken(func(claim *auth.TokenClaim) {
+		if err := wsServer.RevokeSessions(claim.GetName()); err != nil {
+			logger.Error("Revoke sessions failed: " + err.Error())
+		}
+	})
+
 	timer.Stop()
 	logger.Debug(fmt.Sprintf("Websocket server startup time(ms): %.3f", timer.ElapsedMs()))
 
 	// Start web server
 	//
 
-	handler := web.GetRoutes(wsServer, rds, &channelDs, &subscriberDs)
+	handler := web.GetRoutes(
+		wsServer,
+		rds,
+		ds.channel,
+		ds.subscriber,
+		ds.attachment,
+		attachmentStore,
+		ds.token,
+		mailSender,
+	)
 	httpServer := &http.Server{
 		Addr:    ":" + config.GetValue("SERVER_PORT"),
 		Handler: *handler,
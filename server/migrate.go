@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"yt/chat/lib/db"
+	"yt/chat/lib/db/migrate"
+)
+
+const MIGRATE_USAGE = "usage: chat-server migrate [up | down [steps] | version]"
+
+// Schema migrations subcommand. Returns the process exit code.
+func runMigrate(args []string) int {
+
+	if db.GetDriver() == db.DB_DRIVER_MEMORY {
+		fmt.Println("No schema for DB_DRIVER: " + db.DB_DRIVER_MEMORY + ". Nothing to migrate.")
+		return 0
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	conn, err := db.GetConnection()
+	if err != nil {
+		fmt.Println("Get DB connection failed: " + err.Error())
+		return -1
+	}
+	defer conn.Close()
+
+	migrator, err := migrate.NewMigrator(conn, db.GetDriver())
+	if err != nil {
+		fmt.Println(err.Error())
+		return -1
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			fmt.Println(err.Error())
+			return -2
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				fmt.Println(MIGRATE_USAGE)
+				return -1
+			}
+		}
+
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			fmt.Println(err.Error())
+			return -2
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+
+	case "version":
+		version, err := migrator.Version()
+		if err != nil {
+			fmt.Println(err.Error())
+			return -2
+		}
+
+		latest := 0
+		if migrations := migrator.Migrations(); len(migrations) > 0 {
+			latest = migrations[len(migrations)-1].Version
+		}
+		fmt.Printf("Schema version: %d, latest: %d\n", version, latest)
+
+	default:
+		fmt.Println(MIGRATE_USAGE)
+		return -1
+	}
+
+	return 0
+}
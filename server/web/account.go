@@ -0,0 +1,341 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"yt/chat/lib/config"
+	"yt/chat/lib/mailer"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+)
+
+const (
+	VERIFY_EMAIL_TTL   = 24 * time.Hour
+	RESET_PASSWORD_TTL = time.Hour
+
+	DEFAULT_MAIL_LOG_FILE = "logs/mail.log"
+	DEFAULT_SMTP_PORT     = "587"
+
+	// Account failure codes. See AppResponse.Code
+	ACCOUNT_ERR_INVALID_TOKEN = "invalid_token"
+)
+
+func getAccountHandler(
+	wsSrvr *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+	h func(
+		http.ResponseWriter,
+		*http.Request,
+		*chat.Server,
+		model.ISubscriberDS,
+		model.IAccountTokenDS,
+		mailer.IMailer,
+	),
+) func(http.ResponseWriter, *http.Request) {
+
+	return auth.Authenticate(
+		func(resp http.ResponseWriter, req *http.Request) {
+			h(resp, req, wsSrvr, subscriberDs, tokenDs, mailSender)
+		},
+	)
+}
+
+// Create the mailer of account emails from dotenv config
+func NewMailer() (mailer.IMailer, error) {
+
+	from := config.GetValue("MAIL_FROM")
+
+	switch config.GetValue("MAILER") {
+	case mailer.MAILER_SMTP:
+		port := config.GetValue("SMTP_PORT")
+		if port == "" {
+			port = DEFAULT_SMTP_PORT
+		}
+		return mailer.NewSmtpMailer(
+			config.GetValue("SMTP_HOST"),
+			port,
+			config.GetValue("SMTP_USER"),
+			config.GetValue("SMTP_PASSWORD"),
+			from,
+		), nil
+	default:
+		path := config.GetValue("MAIL_LOG_FILE")
+		if path == "" {
+			path = DEFAULT_MAIL_LOG_FILE
+		}
+		logger.Info("Using mail log: " + path + ". Emails are not sent.")
+		return mailer.NewLogMailer(path, from)
+	}
+}
+
+// Base url of links in account emails
+func getPublicUrl() string {
+
+	publicUrl := config.GetValue("PUBLIC_URL")
+	if publicUrl == "" {
+		publicUrl = "http://" + config.GetValue("SERVER_HOST") + ":" + config.GetValue("SERVER_PORT")
+	}
+	return strings.TrimSuffix(publicUrl, "/")
+}
+
+// Create a single use token of the purpose. Returns the token to send.
+func newAccountToken(
+	name string,
+	purpose string,
+	ttl time.Duration,
+	tokenDs model.IAccountTokenDS,
+) (string, error) {
+
+	token, hash, err := auth.NewSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = tokenDs.Add(&datasource.AccountToken{
+		SubscriberName: name,
+		Purpose:        purpose,
+		TokenHash:      hash,
+		Expires:        time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func sendVerificationEmail(
+	subscr *datasource.Subscriber,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) error {
+
+	token, err := newAccountToken(subscr.Name, datasource.TOKEN_PURPOSE_VERIFY_EMAIL,
+		VERIFY_EMAIL_TTL, tokenDs)
+	if err != nil {
+		return err
+	}
+
+	link := getPublicUrl() + "/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your email address:\n\n%s\n\n"+
+		"The link expires in %d hours.\n", subscr.Name, link, int(VERIFY_EMAIL_TTL.Hours()))
+
+	return mailSender.Send(subscr.Email, "Confirm your email", body)
+}
+
+// Handle email verification link.
+//
+// Query: token
+func onVerifyEmail(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onVerifyEmail")
+
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired link", http.StatusBadRequest)
+		return
+	}
+
+	accountToken, err := tokenDs.Take(auth.HashToken(token), datasource.TOKEN_PURPOSE_VERIFY_EMAIL)
+	if err != nil {
+		logger.Error("Take verification token failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if accountToken == nil {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired link", http.StatusBadRequest)
+		return
+	}
+
+	err = subscriberDs.SetEmailVerified(accountToken.GetSubscriberName(), time.Now())
+	if err != nil {
+		logger.Error("Set email verified failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Verified email of: " + accountToken.GetSubscriberName())
+
+	sendAppResponse(resp, chat.AppResponse{
+		Name:    accountToken.GetSubscriberName(),
+		Status:  chat.STATUS_SUCCESS,
+		Message: "Email verified",
+	})
+}
+
+// Handle lost password request. Mails a reset link to registered emails.
+//
+// Body: {"email": ""}
+func onForgotPassword(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onForgotPassword")
+
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil || request.Email == "" {
+		sendErrorResponse(resp, "Email required", http.StatusBadRequest)
+		return
+	}
+
+	// Same response whether or not the email is registered
+	jsonResp := chat.AppResponse{
+		Status:  chat.STATUS_SUCCESS,
+		Message: "If the email is registered, a reset link was sent",
+	}
+
+	subs, err := subscriberDs.GetByEmail(request.Email)
+	if err != nil {
+		logger.Error("Get subscriber by email failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		logger.Debug("Reset password of unknown email: " + request.Email)
+		sendAppResponse(resp, jsonResp)
+		return
+	}
+
+	token, err := newAccountToken(subs.GetName(), datasource.TOKEN_PURPOSE_RESET_PASSWORD,
+		RESET_PASSWORD_TTL, tokenDs)
+	if err != nil {
+		logger.Error("Create reset token failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	link := getPublicUrl() + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nReset your password:\n\n%s\n\n"+
+		"The link expires in %d minutes. Ignore this email if you did not ask to reset your password.\n",
+		subs.GetName(), link, int(RESET_PASSWORD_TTL.Minutes()))
+
+	err = mailSender.Send(subs.GetEmail(), "Reset your password", body)
+	if err != nil {
+		logger.Error("Send reset email failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Sent reset password email to: " + subs.GetName())
+
+	sendAppResponse(resp, jsonResp)
+}
+
+// Handle password reset with the token of a reset link. Refresh tokens, and
+// sessions of the subscriber are revoked.
+//
+// Body: {"token": "", "password": ""}
+func onResetPassword(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onResetPassword")
+
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check before the token is used up
+	if !isStrongPassword(request.Password) {
+		sendAppError(resp, REGISTER_ERR_WEAK_PASSWORD,
+			"Password must be 8 to 72 characters, with upper and lower case letters, and digits",
+			http.StatusBadRequest)
+		return
+	}
+
+	if request.Token == "" {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired link", http.StatusBadRequest)
+		return
+	}
+
+	accountToken, err := tokenDs.Take(auth.HashToken(request.Token), datasource.TOKEN_PURPOSE_RESET_PASSWORD)
+	if err != nil {
+		logger.Error("Take reset token failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if accountToken == nil {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired link", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashString(request.Password)
+	if err != nil {
+		logger.Error("Hash password failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	err = subscriberDs.SetPassword(accountToken.GetSubscriberName(), hash)
+	if err != nil {
+		logger.Error("Set password failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// Sign out everywhere. Whoever had the old password may have signed in.
+	err = tokenDs.DeleteAll(accountToken.GetSubscriberName(), datasource.TOKEN_PURPOSE_REFRESH)
+	if err != nil {
+		logger.Error("Delete refresh tokens failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	err = wsServer.RevokeSessions(accountToken.GetSubscriberName())
+	if err != nil {
+		logger.Error("Revoke sessions failed: " + err.Error())
+	}
+
+	logger.Info("Reset password of: " + accountToken.GetSubscriberName())
+
+	sendAppResponse(resp, chat.AppResponse{
+		Name:    accountToken.GetSubscriberName(),
+		Status:  chat.STATUS_SUCCESS,
+		Message: "Password changed",
+	})
+}
+
+func sendAppResponse(resp http.ResponseWriter, jsonResp chat.AppResponse) {
+
+	respString, err := json.Marshal(jsonResp)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Write(respString)
+}
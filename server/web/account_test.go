@@ -0,0 +1,129 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestVerifyEmail(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	routes.register(t, "bob")
+	token := routes.mails.linkToken(t, "bob@example.com")
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusBadRequest},
+		{"unknown", "unknown", http.StatusBadRequest},
+		{"valid", token, http.StatusOK},
+		{"used", token, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		status, resp := routes.do(t, http.MethodGet, "/verify-email?token="+url.QueryEscape(tt.token), nil, "")
+		if status != tt.status {
+			t.Fatalf("%s: %d %s, want %d", tt.name, status, resp.Message, tt.status)
+		}
+		if status == http.StatusOK && resp.Name != "bob" {
+			t.Errorf("%s: verified %q, want bob", tt.name, resp.Name)
+		}
+		if status != http.StatusOK && tt.token != "" && resp.Code != ACCOUNT_ERR_INVALID_TOKEN {
+			t.Errorf("%s: code %q, want %q", tt.name, resp.Code, ACCOUNT_ERR_INVALID_TOKEN)
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	routes.register(t, "bob")
+	verifyToken := routes.mails.linkToken(t, "bob@example.com")
+
+	// Same response, whether or not the email is registered
+	status, unknown := routes.post(t, "/forgot-password", map[string]string{"email": "nobody@example.com"})
+	if status != http.StatusOK {
+		t.Fatalf("forgot-password of an unknown email: %d", status)
+	}
+	status, known := routes.post(t, "/forgot-password", map[string]string{"email": "bob@example.com"})
+	if status != http.StatusOK || known.Message != unknown.Message {
+		t.Fatalf("forgot-password: %d %q, want %q", status, known.Message, unknown.Message)
+	}
+	resetToken := routes.mails.linkToken(t, "bob@example.com")
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		status   int
+		code     string
+	}{
+		{"weak password", resetToken, "secret", http.StatusBadRequest, REGISTER_ERR_WEAK_PASSWORD},
+		{"verification token", verifyToken, "Changed456", http.StatusBadRequest, ACCOUNT_ERR_INVALID_TOKEN},
+		{"valid", resetToken, "Changed456", http.StatusOK, ""},
+		{"used", resetToken, "Again789a", http.StatusBadRequest, ACCOUNT_ERR_INVALID_TOKEN},
+	}
+
+	for _, tt := range tests {
+		status, resp := routes.post(t, "/reset-password", map[string]string{
+			"token":    tt.token,
+			"password": tt.password,
+		})
+		if status != tt.status || resp.Code != tt.code {
+			t.Fatalf("%s: %d %q, want %d %q", tt.name, status, resp.Code, tt.status, tt.code)
+		}
+	}
+
+	if status, _ = routes.login(t, "bob", "Changed456"); status != http.StatusOK {
+		t.Errorf("login with the new password: %d", status)
+	}
+}
+
+func TestResetPasswordSignsOut(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	registered := routes.register(t, "bob")
+
+	status, loggedIn := routes.login(t, "bob", TEST_PASSWORD)
+	if status != http.StatusOK {
+		t.Fatalf("login: %d %s", status, loggedIn.Message)
+	}
+	conn := routes.connect(t, loggedIn.Token.AccessToken)
+
+	status, resp := routes.post(t, "/forgot-password", map[string]string{"email": "bob@example.com"})
+	if status != http.StatusOK {
+		t.Fatalf("forgot-password: %d %s", status, resp.Message)
+	}
+
+	status, resp = routes.post(t, "/reset-password", map[string]string{
+		"token":    routes.mails.linkToken(t, "bob@example.com"),
+		"password": "Changed456",
+	})
+	if status != http.StatusOK || resp.Name != "bob" {
+		t.Fatalf("reset-password: %d %s", status, resp.Message)
+	}
+
+	// Sessions, and refresh tokens of the old password are revoked
+	if code := expectClosed(t, conn); code != websocket.ClosePolicyViolation {
+		t.Errorf("session closed with %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+
+	for _, refreshToken := range []string{registered.RefreshToken, loggedIn.Token.RefreshToken} {
+		status, resp = routes.post(t, "/token/refresh", map[string]string{"refresh_token": refreshToken})
+		if status != http.StatusUnauthorized {
+			t.Errorf("refresh after reset: %d %s, want %d", status, resp.Message, http.StatusUnauthorized)
+		}
+	}
+
+	if status, _ = routes.login(t, "bob", TEST_PASSWORD); status != http.StatusUnauthorized {
+		t.Errorf("login with old password: %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ = routes.login(t, "bob", "Changed456"); status != http.StatusOK {
+		t.Errorf("login with new password: %d, want %d", status, http.StatusOK)
+	}
+}
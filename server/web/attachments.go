@@ -0,0 +1,265 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"yt/chat/lib/blobstore"
+	"yt/chat/lib/config"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	DEFAULT_ATTACHMENT_DIR      = "attachments"
+	DEFAULT_ATTACHMENT_MAX_SIZE = 10 << 20 // 10MB
+	DEFAULT_ATTACHMENT_TYPES    = "image/png,image/jpeg,image/gif,application/pdf,text/plain"
+
+	ATTACHMENT_FORM_FIELD = "file"
+)
+
+func getAttachmentHandler(
+	wsSrvr *chat.Server,
+	attachmentDs model.IAttachmentDS,
+	store blobstore.IBlobStore,
+	h func(
+		http.ResponseWriter,
+		*http.Request,
+		*chat.Server,
+		model.IAttachmentDS,
+		blobstore.IBlobStore,
+	),
+) func(http.ResponseWriter, *http.Request) {
+
+	return auth.Authenticate(
+		func(resp http.ResponseWriter, req *http.Request) {
+			h(resp, req, wsSrvr, attachmentDs, store)
+		},
+	)
+}
+
+// Create the blob store of uploaded attachments
+func NewAttachmentStore() (blobstore.IBlobStore, error) {
+
+	dir := config.GetValue("ATTACHMENT_DIR")
+	if dir == "" {
+		dir = DEFAULT_ATTACHMENT_DIR
+	}
+	return blobstore.NewLocalStore(dir)
+}
+
+// Max. upload size in bytes
+func getAttachmentMaxSize() int64 {
+
+	size, err := strconv.ParseInt(config.GetValue("ATTACHMENT_MAX_SIZE"), 10, 64)
+	if err != nil || size <= 0 {
+		return DEFAULT_ATTACHMENT_MAX_SIZE
+	}
+	return size
+}
+
+// Check the content type against the allowed upload types
+func isAllowedContentType(contentType string) bool {
+
+	allowed := config.GetValue("ATTACHMENT_CONTENT_TYPES")
+	if allowed == "" {
+		allowed = DEFAULT_ATTACHMENT_TYPES
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(t) == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle file upload request. Returns the attachment id to send with messages.
+func onUploadAttachment(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	attachmentDs model.IAttachmentDS,
+	store blobstore.IBlobStore,
+) {
+	logger.Debug("onUploadAttachment")
+
+	ctxValue := req.Context().Value(auth.CONTEXT_KEY)
+	if ctxValue == nil {
+		sendErrorResponse(resp, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscr := ctxValue.(*datasource.Subscriber)
+
+	maxSize := getAttachmentMaxSize()
+	// Allow for the multipart headers
+	req.Body = http.MaxBytesReader(resp, req.Body, maxSize+4096)
+
+	file, header, err := req.FormFile(ATTACHMENT_FORM_FIELD)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendErrorResponse(resp, "File too large", http.StatusRequestEntityTooLarge)
+		} else {
+			sendErrorResponse(resp, "File required", http.StatusBadRequest)
+		}
+		return
+	}
+	defer func() {
+		file.Close()
+	}()
+
+	if header.Size > maxSize {
+		sendErrorResponse(resp, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Do not trust the client provided content type
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		sendErrorResponse(resp, "Read file failed", http.StatusBadRequest)
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+
+	if !isAllowedContentType(contentType) {
+		sendErrorResponse(resp, "File type not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		logger.Error("Read upload failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	id := uuid.New().String()
+
+	size, err := store.Put(id, io.LimitReader(file, maxSize))
+	if err != nil {
+		logger.Error("Store attachment failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := &datasource.Attachment{
+		Id:             id,
+		SubscriberName: subscr.Name,
+		FileName:       filepath.Base(header.Filename),
+		ContentType:    contentType,
+		Size:           size,
+	}
+
+	if err = attachmentDs.Add(attachment); err != nil {
+		logger.Error("Add attachment failed: " + err.Error())
+		store.Delete(id)
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResp := chat.AttachmentResponse{
+		Id:          id,
+		FileName:    attachment.FileName,
+		ContentType: contentType,
+		Size:        size,
+		Status:      chat.STATUS_SUCCESS,
+	}
+
+	respString, err := json.Marshal(jsonResp)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Write(respString)
+}
+
+// Handle file download request. Only for subscribers of the attachment's channel.
+func onDownloadAttachment(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	attachmentDs model.IAttachmentDS,
+	store blobstore.IBlobStore,
+) {
+	logger.Debug("onDownloadAttachment")
+
+	ctxValue := req.Context().Value(auth.CONTEXT_KEY)
+	if ctxValue == nil {
+		sendErrorResponse(resp, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscr := ctxValue.(*datasource.Subscriber)
+
+	id := mux.Vars(req)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		sendErrorResponse(resp, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	attachment, err := attachmentDs.Get(id)
+	if err != nil {
+		logger.Error("Get attachment failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if attachment == nil {
+		sendErrorResponse(resp, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	allowed, err := wsServer.CanReadAttachment(attachment, subscr.Name)
+	if err != nil {
+		logger.Error("Check attachment access failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		// Do not reveal attachments of other channels
+		sendErrorResponse(resp, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	blob, err := store.Get(id)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			sendErrorResponse(resp, "Attachment not found", http.StatusNotFound)
+		} else {
+			logger.Error("Get blob failed: " + err.Error())
+			sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer func() {
+		blob.Close()
+	}()
+
+	resp.Header().Set("Content-Type", attachment.GetContentType())
+	resp.Header().Set("Content-Length", strconv.FormatInt(attachment.GetSize(), 10))
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": attachment.GetFileName()}))
+
+	if _, err = io.Copy(resp, blob); err != nil {
+		logger.Error("Send attachment failed: " + err.Error())
+	}
+}
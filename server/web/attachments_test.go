@@ -0,0 +1,178 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"yt/chat/server/chat"
+
+	"github.com/gorilla/websocket"
+)
+
+// Smallest file sniffed as image/png
+var testPng = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+// Upload a file as the token subscriber. Returns the status, and response.
+func (m *testRoutes) upload(t *testing.T, token string, fileName string, data []byte) (int, *chat.AttachmentResponse) {
+
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile(ATTACHMENT_FORM_FIELD, fileName)
+	if err != nil {
+		t.Fatalf("CreateFormFile() failed: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, m.http.URL+"/attachments", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	attachment := &chat.AttachmentResponse{}
+	json.NewDecoder(resp.Body).Decode(attachment)
+
+	return resp.StatusCode, attachment
+}
+
+// Download an attachment as the token subscriber. Returns the status, and file.
+func (m *testRoutes) download(t *testing.T, token string, id string) (int, []byte) {
+
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, m.http.URL+"/attachments/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+// Send a websocket request, and get its ack
+func wsRequest(t *testing.T, conn *websocket.Conn, request *chat.Message) *chat.Message {
+
+	t.Helper()
+
+	request.MessageType = chat.MSGTYPE_REQ
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("Send %s failed: %v", request.RequestType, err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("No ack of %s: %v", request.RequestType, err)
+		}
+		// Queued messages are sent in one websocket message
+		for _, line := range strings.Split(string(data), "\n") {
+			message := &chat.Message{}
+			if json.Unmarshal([]byte(line), message) != nil {
+				continue
+			}
+			if message.MessageType == chat.MSGTYPE_ACK &&
+				(message.RequestType == request.RequestType ||
+					(request.RequestType == chat.REQ_JOIN_CHANNEL && message.RequestType == chat.REQ_JOINED_CHANNEL)) {
+				return message
+			}
+		}
+	}
+}
+
+func TestUploadAttachment(t *testing.T) {
+
+	t.Setenv("ATTACHMENT_MAX_SIZE", "1024")
+
+	routes := newTestRoutes(t)
+	alice := routes.register(t, "alice")
+
+	tests := []struct {
+		name     string
+		token    string
+		fileName string
+		data     []byte
+		status   int
+	}{
+		{"not logged in", "", "a.png", testPng, http.StatusBadRequest},
+		{"executable", alice.AccessToken, "a.png", []byte("MZ\x90\x00\x03\x00\x00\x00"), http.StatusUnsupportedMediaType},
+		{"too large", alice.AccessToken, "a.png", append(testPng, make([]byte, 2048)...), http.StatusRequestEntityTooLarge},
+		{"image", alice.AccessToken, "../a.png", testPng, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		status, resp := routes.upload(t, tt.token, tt.fileName, tt.data)
+		if status != tt.status {
+			t.Fatalf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+		if status == http.StatusOK && (resp.Id == "" || resp.ContentType != "image/png" ||
+			resp.FileName != "a.png" || resp.Size != int64(len(tt.data))) {
+			t.Errorf("%s: %+v", tt.name, resp)
+		}
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	alice := routes.register(t, "alice")
+	bob := routes.register(t, "bob")
+
+	status, uploaded := routes.upload(t, alice.AccessToken, "a.png", testPng)
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d", status)
+	}
+
+	// Unsent attachments are the uploader's only
+	if status, data := routes.download(t, alice.AccessToken, uploaded.Id); status != http.StatusOK || !bytes.Equal(data, testPng) {
+		t.Errorf("uploader download: %d, %d bytes", status, len(data))
+	}
+	if status, _ := routes.download(t, bob.AccessToken, uploaded.Id); status != http.StatusNotFound {
+		t.Errorf("download of an unsent attachment: %d, want %d", status, http.StatusNotFound)
+	}
+
+	aliceConn := routes.connect(t, alice.AccessToken)
+	bobConn := routes.connect(t, bob.AccessToken)
+	wsRequest(t, aliceConn, &chat.Message{RequestType: chat.REQ_JOIN_CHANNEL, ChannelName: "general"})
+	wsRequest(t, bobConn, &chat.Message{RequestType: chat.REQ_JOIN_CHANNEL, ChannelName: "general"})
+
+	ack := wsRequest(t, aliceConn, &chat.Message{
+		RequestType: chat.REQ_SEND_MESSAGE,
+		ChannelName: "general",
+		Attachments: []string{uploaded.Id},
+	})
+	if ack.Status != chat.STATUS_SUCCESS {
+		t.Fatalf("send: %s (%s)", ack.Status, ack.Message)
+	}
+
+	// Sent attachments are for the channel subscribers
+	if status, data := routes.download(t, bob.AccessToken, uploaded.Id); status != http.StatusOK || !bytes.Equal(data, testPng) {
+		t.Errorf("subscriber download: %d, %d bytes", status, len(data))
+	}
+
+	carol := routes.register(t, "carol")
+	if status, _ := routes.download(t, carol.AccessToken, uploaded.Id); status != http.StatusNotFound {
+		t.Errorf("download by a non subscriber: %d, want %d", status, http.StatusNotFound)
+	}
+	if status, _ := routes.download(t, carol.AccessToken, "not-an-id"); status != http.StatusNotFound {
+		t.Errorf("download of an invalid id: %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"unicode"
+	"yt/chat/lib/mailer"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+)
+
+const (
+	// Registration failure codes. See AppResponse.Code
+	REGISTER_ERR_INVALID_NAME  = "invalid_name"
+	REGISTER_ERR_INVALID_EMAIL = "invalid_email"
+	REGISTER_ERR_WEAK_PASSWORD = "weak_password"
+	REGISTER_ERR_NAME_TAKEN    = "name_taken"
+	REGISTER_ERR_EMAIL_TAKEN   = "email_taken"
+
+	MIN_PASSWORD_LENGTH = 8
+	MAX_PASSWORD_LENGTH = 72 // bcrypt ignores the rest
+	MAX_EMAIL_LENGTH    = 100
+)
+
+// Letters, digits, and '.', '_', '-'. Fits the subscriber name column.
+var subscriberNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{3,50}$`)
+
+// Handle subscriber registration request. Responds with a token, as in login.
+func onRegister(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onRegister")
+
+	if wsServer.Stopping {
+		sendErrorResponse(resp, "Connection refused.", http.StatusGone)
+		return
+	}
+
+	var subscr datasource.Subscriber
+
+	err := json.NewDecoder(req.Body).Decode(&subscr)
+	if err != nil {
+		logger.Error("Decode failed: " + err.Error())
+		sendErrorResponse(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !subscriberNameRegex.MatchString(subscr.Name) {
+		sendAppError(resp, REGISTER_ERR_INVALID_NAME,
+			"Name must be 3 to 50 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if !isValidEmail(subscr.Email) {
+		sendAppError(resp, REGISTER_ERR_INVALID_EMAIL, "Invalid email", http.StatusBadRequest)
+		return
+	}
+	if !isStrongPassword(subscr.Password) {
+		sendAppError(resp, REGISTER_ERR_WEAK_PASSWORD,
+			"Password must be 8 to 72 characters, with upper and lower case letters, and digits",
+			http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashString(subscr.Password)
+	if err != nil {
+		logger.Error("Hash password failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	subscr.Password = hash
+	subscr.Type = datasource.SUBSCRIBER_TYPE_LOGIN
+
+	err = subscriberDs.Add(&subscr)
+	if err == datasource.ErrDuplicateName {
+		sendAppError(resp, REGISTER_ERR_NAME_TAKEN, "Name is taken", http.StatusConflict)
+		return
+	} else if err == datasource.ErrDuplicateEmail {
+		sendAppError(resp, REGISTER_ERR_EMAIL_TAKEN, "Email is registered", http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.Error("Add subscriber failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Registered subscriber: " + subscr.Name)
+
+	// Get the assigned id
+	subs, err := subscriberDs.Get(&subscr)
+	if err != nil || subs == nil {
+		logger.Error("Get registered subscriber failed: " + subscr.Name)
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	recSubs := subs.(*datasource.Subscriber)
+
+	// Best effort. The subscriber may request another verification email.
+	err = sendVerificationEmail(recSubs, tokenDs, mailSender)
+	if err != nil {
+		logger.Error("Send verification email failed: " + err.Error())
+	}
+
+	token, err := issueTokens(recSubs, tokenDs)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResp := chat.AppResponse{
+		Token:  token,
+		Name:   recSubs.Name,
+		Email:  recSubs.Email,
+		Status: chat.STATUS_SUCCESS,
+	}
+
+	respString, err := json.Marshal(jsonResp)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusCreated)
+	resp.Write(respString)
+}
+
+func isValidEmail(email string) bool {
+
+	if len(email) > MAX_EMAIL_LENGTH {
+		return false
+	}
+
+	// Plain address only. No display name, e.g. "Bob <bob@example.com>"
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func isStrongPassword(password string) bool {
+
+	if len(password) < MIN_PASSWORD_LENGTH || len(password) > MAX_PASSWORD_LENGTH {
+		return false
+	}
+
+	var upper, lower, digit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+
+	return upper && lower && digit
+}
+
+// Failed response with a failure code the client can act on
+func sendAppError(resp http.ResponseWriter, code string, msg string, errCode int) {
+
+	jsonResp := chat.AppResponse{
+		Status:  chat.STATUS_FAILED,
+		Message: msg,
+		Code:    code,
+	}
+
+	respString, err := json.Marshal(jsonResp)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(errCode)
+	resp.Write(respString)
+}
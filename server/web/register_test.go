@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+
+	routes := newTestRoutes(t)
+
+	tests := []struct {
+		name     string
+		subName  string
+		email    string
+		password string
+		status   int
+		code     string
+	}{
+		{"short name", "bo", "bo@example.com", TEST_PASSWORD, http.StatusBadRequest, REGISTER_ERR_INVALID_NAME},
+		{"name with spaces", "bob smith", "bob@example.com", TEST_PASSWORD, http.StatusBadRequest, REGISTER_ERR_INVALID_NAME},
+		{"display name email", "bob", "Bob <bob@example.com>", TEST_PASSWORD, http.StatusBadRequest, REGISTER_ERR_INVALID_EMAIL},
+		{"no digits", "bob", "bob@example.com", "SecretSecret", http.StatusBadRequest, REGISTER_ERR_WEAK_PASSWORD},
+		{"too long password", "bob", "bob@example.com", "Aa1" + strings.Repeat("a", MAX_PASSWORD_LENGTH), http.StatusBadRequest, REGISTER_ERR_WEAK_PASSWORD},
+		{"valid", "bob", "bob@example.com", TEST_PASSWORD, http.StatusCreated, ""},
+		{"name taken", "bob", "robert@example.com", TEST_PASSWORD, http.StatusConflict, REGISTER_ERR_NAME_TAKEN},
+		{"email taken", "robert", "bob@example.com", TEST_PASSWORD, http.StatusConflict, REGISTER_ERR_EMAIL_TAKEN},
+	}
+
+	for _, tt := range tests {
+
+		status, resp := routes.post(t, "/register", map[string]string{
+			"name":     tt.subName,
+			"email":    tt.email,
+			"password": tt.password,
+		})
+		if status != tt.status || resp.Code != tt.code {
+			t.Fatalf("%s: %d %q, want %d %q", tt.name, status, resp.Code, tt.status, tt.code)
+		}
+		if status == http.StatusCreated && (resp.Token == nil || resp.Token.AccessToken == "" ||
+			resp.Token.RefreshToken == "" || resp.Name != tt.subName) {
+			t.Errorf("%s: %+v, want the tokens of %s", tt.name, resp, tt.subName)
+		}
+	}
+
+	// Logged in as registered, and asked to confirm the email
+	if status, _ := routes.login(t, "bob", TEST_PASSWORD); status != http.StatusOK {
+		t.Errorf("login after register: %d", status)
+	}
+	routes.mails.linkToken(t, "bob@example.com")
+
+	// Anonymous subscribers may not take the name
+	resp, err := http.Get(routes.http.URL + "/ws?name=bob&email=other@example.com")
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("anonymous connect with a registered name: %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+}
@@ -2,7 +2,9 @@ package web
 
 import (
 	"net/http"
+	"yt/chat/lib/blobstore"
 	"yt/chat/lib/config"
+	"yt/chat/lib/mailer"
 	"yt/chat/server/chat"
 	"yt/chat/server/chat/auth"
 	"yt/chat/server/chat/model"
@@ -39,6 +41,10 @@ func GetRoutes(
 	rds *redis.Client,
 	channelDs model.IChannelDS,
 	subscriberDs model.ISubscriberDS,
+	attachmentDs model.IAttachmentDS,
+	attachmentStore blobstore.IBlobStore,
+	accountTokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
 ) *http.Handler {
 
 	var handler http.Handler
@@ -67,14 +73,114 @@ func GetRoutes(
 	// Subscriber login requests
 	//
 
-	f = r.HandleFunc("/login", getServiceHandler(
+	f = r.HandleFunc("/login", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onLogin,
+	))
+	f.Methods("POST")
+
+	// Token refresh, and logout requests
+	//
+
+	f = r.HandleFunc("/token/refresh", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onRefreshToken,
+	))
+	f.Methods("POST")
+
+	f = r.HandleFunc("/logout", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onLogout,
+	))
+	f.Methods("POST")
+
+	// Subscriber registration requests
+	//
+
+	f = r.HandleFunc("/register", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onRegister,
+	))
+	f.Methods("POST")
+
+	// Email verification, and password reset requests
+	//
+
+	f = r.HandleFunc("/verify-email", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onVerifyEmail,
+	))
+	f.Methods("GET")
+
+	f = r.HandleFunc("/forgot-password", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onForgotPassword,
+	))
+	f.Methods("POST")
+
+	f = r.HandleFunc("/reset-password", getAccountHandler(
+		wsSrvr,
+		subscriberDs,
+		accountTokenDs,
+		mailSender,
+		onResetPassword,
+	))
+	f.Methods("POST")
+
+	// Public keys of access tokens. No authentication.
+	//
+
+	f = r.HandleFunc("/.well-known/jwks.json", onJWKS)
+	f.Methods("GET")
+
+	// Message search requests
+	//
+
+	f = r.HandleFunc("/search", getServiceHandler(
 		wsSrvr,
 		rds,
 		channelDs,
 		subscriberDs,
-		onLogin,
+		onSearch,
+	))
+	f.Methods("GET")
+
+	// Attachment upload, download requests
+	//
+
+	f = r.HandleFunc("/attachments", getAttachmentHandler(
+		wsSrvr,
+		attachmentDs,
+		attachmentStore,
+		onUploadAttachment,
 	))
 	f.Methods("POST")
 
+	f = r.HandleFunc("/attachments/{id}", getAttachmentHandler(
+		wsSrvr,
+		attachmentDs,
+		attachmentStore,
+		onDownloadAttachment,
+	))
+	f.Methods("GET")
+
 	return &handler
 }
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"yt/chat/lib/blobstore"
+	"yt/chat/lib/transport"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+
+	"github.com/gorilla/websocket"
+)
+
+// Handlers run behind the routes of a single chat server, with the
+// in-process transport, and state, and the memory data sources. Emails are
+// kept, not sent. See newTestRoutes.
+
+const TEST_PASSWORD = "Secret123"
+
+type testRoutes struct {
+	wsServer *chat.Server
+	store    *datasource.MemoryStore
+	tokenDs  *datasource.AccountTokenMemory
+	mails    *testMailer
+	http     *httptest.Server
+}
+
+type testMail struct {
+	to      string
+	subject string
+	body    string
+}
+
+type testMailer struct {
+	mu    sync.Mutex
+	mails []testMail
+}
+
+func (m *testMailer) Send(to string, subject string, body string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mails = append(m.mails, testMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+var linkTokenRegex = regexp.MustCompile(`token=(\S+)`)
+
+// Token of the link in the last email to the address
+func (m *testMailer) linkToken(t *testing.T, to string) string {
+
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.mails) - 1; i >= 0; i-- {
+		if m.mails[i].to != to {
+			continue
+		}
+		match := linkTokenRegex.FindStringSubmatch(m.mails[i].body)
+		if match == nil {
+			t.Fatalf("no link in %q", m.mails[i].body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("link token %q: %v", match[1], err)
+		}
+		return token
+	}
+
+	t.Fatalf("no email to %s", to)
+	return ""
+}
+
+func newTestRoutes(t *testing.T) *testRoutes {
+
+	t.Helper()
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	if err := auth.LoadKeys(); err != nil {
+		t.Fatalf("LoadKeys() failed: %v", err)
+	}
+
+	store := datasource.NewMemoryStore()
+	subscriberDs := &datasource.SubscriberMemory{Store: store}
+	attachmentDs := &datasource.AttachmentMemory{Store: store}
+
+	wsServer := chat.NewServer(
+		chat.NewMemoryState(),
+		transport.NewMemoryTransport(),
+		&datasource.ChannelMemory{Store: store},
+		subscriberDs,
+		&datasource.MessageMemory{Store: store},
+		&datasource.ChannelMemberMemory{Store: store},
+		&datasource.ReadMarkerMemory{Store: store},
+		&datasource.MentionMemory{Store: store},
+		attachmentDs,
+	)
+	wsServer.Start()
+
+	auth.SetSubscriberDS(subscriberDs)
+	auth.SetRevocationList(auth.NewMemoryRevocationList())
+
+	attachmentStore, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore() failed: %v", err)
+	}
+
+	ts := &testRoutes{
+		wsServer: wsServer,
+		store:    store,
+		tokenDs:  &datasource.AccountTokenMemory{Store: store},
+		mails:    &testMailer{},
+	}
+
+	handler := GetRoutes(
+		wsServer,
+		nil,
+		&datasource.ChannelMemory{Store: store},
+		subscriberDs,
+		attachmentDs,
+		attachmentStore,
+		ts.tokenDs,
+		ts.mails,
+	)
+	ts.http = httptest.NewServer(*handler)
+
+	t.Cleanup(func() {
+		ts.http.CloseClientConnections()
+		ts.http.Close()
+	})
+
+	return ts
+}
+
+// Send a request, and decode the response. Token is optional.
+func (m *testRoutes) do(t *testing.T, method string, path string, body interface{}, token string) (int, *chat.AppResponse) {
+
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Encode %s body failed: %v", path, err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, m.http.URL+path, reader)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	// Failures of sendErrorResponse are not all valid JSON
+	appResp := &chat.AppResponse{}
+	json.NewDecoder(resp.Body).Decode(appResp)
+
+	return resp.StatusCode, appResp
+}
+
+func (m *testRoutes) post(t *testing.T, path string, body interface{}) (int, *chat.AppResponse) {
+	t.Helper()
+	return m.do(t, http.MethodPost, path, body, "")
+}
+
+// Register a subscriber, and get its tokens
+func (m *testRoutes) register(t *testing.T, name string) *auth.TokenMeta {
+
+	t.Helper()
+
+	status, resp := m.post(t, "/register", map[string]string{
+		"name":     name,
+		"email":    name + "@example.com",
+		"password": TEST_PASSWORD,
+	})
+	if status != http.StatusCreated || resp.Token == nil {
+		t.Fatalf("register %s: %d %s", name, status, resp.Message)
+	}
+	return resp.Token
+}
+
+// Log in, and get new tokens
+func (m *testRoutes) login(t *testing.T, name string, password string) (int, *chat.AppResponse) {
+	t.Helper()
+	return m.post(t, "/login", map[string]string{"name": name, "password": password})
+}
+
+// Open a websocket session with an access token
+func (m *testRoutes) connect(t *testing.T, accessToken string) *websocket.Conn {
+
+	t.Helper()
+
+	wsUrl := "ws" + strings.TrimPrefix(m.http.URL, "http") + "/ws?jwt=" + url.QueryEscape(accessToken)
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// Read until the server closes the session. Returns the close code.
+func expectClosed(t *testing.T, conn *websocket.Conn) int {
+
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr.Code
+		}
+		t.Fatalf("session not closed: %v", err)
+		return 0
+	}
+}
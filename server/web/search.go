@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Handle message search request.
+//
+// Query: q (search text), channel, sender, from, to (RFC3339), cursor, pagesize
+func onSearch(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	rds *redis.Client,
+	channelDs model.IChannelDS,
+	subscriberDs model.ISubscriberDS,
+) {
+	logger.Debug("onSearch")
+
+	ctxValue := req.Context().Value(auth.CONTEXT_KEY)
+	if ctxValue == nil {
+		sendErrorResponse(resp, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscr := ctxValue.(*datasource.Subscriber)
+	query := req.URL.Query()
+
+	message := chat.Message{
+		RequestType: chat.REQ_SEARCH,
+		Message:     query.Get("q"),
+		ChannelName: query.Get("channel"),
+		Sender:      query.Get("sender"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	if pageSize := query.Get("pagesize"); pageSize != "" {
+		size, err := strconv.Atoi(pageSize)
+		if err != nil {
+			sendErrorResponse(resp, "Invalid page size", http.StatusBadRequest)
+			return
+		}
+		message.PageSize = size
+	}
+
+	var err error
+
+	if message.From, err = getQueryTime(req, "from"); err != nil {
+		sendErrorResponse(resp, "Invalid date: from", http.StatusBadRequest)
+		return
+	}
+	if message.To, err = getQueryTime(req, "to"); err != nil {
+		sendErrorResponse(resp, "Invalid date: to", http.StatusBadRequest)
+		return
+	}
+
+	err = wsServer.Search(subscr.Name, &message)
+	if err != nil {
+		if err == chat.ErrEmptySearch || err == chat.ErrInvalidCursor {
+			sendErrorResponse(resp, err.Error(), http.StatusBadRequest)
+		} else {
+			logger.Error("Search failed: " + err.Error())
+			sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	jsonResp := chat.SearchResponse{
+		Results:  message.History,
+		Cursor:   message.Cursor,
+		PageSize: message.PageSize,
+		Status:   chat.STATUS_SUCCESS,
+	}
+
+	respString, err := json.Marshal(jsonResp)
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Write(respString)
+}
+
+// Get an optional RFC3339 time query parameter
+func getQueryTime(req *http.Request, name string) (*time.Time, error) {
+
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"yt/chat/lib/mailer"
 	"yt/chat/lib/utils/log"
 	"yt/chat/server/chat"
 	"yt/chat/server/chat/auth"
@@ -68,9 +69,9 @@ func onLogin(
 	resp http.ResponseWriter,
 	req *http.Request,
 	wsServer *chat.Server,
-	rds *redis.Client,
-	channelDs model.IChannelDS,
 	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
 ) {
 	log.GetLogger().Debug("onLogin")
 
@@ -90,7 +91,7 @@ func onLogin(
 	}
 	// Find the user in the database by username
 	subscr.Type = datasource.SUBSCRIBER_TYPE_LOGIN
-	subs, err := subscriberDs.(*datasource.SubscriberPgsql).GetLoginInfo(&subscr)
+	subs, err := subscriberDs.GetLoginInfo(&subscr)
 
 	if err != nil {
 		log.GetLogger().Error(err.Error())
@@ -118,8 +119,8 @@ func onLogin(
 
 	log.GetLogger().Debug("create token")
 
-	// Create a JWT
-	token, err := auth.NewToken(recSubs)
+	// Create a JWT, and refresh token
+	token, err := issueTokens(recSubs, tokenDs)
 
 	if err != nil {
 		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"yt/chat/lib/mailer"
+	"yt/chat/server/chat"
+	"yt/chat/server/chat/auth"
+	"yt/chat/server/chat/datasource"
+	"yt/chat/server/chat/model"
+)
+
+const REFRESH_TOKEN_TTL = 30 * 24 * time.Hour
+
+type tokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Create an access token, and a single use refresh token of the subscriber
+func issueTokens(subscr *datasource.Subscriber, tokenDs model.IAccountTokenDS) (*auth.TokenMeta, error) {
+
+	tokenMeta, err := auth.NewToken(subscr)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenMeta.RefreshToken, err = newAccountToken(subscr.Name, datasource.TOKEN_PURPOSE_REFRESH,
+		REFRESH_TOKEN_TTL, tokenDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenMeta, nil
+}
+
+// Handle access token refresh request. The refresh token is replaced.
+//
+// Body: {"refresh_token": ""}
+func onRefreshToken(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onRefreshToken")
+
+	var request tokenRequest
+
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil || request.RefreshToken == "" {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Refresh token required", http.StatusBadRequest)
+		return
+	}
+
+	accountToken, err := tokenDs.Take(auth.HashToken(request.RefreshToken), datasource.TOKEN_PURPOSE_REFRESH)
+	if err != nil {
+		logger.Error("Take refresh token failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if accountToken == nil {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	subs, err := subscriberDs.Get(&datasource.Subscriber{
+		Name: accountToken.GetSubscriberName(),
+		Type: datasource.SUBSCRIBER_TYPE_LOGIN,
+	})
+	if err != nil {
+		logger.Error("Get subscriber failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		sendAppError(resp, ACCOUNT_ERR_INVALID_TOKEN, "Invalid, or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	recSubs := subs.(*datasource.Subscriber)
+
+	token, err := issueTokens(recSubs, tokenDs)
+	if err != nil {
+		logger.Error("Issue tokens failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	sendAppResponse(resp, chat.AppResponse{
+		Token:  token,
+		Name:   recSubs.Name,
+		Email:  recSubs.Email,
+		Status: chat.STATUS_SUCCESS,
+	})
+}
+
+// Handle logout request. Revokes the access token, and the refresh token.
+//
+// Body: {"refresh_token": ""}, optional
+func onLogout(
+	resp http.ResponseWriter,
+	req *http.Request,
+	wsServer *chat.Server,
+	subscriberDs model.ISubscriberDS,
+	tokenDs model.IAccountTokenDS,
+	mailSender mailer.IMailer,
+) {
+	logger.Debug("onLogout")
+
+	ctxValue := req.Context().Value(auth.CLAIM_CONTEXT_KEY)
+	if ctxValue == nil {
+		sendErrorResponse(resp, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	claim := ctxValue.(*auth.TokenClaim)
+
+	err := auth.RevokeToken(claim)
+	if err == auth.ErrTokenNotRevocable {
+		logger.Warn("Logout with a token that can not be revoked: " + claim.GetName())
+	} else if err != nil {
+		logger.Error("Revoke token failed: " + err.Error())
+		sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	var request tokenRequest
+
+	// Body is optional
+	json.NewDecoder(req.Body).Decode(&request)
+
+	if request.RefreshToken != "" {
+		_, err = tokenDs.Take(auth.HashToken(request.RefreshToken), datasource.TOKEN_PURPOSE_REFRESH)
+		if err != nil {
+			logger.Error("Revoke refresh token failed: " + err.Error())
+			sendErrorResponse(resp, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	logger.Info("Logged out: " + claim.GetName())
+
+	sendAppResponse(resp, chat.AppResponse{
+		Name:    claim.GetName(),
+		Status:  chat.STATUS_SUCCESS,
+		Message: "Logged out",
+	})
+}
+
+// Serve the public keys of access tokens, e.g. to verify tokens in other services
+func onJWKS(resp http.ResponseWriter, req *http.Request) {
+
+	respString, err := json.Marshal(auth.GetJWKS())
+	if err != nil {
+		sendErrorResponse(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "public, max-age=300")
+	resp.Write(respString)
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRefreshToken(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	registered := routes.register(t, "bob")
+
+	refresh := func(refreshToken string) (int, string) {
+		status, resp := routes.post(t, "/token/refresh", map[string]string{"refresh_token": refreshToken})
+		if status == http.StatusOK {
+			if resp.Name != "bob" || resp.Token == nil || resp.Token.AccessToken == "" {
+				t.Fatalf("refresh: %+v, want the tokens of bob", resp)
+			}
+			return status, resp.Token.RefreshToken
+		}
+		return status, ""
+	}
+
+	status, replaced := refresh(registered.RefreshToken)
+	if status != http.StatusOK || replaced == "" || replaced == registered.RefreshToken {
+		t.Fatalf("refresh: %d, want a new refresh token", status)
+	}
+
+	// Single use
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"none", "", http.StatusBadRequest},
+		{"used", registered.RefreshToken, http.StatusUnauthorized},
+		{"unknown", "unknown", http.StatusUnauthorized},
+		{"replaced", replaced, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, _ := refresh(tt.token); status != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, status, tt.status)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+
+	routes := newTestRoutes(t)
+	registered := routes.register(t, "bob")
+
+	if status, _ := routes.post(t, "/logout", nil); status != http.StatusBadRequest {
+		t.Errorf("logout without a token: %d, want %d", status, http.StatusBadRequest)
+	}
+
+	status, resp := routes.do(t, http.MethodPost, "/logout",
+		map[string]string{"refresh_token": registered.RefreshToken}, registered.AccessToken)
+	if status != http.StatusOK || resp.Name != "bob" {
+		t.Fatalf("logout: %d %s", status, resp.Message)
+	}
+
+	// Both tokens are revoked
+	if status, _ = routes.do(t, http.MethodGet, "/search?q=hello", nil, registered.AccessToken); status != http.StatusForbidden {
+		t.Errorf("request with a revoked token: %d, want %d", status, http.StatusForbidden)
+	}
+	status, _ = routes.post(t, "/token/refresh", map[string]string{"refresh_token": registered.RefreshToken})
+	if status != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Other logins are not
+	status, loggedIn := routes.login(t, "bob", TEST_PASSWORD)
+	if status != http.StatusOK {
+		t.Fatalf("login: %d", status)
+	}
+	status, _ = routes.post(t, "/token/refresh", map[string]string{"refresh_token": loggedIn.Token.RefreshToken})
+	if status != http.StatusOK {
+		t.Errorf("refresh of another login: %d, want %d", status, http.StatusOK)
+	}
+}